@@ -0,0 +1,526 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/deiu/rdf2go"
+)
+
+// datasetDistribution is a download of the history listed in the dataset
+// descriptions.
+type datasetDistribution struct {
+	// export of historyURL, "" for the JSON API
+	Export    string
+	Title     string
+	MediaType string
+}
+
+var datasetDistributions = []datasetDistribution{
+	{"", "JSON", "application/json"},
+	{"csv", "CSV", "text/csv"},
+	{"jsonl", "JSON Lines", "application/x-ndjson"},
+	{"jsonld", "JSON-LD", "application/ld+json"},
+	{"sparql", "Turtle", "text/turtle"},
+	{"n-quads", "N-Quads", "application/n-quads"},
+	{"owlrdf", "RDF/XML", "application/rdf+xml"},
+	{"hdt", "HDT", "application/vnd.hdt"},
+}
+
+// datasetField describes a column of the CSV export.
+type datasetField struct {
+	Name        string
+	Type        string // Table Schema type
+	Description string
+	Unit        string
+	Constraints map[string]any
+}
+
+var datasetFields = []datasetField{
+	{"timestamp", "datetime", "Time of the reading (UTC)", "", nil},
+	{"temp", "number", "Temperature", "°C", map[string]any{"minimum": -40, "maximum": 85}},
+	{"humidity", "number", "Relative humidity", "%", map[string]any{"minimum": 0, "maximum": 100}},
+	{"battery_mv", "integer", "Battery voltage", "mV", map[string]any{"minimum": 0}},
+	{"battery_level", "integer", "Battery level", "%", map[string]any{"minimum": 0, "maximum": 100}},
+}
+
+// datasetLicense is the license of the datasets from the server config.
+func datasetLicense() string {
+	if serverConfig.License != "" {
+		return serverConfig.License
+	}
+	return "ODC-PDDL-1.0"
+}
+
+// datasetCoverage is the time span of the readings of a sensor.
+type datasetCoverage struct {
+	First, Last time.Time
+	Count       int
+}
+
+// loadCoverage reads the time span of the readings in the logger database,
+// zero times if there are none.
+func loadCoverage(db *sql.DB) (datasetCoverage, error) {
+	var coverage datasetCoverage
+	var first, last sql.NullString
+	err := db.QueryRow("SELECT MIN(timestamp), MAX(timestamp), COUNT(*) FROM sensor_data").Scan(&first, &last, &coverage.Count)
+	if err != nil || coverage.Count == 0 {
+		return coverage, err
+	}
+	if coverage.First, err = time.Parse(sqliteTimeFormat, first.String); err != nil {
+		return coverage, err
+	}
+	coverage.Last, err = time.Parse(sqliteTimeFormat, last.String)
+	return coverage, err
+}
+
+// datasetContactName is the contact of the datasets from the server config.
+func datasetContactName() string {
+	if serverConfig.ContactName != "" {
+		return serverConfig.ContactName
+	}
+	return "Mijia sensor server"
+}
+
+// exportDcat writes a DCAT catalog in Turtle describing the history of the
+// sensor as dataset with its downloads as distributions, for harvesting by
+// open data portals like CKAN (ckanext-dcat).
+func exportDcat(w http.ResponseWriter, r *http.Request) {
+	sensor, ok := loadSensor(w, r)
+	if !ok {
+		return
+	}
+	coverage, err := loadCoverage(configMap[sensor.Mac].Db)
+	if err != nil {
+		exportError(w, err)
+		return
+	}
+
+	const (
+		dcat  = "http://www.w3.org/ns/dcat#"
+		dct   = "http://purl.org/dc/terms/"
+		vcard = "http://www.w3.org/2006/vcard/ns#"
+		locn  = "http://www.w3.org/ns/locn#"
+	)
+	graph := rdf2go.NewGraph(historyURL(r, sensor.Mac, ""))
+	for prefix, namespace := range map[string]string{
+		"rdf": rdfNamespace, "xsd": xsdNamespace, "dcat": dcat, "dct": dct, "vcard": vcard, "locn": locn,
+	} {
+		graph.AddPrefix(prefix, namespace)
+	}
+	add := func(s rdf2go.Term, p string, o rdf2go.Term) {
+		graph.Add(rdf2go.NewTriple(s, rdf2go.NewResource(p), o))
+	}
+	resource := rdf2go.NewResource
+	literal := rdf2go.NewLiteral
+
+	catalog := resource(serverURL(r) + "/")
+	dataset := resource(historyURL(r, sensor.Mac, ""))
+	add(catalog, rdfNamespace+"type", resource(dcat+"Catalog"))
+	add(catalog, dct+"title", literal("Mijia sensors"))
+	add(catalog, dcat+"dataset", dataset)
+
+	title := feedTitle(sensor)
+	add(dataset, rdfNamespace+"type", resource(dcat+"Dataset"))
+	add(dataset, dct+"identifier", literal(sensor.Mac))
+	add(dataset, dct+"title", literal(title+" sensor readings"))
+	add(dataset, dct+"description", literal("Temperature, humidity and battery readings of the Xiaomi Mijia sensor "+sensor.Mac+" in "+title+"."))
+	add(dataset, dcat+"keyword", literal("temperature"))
+	add(dataset, dcat+"keyword", literal("humidity"))
+	add(dataset, dcat+"landingPage", resource(serverURL(r)+"/"))
+
+	if coverage.Count > 0 {
+		period := rdf2go.NewBlankNode("temporal")
+		add(dataset, dct+"temporal", period)
+		add(period, rdfNamespace+"type", resource(dct+"PeriodOfTime"))
+		add(period, dcat+"startDate", xsdLiteral(coverage.First.UTC().Format(time.RFC3339), "dateTime"))
+		add(period, dcat+"endDate", xsdLiteral(coverage.Last.UTC().Format(time.RFC3339), "dateTime"))
+	}
+	if sensor.Loc != "" {
+		location := rdf2go.NewBlankNode("spatial")
+		add(dataset, dct+"spatial", location)
+		add(location, rdfNamespace+"type", resource(dct+"Location"))
+		add(location, locn+"geographicName", literal(sensor.Loc))
+	}
+
+	contact := rdf2go.NewBlankNode("contact")
+	add(dataset, dcat+"contactPoint", contact)
+	add(contact, rdfNamespace+"type", resource(vcard+"Kind"))
+	add(contact, vcard+"fn", literal(datasetContactName()))
+	if serverConfig.ContactEmail != "" {
+		add(contact, vcard+"hasEmail", resource("mailto:"+serverConfig.ContactEmail))
+	}
+
+	for _, d := range datasetDistributions {
+		id := d.Export
+		if id == "" {
+			id = "json"
+		}
+		distribution := rdf2go.NewBlankNode(id)
+		url := resource(historyURL(r, sensor.Mac, d.Export))
+		add(dataset, dcat+"distribution", distribution)
+		add(distribution, rdfNamespace+"type", resource(dcat+"Distribution"))
+		add(distribution, dct+"title", literal(d.Title))
+		add(distribution, dcat+"accessURL", url)
+		add(distribution, dcat+"downloadURL", url)
+		add(distribution, dcat+"mediaType", resource("https://www.iana.org/assignments/media-types/"+d.MediaType))
+	}
+
+	var out bytes.Buffer
+	if err := graph.Serialize(&out, "text/turtle"); err != nil {
+		exportError(w, err)
+		return
+	}
+	setAttachment(w, "text/turtle", sensorName(sensor.Mac)+"_dcat.ttl")
+	w.Write(out.Bytes())
+}
+
+// schemaOrgDataset builds the schema.org Dataset markup of the history of
+// the sensor, as understood by Google Dataset Search.
+func schemaOrgDataset(r *http.Request, sensor *SensorHistory, coverage datasetCoverage) map[string]any {
+	title := feedTitle(sensor)
+	creator := map[string]any{"@type": "Organization", "name": datasetContactName()}
+	if serverConfig.ContactName != "" {
+		creator["@type"] = "Person"
+	}
+	if serverConfig.ContactEmail != "" {
+		creator["email"] = serverConfig.ContactEmail
+	}
+	dataset := map[string]any{
+		"@context":             "https://schema.org/",
+		"@type":                "Dataset",
+		"@id":                  historyURL(r, sensor.Mac, ""),
+		"url":                  historyURL(r, sensor.Mac, ""),
+		"identifier":           sensor.Mac,
+		"name":                 title + " sensor readings",
+		"description":          "Temperature, humidity and battery readings of the Xiaomi Mijia sensor " + sensor.Mac + " in " + title + ".",
+		"keywords":             []string{"temperature", "humidity"},
+		"creator":              creator,
+		"measurementTechnique": "Bluetooth Low Energy (BLE) advertisements",
+		"variableMeasured": []map[string]any{
+			{"@type": "PropertyValue", "name": "temperature", "unitCode": "CEL", "unitText": "°C"},
+			{"@type": "PropertyValue", "name": "humidity", "unitCode": "P1", "unitText": "%"},
+			{"@type": "PropertyValue", "name": "battery_mv", "unitCode": "2Z", "unitText": "mV"},
+			{"@type": "PropertyValue", "name": "battery_level", "unitCode": "P1", "unitText": "%"},
+		},
+	}
+	if coverage.Count > 0 {
+		dataset["temporalCoverage"] = coverage.First.UTC().Format(time.RFC3339) + "/" + coverage.Last.UTC().Format(time.RFC3339)
+	}
+	if sensor.Loc != "" {
+		dataset["spatialCoverage"] = map[string]any{"@type": "Place", "name": sensor.Loc}
+	}
+	var distributions []map[string]any
+	for _, d := range datasetDistributions {
+		distributions = append(distributions, map[string]any{
+			"@type":          "DataDownload",
+			"name":           d.Title,
+			"encodingFormat": d.MediaType,
+			"contentUrl":     historyURL(r, sensor.Mac, d.Export),
+		})
+	}
+	dataset["distribution"] = distributions
+	return dataset
+}
+
+// exportSchemaOrg writes the schema.org Dataset markup of the history.
+func exportSchemaOrg(w http.ResponseWriter, r *http.Request) {
+	sensor, ok := loadSensor(w, r)
+	if !ok {
+		return
+	}
+	coverage, err := loadCoverage(configMap[sensor.Mac].Db)
+	if err != nil {
+		exportError(w, err)
+		return
+	}
+	writeJSON(w, "application/ld+json", schemaOrgDataset(r, sensor, coverage))
+}
+
+// schemaOrgDatasets builds the schema.org Dataset markup of all sensors for
+// the home page. Sensors failing to read their coverage are left out.
+func schemaOrgDatasets(r *http.Request) []map[string]any {
+	macs := make([]string, 0, len(configMap))
+	for mac := range configMap {
+		macs = append(macs, mac)
+	}
+	sort.Strings(macs)
+
+	datasets := []map[string]any{}
+	for _, mac := range macs {
+		config := configMap[mac]
+		coverage, err := loadCoverage(config.Db)
+		if err != nil {
+			log.Printf("%s: %v", mac, err)
+			continue
+		}
+		datasets = append(datasets, schemaOrgDataset(r, &SensorHistory{Mac: mac, Loc: config.Loc}, coverage))
+	}
+	return datasets
+}
+
+// exportFrictionless writes the history as Frictionless Data Package: the
+// datapackage.json descriptor with the Table Schema of the CSV export and
+// the readings as sensor_data.csv, e.g. for `frictionless validate`.
+func exportFrictionless(w http.ResponseWriter, r *http.Request) {
+	history, ok := loadHistory(w, r)
+	if !ok {
+		return
+	}
+
+	var data bytes.Buffer
+	if err := writeHistoryCSV(&data, history); err != nil {
+		exportError(w, err)
+		return
+	}
+
+	var fields []map[string]any
+	for _, field := range datasetFields {
+		description := field.Description
+		if field.Unit != "" {
+			description += " in " + field.Unit
+		}
+		constraints := map[string]any{"required": true}
+		for k, v := range field.Constraints {
+			constraints[k] = v
+		}
+		fields = append(fields, map[string]any{
+			"name":        field.Name,
+			"type":        field.Type,
+			"description": description,
+			"constraints": constraints,
+		})
+	}
+	keywords := []string{"temperature", "humidity"}
+	if history.Loc != "" {
+		keywords = append(keywords, history.Loc)
+	}
+	descriptor := map[string]any{
+		"name":     sensorName(history.Mac),
+		"title":    feedTitle(history) + " sensor readings",
+		"id":       historyURL(r, history.Mac, ""),
+		"keywords": keywords,
+		"licenses": []map[string]string{{"name": datasetLicense()}},
+		"resources": []map[string]any{{
+			"name":      "sensor_data",
+			"path":      "sensor_data.csv",
+			"format":    "csv",
+			"mediatype": "text/csv",
+			"encoding":  "utf-8",
+			"sources":   []map[string]string{{"title": "CSV export", "path": historyURL(r, history.Mac, "csv")}},
+			"schema": map[string]any{
+				"fields":     fields,
+				"primaryKey": "timestamp",
+			},
+		}},
+	}
+	packageJSON, err := json.MarshalIndent(descriptor, "", "  ")
+	if err != nil {
+		exportError(w, err)
+		return
+	}
+
+	writeZip(w, exportFilename(history.Mac, "datapackage.zip"), []zipFile{
+		{Name: "datapackage.json", Data: packageJSON},
+		{Name: "sensor_data.csv", Data: data.Bytes()},
+	})
+}
+
+// croissantContext is the JSON-LD context of Croissant 1.0.
+var croissantContext = map[string]any{
+	"@language":     "en",
+	"@vocab":        "https://schema.org/",
+	"sc":            "https://schema.org/",
+	"cr":            "http://mlcommons.org/croissant/",
+	"dct":           "http://purl.org/dc/terms/",
+	"citeAs":        "cr:citeAs",
+	"column":        "cr:column",
+	"conformsTo":    "dct:conformsTo",
+	"data":          map[string]string{"@id": "cr:data", "@type": "@json"},
+	"dataType":      map[string]string{"@id": "cr:dataType", "@type": "@vocab"},
+	"examples":      map[string]string{"@id": "cr:examples", "@type": "@json"},
+	"extract":       "cr:extract",
+	"field":         "cr:field",
+	"fileObject":    "cr:fileObject",
+	"fileProperty":  "cr:fileProperty",
+	"fileSet":       "cr:fileSet",
+	"format":        "cr:format",
+	"includes":      "cr:includes",
+	"isLiveDataset": "cr:isLiveDataset",
+	"jsonPath":      "cr:jsonPath",
+	"key":           "cr:key",
+	"md5":           "cr:md5",
+	"parentField":   "cr:parentField",
+	"path":          "cr:path",
+	"recordSet":     "cr:recordSet",
+	"references":    "cr:references",
+	"regex":         "cr:regex",
+	"repeated":      "cr:repeated",
+	"replace":       "cr:replace",
+	"separator":     "cr:separator",
+	"source":        "cr:source",
+	"subField":      "cr:subField",
+	"transform":     "cr:transform",
+}
+
+// croissantDataTypes maps the Table Schema types of datasetFields.
+var croissantDataTypes = map[string]string{
+	"datetime": "sc:DateTime",
+	"number":   "sc:Float",
+	"integer":  "sc:Integer",
+}
+
+// exportCroissant writes Croissant metadata of the history for loading it
+// with mlcroissant: the CSV export as file object and a record set with
+// a field per column. The description of the temperature suggests its
+// standardization with the mean and standard deviation of the readings.
+func exportCroissant(w http.ResponseWriter, r *http.Request) {
+	history, ok := loadHistory(w, r)
+	if !ok {
+		return
+	}
+
+	// the checksum is of the CSV export with the same query
+	var data bytes.Buffer
+	if err := writeHistoryCSV(&data, history); err != nil {
+		exportError(w, err)
+		return
+	}
+	csvURL := historyURL(r, history.Mac, "csv")
+	if r.URL.RawQuery != "" {
+		csvURL += "?" + r.URL.RawQuery
+	}
+
+	var mean, std float64
+	for _, reading := range history.Readings {
+		mean += reading.Temp
+	}
+	if n := float64(len(history.Readings)); n > 0 {
+		mean /= n
+		for _, reading := range history.Readings {
+			std += (reading.Temp - mean) * (reading.Temp - mean)
+		}
+		std = math.Sqrt(std / n)
+	}
+
+	var fields []map[string]any
+	for _, field := range datasetFields {
+		description := field.Description
+		if field.Unit != "" {
+			description += " in " + field.Unit
+		}
+		if field.Name == "temp" {
+			description += fmt.Sprintf(", standardize as (temp - %.2f) / %.2f", mean, std)
+		}
+		source := map[string]any{
+			"fileObject": map[string]string{"@id": "sensor_data.csv"},
+			"extract":    map[string]string{"column": field.Name},
+		}
+		if field.Type == "datetime" {
+			source["transform"] = map[string]string{"format": "%Y-%m-%dT%H:%M:%SZ"}
+		}
+		fields = append(fields, map[string]any{
+			"@type":       "cr:Field",
+			"@id":         "readings/" + field.Name,
+			"name":        field.Name,
+			"description": description,
+			"dataType":    croissantDataTypes[field.Type],
+			"source":      source,
+		})
+	}
+
+	title := feedTitle(history)
+	writeJSON(w, "application/ld+json", map[string]any{
+		"@context":    croissantContext,
+		"@type":       "sc:Dataset",
+		"conformsTo":  "http://mlcommons.org/croissant/1.0",
+		"name":        sensorName(history.Mac),
+		"description": "Temperature, humidity and battery readings of the Xiaomi Mijia sensor " + history.Mac + " in " + title + ".",
+		"url":         historyURL(r, history.Mac, ""),
+		"license":     datasetLicense(),
+		"creator":     map[string]string{"@type": "sc:Organization", "name": datasetContactName()},
+		"keywords":    []string{"temperature", "humidity", "time series"},
+		"distribution": []map[string]any{{
+			"@type":          "cr:FileObject",
+			"@id":            "sensor_data.csv",
+			"name":           "sensor_data.csv",
+			"contentUrl":     csvURL,
+			"encodingFormat": "text/csv",
+			"sha256":         fmt.Sprintf("%x", sha256.Sum256(data.Bytes())),
+		}},
+		"recordSet": []map[string]any{{
+			"@type":       "cr:RecordSet",
+			"@id":         "readings",
+			"name":        "readings",
+			"description": "One record per reading of the sensor.",
+			"key":         map[string]string{"@id": "readings/timestamp"},
+			"field":       fields,
+		}},
+	})
+}
+
+// exportStac writes a STAC Item of the history, located at the position of
+// the sensor if configured. The datetime is the latest reading, the assets
+// are the downloads of datasetDistributions.
+func exportStac(w http.ResponseWriter, r *http.Request) {
+	sensor, ok := loadSensor(w, r)
+	if !ok {
+		return
+	}
+	coverage, err := loadCoverage(configMap[sensor.Mac].Db)
+	if err != nil {
+		exportError(w, err)
+		return
+	}
+
+	properties := map[string]any{
+		"datetime":   nil,
+		"title":      feedTitle(sensor) + " sensor readings",
+		"sensor_mac": sensor.Mac,
+		"sensor_loc": sensor.Loc,
+	}
+	if coverage.Count > 0 {
+		properties["datetime"] = coverage.Last.UTC().Format(time.RFC3339)
+		properties["start_datetime"] = coverage.First.UTC().Format(time.RFC3339)
+		properties["end_datetime"] = coverage.Last.UTC().Format(time.RFC3339)
+	}
+	assets := map[string]any{}
+	for _, d := range datasetDistributions {
+		key := d.Export
+		if key == "" {
+			key = "json"
+		}
+		assets[key] = map[string]any{
+			"href":  historyURL(r, sensor.Mac, d.Export),
+			"type":  d.MediaType,
+			"title": d.Title,
+			"roles": []string{"data"},
+		}
+	}
+
+	item := map[string]any{
+		"stac_version": "1.0.0",
+		"type":         "Feature",
+		"id":           sensorName(sensor.Mac),
+		"geometry":     nil,
+		"properties":   properties,
+		"assets":       assets,
+		"links": []map[string]string{
+			{"rel": "self", "href": historyURL(r, sensor.Mac, "stac"), "type": "application/geo+json"},
+			{"rel": "related", "href": serverURL(r) + "/api/sensors/" + sensor.Mac, "type": "application/json"},
+		},
+	}
+	if position, ok := sensorPosition(sensor.Mac); ok {
+		item["geometry"] = position.Geometry()
+		item["bbox"] = []float64{position.Lon, position.Lat, position.Lon, position.Lat}
+	}
+	writeJSON(w, "application/geo+json", item)
+}
@@ -0,0 +1,702 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// mongoDate is a date in MongoDB Extended JSON.
+func mongoDate(t time.Time) map[string]string {
+	return map[string]string{"$date": t.UTC().Format(time.RFC3339)}
+}
+
+// exportMongodb generates mongoimport JSON Lines keyed by {mac, timestamp}
+// so repeated imports upsert. The import command and an aggregation
+// pipeline for daily averages are sent as headers.
+func exportMongodb(w http.ResponseWriter, r *http.Request) {
+	history, ok := loadHistory(w, r)
+	if !ok {
+		return
+	}
+	filename := exportFilename(history.Mac, "jsonl")
+
+	pipeline, err := json.Marshal([]map[string]any{
+		{"$match": map[string]any{"_id.mac": history.Mac}},
+		{"$group": map[string]any{
+			"_id":          map[string]any{"$dateTrunc": map[string]string{"date": "$_id.timestamp", "unit": "day"}},
+			"avg_temp":     map[string]string{"$avg": "$temp"},
+			"min_temp":     map[string]string{"$min": "$temp"},
+			"max_temp":     map[string]string{"$max": "$temp"},
+			"avg_humidity": map[string]string{"$avg": "$humidity"},
+			"readings":     map[string]int{"$sum": 1},
+		}},
+		{"$sort": map[string]int{"_id": 1}},
+	})
+	if err != nil {
+		exportError(w, err)
+		return
+	}
+
+	w.Header().Set("X-Import-Command", fmt.Sprintf(
+		"mongoimport --uri mongodb://localhost:27017/mijia --collection sensor_data --mode upsert --upsertFields _id --file %s",
+		filename,
+	))
+	w.Header().Set("X-Aggregation-Pipeline", string(pipeline))
+	setAttachment(w, "application/x-ndjson", filename)
+
+	encoder := json.NewEncoder(w)
+	for _, reading := range history.Readings {
+		if err := encoder.Encode(map[string]any{
+			"_id": map[string]any{
+				"mac":       history.Mac,
+				"timestamp": mongoDate(reading.Timestamp),
+			},
+			"loc":           history.Loc,
+			"temp":          reading.Temp,
+			"humidity":      reading.Humidity,
+			"battery_mv":    reading.BatteryMV,
+			"battery_level": reading.BatteryLevel,
+		}); err != nil {
+			log.Printf("%v", err)
+			return
+		}
+	}
+}
+
+// couchdbBulkDocs groups the readings into _bulk_docs request bodies of
+// 500 documents each.
+func couchdbBulkDocs(history *SensorHistory) []map[string]any {
+	var bodies []map[string]any
+	for _, batch := range batchReadings(history.Readings, 500) {
+		var docs []map[string]any
+		for _, reading := range batch {
+			timestamp := reading.Timestamp.Format(time.RFC3339)
+			docs = append(docs, map[string]any{
+				"_id":           history.Mac + "-" + timestamp,
+				"mac":           history.Mac,
+				"loc":           history.Loc,
+				"temp":          reading.Temp,
+				"humidity":      reading.Humidity,
+				"battery_mv":    reading.BatteryMV,
+				"battery_level": reading.BatteryLevel,
+				"timestamp":     timestamp,
+			})
+		}
+		bodies = append(bodies, map[string]any{"docs": docs})
+	}
+	return bodies
+}
+
+// exportCouchdb generates CouchDB _bulk_docs bodies, one batch per line.
+// With push=true the batches are posted to the couchdb_url of the sensor.
+func exportCouchdb(w http.ResponseWriter, r *http.Request) {
+	history, ok := loadHistory(w, r)
+	if !ok {
+		return
+	}
+	bodies := couchdbBulkDocs(history)
+
+	if r.URL.Query().Get("push") != "true" {
+		setAttachment(w, "application/x-ndjson", exportFilename(history.Mac, "couchdb.jsonl"))
+		encoder := json.NewEncoder(w)
+		for _, body := range bodies {
+			if err := encoder.Encode(body); err != nil {
+				log.Printf("%v", err)
+				return
+			}
+		}
+		return
+	}
+
+	config := configMap[history.Mac]
+	if config.CouchdbURL == "" {
+		http.Error(w, "couchdb_url is not configured for this sensor", http.StatusBadRequest)
+		return
+	}
+	pushed, conflicts, failed := 0, 0, 0
+	var firstError string
+	for i, body := range bodies {
+		data, err := json.Marshal(body)
+		if err != nil {
+			exportError(w, err)
+			return
+		}
+		req, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(config.CouchdbURL, "/")+"/_bulk_docs", bytes.NewReader(data))
+		if err != nil {
+			exportError(w, err)
+			return
+		}
+		req.Header.Set("Content-Type", "application/json")
+		if config.CouchdbUser != "" {
+			req.SetBasicAuth(config.CouchdbUser, config.CouchdbPassword)
+		}
+
+		var results []struct {
+			ID     string `json:"id"`
+			Error  string `json:"error"`
+			Reason string `json:"reason"`
+		}
+		if err := pushRequest(req, &results); err != nil {
+			pushError(w, err)
+			return
+		}
+		// documents rejected for other reasons than a conflict, e.g. forbidden
+		// by a validate_doc_update function
+		rejected := 0
+		for _, result := range results {
+			switch result.Error {
+			case "":
+				pushed++
+			case "conflict":
+				// already imported before
+				conflicts++
+			default:
+				rejected++
+				if firstError == "" {
+					firstError = fmt.Sprintf("%s: %s: %s", result.ID, result.Error, result.Reason)
+				}
+			}
+		}
+		failed += rejected
+		if rejected > 0 && rejected == len(results) {
+			pushError(w, fmt.Errorf("all %d documents of batch %d were rejected, %s", rejected, i+1, firstError))
+			return
+		}
+	}
+
+	response := map[string]any{
+		"batches":   len(bodies),
+		"pushed":    pushed,
+		"conflicts": conflicts,
+		"failed":    failed,
+	}
+	if firstError != "" {
+		response["error"] = firstError
+	}
+	writeJSON(w, "application/json", response)
+}
+
+// redisStreamID is the stream entry ID of a reading, so repeated imports
+// are rejected by Redis instead of duplicated.
+func redisStreamID(reading SensorReading) string {
+	return fmt.Sprintf("%d-0", reading.Timestamp.UnixMilli())
+}
+
+// exportRedis generates redis-cli commands adding the readings to the
+// stream sensors:<mac> with a consumer group. With push=true the commands
+// are executed against the redis_url of the sensor.
+func exportRedis(w http.ResponseWriter, r *http.Request) {
+	history, ok := loadHistory(w, r)
+	if !ok {
+		return
+	}
+	stream := "sensors:" + history.Mac
+	const group = "mijia"
+
+	if r.URL.Query().Get("push") != "true" {
+		setAttachment(w, "text/plain", exportFilename(history.Mac, "redis"))
+		fmt.Fprintf(w, "XGROUP CREATE %s %s 0 MKSTREAM\n", stream, group)
+		for _, reading := range history.Readings {
+			fmt.Fprintf(w, "XADD %s %s temp %v humidity %v battery_mv %d battery_level %d\n",
+				stream, redisStreamID(reading), reading.Temp, reading.Humidity, reading.BatteryMV, reading.BatteryLevel)
+		}
+		return
+	}
+
+	config := configMap[history.Mac]
+	if config.RedisURL == "" {
+		http.Error(w, "redis_url is not configured for this sensor", http.StatusBadRequest)
+		return
+	}
+	options, err := redis.ParseURL(config.RedisURL)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid redis_url: %v", err), http.StatusInternalServerError)
+		return
+	}
+	client := redis.NewClient(options)
+	defer client.Close()
+	ctx := r.Context()
+
+	err = client.XGroupCreateMkStream(ctx, stream, group, "0").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		pushError(w, err)
+		return
+	}
+
+	pushed, skipped := 0, 0
+	for _, batch := range batchReadings(history.Readings, 1000) {
+		pipe := client.Pipeline()
+		for _, reading := range batch {
+			pipe.XAdd(ctx, &redis.XAddArgs{
+				Stream: stream,
+				ID:     redisStreamID(reading),
+				Values: []any{
+					"temp", reading.Temp,
+					"humidity", reading.Humidity,
+					"battery_mv", reading.BatteryMV,
+					"battery_level", reading.BatteryLevel,
+				},
+			})
+		}
+		cmds, _ := pipe.Exec(ctx)
+		for _, cmd := range cmds {
+			if err := cmd.Err(); err == nil {
+				pushed++
+			} else if strings.Contains(err.Error(), "equal or smaller") {
+				// already in the stream
+				skipped++
+			} else {
+				pushError(w, err)
+				return
+			}
+		}
+	}
+
+	writeJSON(w, "application/json", map[string]int{
+		"pushed":  pushed,
+		"skipped": skipped,
+	})
+}
+
+const cassandraKeyspaceDDL = "CREATE KEYSPACE IF NOT EXISTS mijia WITH replication = {'class': 'SimpleStrategy', 'replication_factor': 1};"
+
+const cassandraTableDDL = "CREATE TABLE IF NOT EXISTS mijia.sensor_data (mac text, timestamp timestamp, temp float, humidity float, battery_mv smallint, battery_level tinyint, PRIMARY KEY (mac, timestamp))"
+
+// writeCassandraCSV writes the readings as CSV for cqlsh:
+// COPY mijia.sensor_data (mac, timestamp, ...) FROM STDIN WITH HEADER=true
+func writeCassandraCSV(w io.Writer, history *SensorHistory) {
+	out := csv.NewWriter(w)
+	out.Write([]string{"mac", "timestamp", "temp", "humidity", "battery_mv", "battery_level"})
+	for _, reading := range history.Readings {
+		out.Write([]string{
+			history.Mac,
+			reading.Timestamp.Format("2006-01-02 15:04:05-0700"),
+			strconv.FormatFloat(reading.Temp, 'f', -1, 64),
+			strconv.FormatFloat(reading.Humidity, 'f', -1, 64),
+			strconv.Itoa(int(reading.BatteryMV)),
+			strconv.Itoa(int(reading.BatteryLevel)),
+		})
+	}
+	out.Flush()
+	if err := out.Error(); err != nil {
+		log.Printf("%v", err)
+	}
+}
+
+// exportCassandra generates CSV for cqlsh COPY FROM STDIN, the keyspace
+// and table DDL is sent in the X-Cassandra-DDL header.
+func exportCassandra(w http.ResponseWriter, r *http.Request) {
+	history, ok := loadHistory(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("X-Cassandra-DDL", cassandraKeyspaceDDL+" "+cassandraTableDDL+";")
+	setAttachment(w, "text/csv", exportFilename(history.Mac, "cassandra.csv"))
+	writeCassandraCSV(w, history)
+}
+
+// exportScylla is the Cassandra export with ScyllaDB specific DDL: time
+// window compaction suits the append only readings. Enabling CDC, a query
+// bypassing the cache for full scans and the compaction to run after the
+// import are sent as additional headers.
+func exportScylla(w http.ResponseWriter, r *http.Request) {
+	history, ok := loadHistory(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("X-Cassandra-DDL", cassandraKeyspaceDDL+" "+cassandraTableDDL+
+		" WITH compaction = {'class': 'TimeWindowCompactionStrategy', 'compaction_window_unit': 'DAYS', 'compaction_window_size': 1};")
+	w.Header().Set("X-Scylla-CDC-DDL",
+		"ALTER TABLE mijia.sensor_data WITH cdc = {'enabled': true, 'preimage': false, 'postimage': false, 'ttl': 86400};")
+	w.Header().Set("X-Scylla-Query",
+		fmt.Sprintf("SELECT * FROM mijia.sensor_data WHERE mac = %s BYPASS CACHE;", sqlQuote(history.Mac)))
+	w.Header().Set("X-Scylla-Maintenance", "nodetool compact mijia sensor_data")
+	setAttachment(w, "text/csv", exportFilename(history.Mac, "scylla.csv"))
+	writeCassandraCSV(w, history)
+}
+
+// dynamodbNumber is a DynamoDB number attribute, numbers are sent as strings.
+func dynamodbNumber(value any) map[string]string {
+	return map[string]string{"N": fmt.Sprint(value)}
+}
+
+// dynamodbRequestItems groups the readings into BatchWriteItem RequestItems
+// of 25 PutRequests each, the limit of a single call.
+func dynamodbRequestItems(history *SensorHistory) []map[string][]any {
+	var batches []map[string][]any
+	for _, batch := range batchReadings(history.Readings, 25) {
+		var requests []any
+		for _, reading := range batch {
+			requests = append(requests, map[string]any{
+				"PutRequest": map[string]any{
+					"Item": map[string]any{
+						"mac":           map[string]string{"S": history.Mac},
+						"timestamp":     map[string]string{"S": reading.Timestamp.Format(time.RFC3339)},
+						"loc":           map[string]string{"S": history.Loc},
+						"temp":          dynamodbNumber(reading.Temp),
+						"humidity":      dynamodbNumber(reading.Humidity),
+						"battery_mv":    dynamodbNumber(reading.BatteryMV),
+						"battery_level": dynamodbNumber(reading.BatteryLevel),
+					},
+				},
+			})
+		}
+		batches = append(batches, map[string][]any{"sensor_data": requests})
+	}
+	return batches
+}
+
+// exportDynamodb generates BatchWriteItem request bodies for the table
+// sensor_data (partition key mac, sort key timestamp), one batch per line.
+// With push=true every batch is written with the aws CLI in the
+// dynamodb_region of the sensor, unprocessed items are retried.
+func exportDynamodb(w http.ResponseWriter, r *http.Request) {
+	history, ok := loadHistory(w, r)
+	if !ok {
+		return
+	}
+	batches := dynamodbRequestItems(history)
+
+	if r.URL.Query().Get("push") != "true" {
+		w.Header().Set("X-Import-Command", "aws dynamodb batch-write-item --cli-input-json file://<line>")
+		setAttachment(w, "application/x-ndjson", exportFilename(history.Mac, "dynamodb.jsonl"))
+		encoder := json.NewEncoder(w)
+		for _, batch := range batches {
+			if err := encoder.Encode(map[string]any{"RequestItems": batch}); err != nil {
+				log.Printf("%v", err)
+				return
+			}
+		}
+		return
+	}
+
+	config := configMap[history.Mac]
+	if config.DynamodbRegion == "" {
+		http.Error(w, "dynamodb_region is not configured for this sensor", http.StatusBadRequest)
+		return
+	}
+	pushed, unprocessed := 0, 0
+	for _, batch := range batches {
+		items := batch
+		for attempt := 0; attempt < 3 && len(items["sensor_data"]) > 0; attempt++ {
+			data, err := json.Marshal(items)
+			if err != nil {
+				exportError(w, err)
+				return
+			}
+			cmd := exec.CommandContext(r.Context(), "aws", "dynamodb", "batch-write-item",
+				"--region", config.DynamodbRegion, "--output", "json", "--request-items", string(data))
+			output, err := cmd.Output()
+			if err != nil {
+				if exitErr, ok := err.(*exec.ExitError); ok {
+					err = fmt.Errorf("aws dynamodb batch-write-item: %s", bytes.TrimSpace(exitErr.Stderr))
+				}
+				pushError(w, err)
+				return
+			}
+			var result struct {
+				UnprocessedItems map[string][]any
+			}
+			if err := json.Unmarshal(output, &result); err != nil {
+				pushError(w, err)
+				return
+			}
+			pushed += len(items["sensor_data"]) - len(result.UnprocessedItems["sensor_data"])
+			items = result.UnprocessedItems
+			if len(items["sensor_data"]) > 0 {
+				time.Sleep(time.Duration(attempt+1) * 200 * time.Millisecond)
+			}
+		}
+		unprocessed += len(items["sensor_data"])
+	}
+
+	writeJSON(w, "application/json", map[string]int{
+		"batches":     len(batches),
+		"pushed":      pushed,
+		"unprocessed": unprocessed,
+	})
+}
+
+// exportFirestore generates a Go program writing the readings to the
+// Firestore collection sensors/<mac>/readings with a BulkWriter.
+func exportFirestore(w http.ResponseWriter, r *http.Request) {
+	history, ok := loadHistory(w, r)
+	if !ok {
+		return
+	}
+
+	source, err := renderExportTemplate("firestore_import.go.tmpl", newExportContext(r, history))
+	if err != nil {
+		exportError(w, err)
+		return
+	}
+
+	setAttachment(w, "text/x-go", "firestore_import.go")
+	w.Write(source)
+}
+
+// cosmosDocuments groups the readings into arrays of 100 Cosmos DB
+// documents with the id <mac>-<timestamp>, partitioned by mac.
+func cosmosDocuments(history *SensorHistory) [][]map[string]any {
+	var batches [][]map[string]any
+	for _, batch := range batchReadings(history.Readings, 100) {
+		var docs []map[string]any
+		for _, reading := range batch {
+			timestamp := reading.Timestamp.Format(time.RFC3339)
+			docs = append(docs, map[string]any{
+				"id":            history.Mac + "-" + timestamp,
+				"mac":           history.Mac,
+				"loc":           history.Loc,
+				"timestamp":     timestamp,
+				"temp":          reading.Temp,
+				"humidity":      reading.Humidity,
+				"battery_mv":    reading.BatteryMV,
+				"battery_level": reading.BatteryLevel,
+			})
+		}
+		batches = append(batches, docs)
+	}
+	return batches
+}
+
+// exportCosmos generates the readings as Cosmos DB documents in files of
+// 100, settings for the Data Migration Tool (dmt) upserting them into the
+// container mijia/sensor_data, and an Azure Data Factory pipeline with an
+// hourly tumbling window trigger copying new readings from the JSON API.
+func exportCosmos(w http.ResponseWriter, r *http.Request) {
+	history, ok := loadHistory(w, r)
+	if !ok {
+		return
+	}
+	ctx := newExportContext(r, history)
+
+	var files []zipFile
+	for i, docs := range cosmosDocuments(history) {
+		data, err := json.MarshalIndent(docs, "", "  ")
+		if err != nil {
+			exportError(w, err)
+			return
+		}
+		files = append(files, zipFile{Name: fmt.Sprintf("sensor_data/batch_%03d.json", i+1), Data: data})
+	}
+
+	pipeline := ctx.Name + "_to_cosmos"
+	start := time.Now().UTC().Truncate(time.Hour)
+	if len(history.Readings) > 0 {
+		start = history.Readings[0].Timestamp.UTC().Truncate(time.Hour)
+	}
+	// the JSON API returns the readings only, mac and loc are added as
+	// additional columns of the source
+	mappings := []map[string]any{
+		{"source": map[string]string{"name": "mac"}, "sink": map[string]string{"path": "$['mac']"}},
+		{"source": map[string]string{"name": "loc"}, "sink": map[string]string{"path": "$['loc']"}},
+	}
+	for _, field := range []string{"timestamp", "temp", "humidity", "battery_mv", "battery_level"} {
+		mappings = append(mappings, map[string]any{
+			"source": map[string]string{"path": "['" + field + "']"},
+			"sink":   map[string]string{"path": "$['" + field + "']"},
+		})
+	}
+	configs := []struct {
+		name  string
+		value any
+	}{
+		{"migrationsettings.json", map[string]any{
+			"Source": "json",
+			"Sink":   "cosmos-nosql",
+			"SourceSettings": map[string]any{
+				"FilePath": "sensor_data",
+			},
+			"SinkSettings": map[string]any{
+				"ConnectionString":              "AccountEndpoint=https://<account>.documents.azure.com:443/;AccountKey=<key>;",
+				"Database":                      "mijia",
+				"Container":                     "sensor_data",
+				"PartitionKeyPath":              "/mac",
+				"RecreateContainer":             false,
+				"WriteMode":                     "Upsert",
+				"CreatedContainerMaxThroughput": 1000,
+				"IncludeMetadataFields":         false,
+			},
+		}},
+		{"adf/linkedService_MijiaServer.json", map[string]any{
+			"name": "MijiaServer",
+			"properties": map[string]any{
+				"type": "HttpServer",
+				"typeProperties": map[string]any{
+					"url":                               ctx.ServerURL,
+					"authenticationType":                "Anonymous",
+					"enableServerCertificateValidation": true,
+				},
+			},
+		}},
+		{"adf/linkedService_CosmosDb.json", map[string]any{
+			"name": "CosmosDb",
+			"properties": map[string]any{
+				"type": "CosmosDb",
+				"typeProperties": map[string]any{
+					"connectionString": "AccountEndpoint=https://<account>.documents.azure.com:443/;AccountKey=<key>;Database=mijia",
+				},
+			},
+		}},
+		{"adf/dataset_MijiaHistory.json", map[string]any{
+			"name": "MijiaHistory",
+			"properties": map[string]any{
+				"type":              "Json",
+				"linkedServiceName": map[string]string{"referenceName": "MijiaServer", "type": "LinkedServiceReference"},
+				"parameters": map[string]any{
+					"from": map[string]string{"type": "string"},
+					"to":   map[string]string{"type": "string"},
+				},
+				"typeProperties": map[string]any{
+					"location": map[string]any{
+						"type": "HttpServerLocation",
+						"relativeUrl": map[string]string{
+							"value": fmt.Sprintf("@concat('/api/sensors/%s/history?from=', dataset().from, '&to=', dataset().to)", history.Mac),
+							"type":  "Expression",
+						},
+					},
+				},
+			},
+		}},
+		{"adf/dataset_CosmosSensorData.json", map[string]any{
+			"name": "CosmosSensorData",
+			"properties": map[string]any{
+				"type":              "CosmosDbSqlApiCollection",
+				"linkedServiceName": map[string]string{"referenceName": "CosmosDb", "type": "LinkedServiceReference"},
+				"typeProperties":    map[string]string{"collectionName": "sensor_data"},
+			},
+		}},
+		{"adf/pipeline.json", map[string]any{
+			"name": pipeline,
+			"properties": map[string]any{
+				"parameters": map[string]any{
+					"from": map[string]string{"type": "string"},
+					"to":   map[string]string{"type": "string"},
+				},
+				"activities": []map[string]any{
+					{
+						"name": "CopyReadings",
+						"type": "Copy",
+						"inputs": []map[string]any{
+							{
+								"referenceName": "MijiaHistory",
+								"type":          "DatasetReference",
+								"parameters": map[string]string{
+									"from": "@pipeline().parameters.from",
+									"to":   "@pipeline().parameters.to",
+								},
+							},
+						},
+						"outputs": []map[string]any{
+							{"referenceName": "CosmosSensorData", "type": "DatasetReference"},
+						},
+						"typeProperties": map[string]any{
+							"source": map[string]any{
+								"type":          "JsonSource",
+								"storeSettings": map[string]string{"type": "HttpReadSettings", "requestMethod": "GET"},
+								"additionalColumns": []map[string]string{
+									{"name": "mac", "value": history.Mac},
+									{"name": "loc", "value": history.Loc},
+								},
+							},
+							"sink": map[string]any{
+								"type":          "CosmosDbSqlApiSink",
+								"writeBehavior": "upsert",
+							},
+							"translator": map[string]any{
+								"type":                "TabularTranslator",
+								"collectionReference": "$",
+								"mappings":            mappings,
+							},
+						},
+					},
+				},
+			},
+		}},
+		{"adf/trigger.json", map[string]any{
+			"name": pipeline + "_hourly",
+			"properties": map[string]any{
+				"type": "TumblingWindowTrigger",
+				"typeProperties": map[string]any{
+					"frequency":      "Hour",
+					"interval":       1,
+					"startTime":      start.Format(time.RFC3339),
+					"maxConcurrency": 1,
+				},
+				"pipeline": map[string]any{
+					"pipelineReference": map[string]string{"referenceName": pipeline, "type": "PipelineReference"},
+					// the history range is inclusive, end the window a second earlier
+					"parameters": map[string]string{
+						"from": "@formatDateTime(trigger().outputs.windowStartTime, 'yyyy-MM-ddTHH:mm:ssZ')",
+						"to":   "@formatDateTime(addSeconds(trigger().outputs.windowEndTime, -1), 'yyyy-MM-ddTHH:mm:ssZ')",
+					},
+				},
+			},
+		}},
+	}
+	for _, config := range configs {
+		data, err := json.MarshalIndent(config.value, "", "  ")
+		if err != nil {
+			exportError(w, err)
+			return
+		}
+		files = append(files, zipFile{Name: config.name, Data: data})
+	}
+
+	writeZip(w, exportFilename(history.Mac, "cosmos.zip"), files)
+}
+
+// exportFauna generates the Fauna schema, FQL queries creating 50
+// readings per transaction and a script running them with the Fauna CLI.
+func exportFauna(w http.ResponseWriter, r *http.Request) {
+	history, ok := loadHistory(w, r)
+	if !ok {
+		return
+	}
+	ctx := newExportContext(r, history)
+
+	files, err := renderExportFiles(ctx, [][2]string{
+		{"fauna.fsl", "fauna.fsl"},
+		{"fauna_import.sh", "fauna_import.sh"},
+	})
+	if err != nil {
+		exportError(w, err)
+		return
+	}
+
+	tmpl, err := parseExportTemplate("fauna_batch.fql")
+	if err != nil {
+		exportError(w, err)
+		return
+	}
+	batches := batchReadings(history.Readings, 50)
+	// the import script runs batches/*.fql in lexical order
+	width := max(3, len(strconv.Itoa(len(batches))))
+	for i, batch := range batches {
+		query, err := executeExportTemplate(tmpl, struct {
+			exportContext
+			Number int
+			Batch  []SensorReading
+		}{ctx, i + 1, batch})
+		if err != nil {
+			exportError(w, err)
+			return
+		}
+		files = append(files, zipFile{Name: fmt.Sprintf("batches/%0*d.fql", width, i+1), Data: query})
+	}
+
+	writeZip(w, exportFilename(history.Mac, "fauna.zip"), files)
+}
@@ -0,0 +1,644 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// exportMode generates a Mode Analytics report definition with a Python
+// notebook that reads the JSON history API.
+func exportMode(w http.ResponseWriter, r *http.Request) {
+	history, ok := loadSensor(w, r)
+	if !ok {
+		return
+	}
+	ctx := newExportContext(r, history)
+
+	notebook, err := renderExportTemplate("mode_notebook.py", ctx)
+	if err != nil {
+		exportError(w, err)
+		return
+	}
+
+	report := map[string]any{
+		"name":        "Mijia " + history.Loc,
+		"description": "Temperature and humidity history of " + history.Mac,
+		"datasets": []map[string]any{
+			{
+				"name":   "sensor_history",
+				"source": "python",
+				"url":    ctx.HistoryURL,
+				"format": "json",
+			},
+		},
+		"notebook": map[string]any{
+			"language": "python",
+			"cells": []map[string]any{
+				{
+					"cell_type": "code",
+					"source":    string(notebook),
+				},
+			},
+		},
+	}
+	reportJSON, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		exportError(w, err)
+		return
+	}
+
+	writeZip(w, exportFilename(history.Mac, "mode.zip"), []zipFile{
+		{Name: "report.json", Data: reportJSON},
+		{Name: "notebook.py", Data: notebook},
+	})
+}
+
+// exportDbt generates a dbt source definition for the sensor's SQLite
+// database and a model computing daily averages.
+func exportDbt(w http.ResponseWriter, r *http.Request) {
+	history, ok := loadSensor(w, r)
+	if !ok {
+		return
+	}
+
+	files, err := renderExportFiles(newExportContext(r, history), [][2]string{
+		{"dbt_source.yml", "models/source.yml"},
+		{"dbt_sensor_summary.sql", "models/sensor_summary.sql"},
+	})
+	if err != nil {
+		exportError(w, err)
+		return
+	}
+
+	writeZip(w, exportFilename(history.Mac, "dbt.zip"), files)
+}
+
+// exportAirbyte generates a low-code Airbyte connector manifest for a
+// custom HTTP source reading the paginated JSON history API.
+func exportAirbyte(w http.ResponseWriter, r *http.Request) {
+	history, ok := loadSensor(w, r)
+	if !ok {
+		return
+	}
+	ctx := newExportContext(r, history)
+
+	stream := map[string]any{
+		"type":        "DeclarativeStream",
+		"name":        ctx.Name,
+		"primary_key": []string{"timestamp"},
+		"schema_loader": map[string]any{
+			"type":   "InlineSchemaLoader",
+			"schema": sensorReadingSchema(),
+		},
+		"retriever": map[string]any{
+			"type": "SimpleRetriever",
+			"requester": map[string]any{
+				"type":        "HttpRequester",
+				"url_base":    ctx.ServerURL,
+				"path":        "/api/sensors/" + history.Mac + "/history",
+				"http_method": "GET",
+				"request_parameters": map[string]string{
+					"from": "{{ config.get('from', '') }}",
+					"to":   "{{ config.get('to', '') }}",
+				},
+			},
+			"record_selector": map[string]any{
+				"type": "RecordSelector",
+				"extractor": map[string]any{
+					"type":       "DpathExtractor",
+					"field_path": []string{},
+				},
+			},
+			"paginator": map[string]any{
+				"type": "DefaultPaginator",
+				"page_size_option": map[string]any{
+					"type":        "RequestOption",
+					"inject_into": "request_parameter",
+					"field_name":  "page_size",
+				},
+				"page_token_option": map[string]any{
+					"type":        "RequestOption",
+					"inject_into": "request_parameter",
+					"field_name":  "page",
+				},
+				"pagination_strategy": map[string]any{
+					"type":            "PageIncrement",
+					"page_size":       "{{ config.get('page_size', 1000) }}",
+					"start_from_page": 1,
+				},
+			},
+		},
+	}
+
+	manifest := map[string]any{
+		"version": "0.79.0",
+		"type":    "DeclarativeSource",
+		"check": map[string]any{
+			"type":         "CheckStream",
+			"stream_names": []string{ctx.Name},
+		},
+		"streams": []any{stream},
+		"spec": map[string]any{
+			"type": "Spec",
+			"connection_specification": map[string]any{
+				"$schema":  "http://json-schema.org/draft-07/schema#",
+				"title":    "Mijia " + history.Loc,
+				"type":     "object",
+				"required": []string{},
+				"properties": map[string]any{
+					"from": map[string]any{
+						"type":        "string",
+						"format":      "date-time",
+						"title":       "From",
+						"description": "Only sync readings after this RFC3339 timestamp",
+						"order":       0,
+					},
+					"to": map[string]any{
+						"type":        "string",
+						"format":      "date-time",
+						"title":       "To",
+						"description": "Only sync readings before this RFC3339 timestamp",
+						"order":       1,
+					},
+					"page_size": map[string]any{
+						"type":        "integer",
+						"title":       "Page size",
+						"description": "Number of readings per request",
+						"default":     1000,
+						"minimum":     1,
+						"order":       2,
+					},
+				},
+			},
+		},
+	}
+
+	setAttachment(w, "application/json", exportFilename(history.Mac, "airbyte.json"))
+	writeJSON(w, "application/json", manifest)
+}
+
+// exportFivetran generates a Fivetran function deployment with the
+// Python function code as base64 encoded zip. The function syncs
+// incrementally using the timestamp as cursor.
+func exportFivetran(w http.ResponseWriter, r *http.Request) {
+	history, ok := loadSensor(w, r)
+	if !ok {
+		return
+	}
+	ctx := newExportContext(r, history)
+
+	files, err := renderExportFiles(ctx, [][2]string{{"fivetran_main.py", "main.py"}})
+	if err != nil {
+		exportError(w, err)
+		return
+	}
+	code, err := buildZip(files)
+	if err != nil {
+		exportError(w, err)
+		return
+	}
+
+	function := map[string]any{
+		"name":         ctx.Name,
+		"description":  "Mijia sensor " + history.Loc + " (" + history.Mac + ")",
+		"runtime":      "python3.12",
+		"handler":      "main.lambda_handler",
+		"cursor_field": "timestamp",
+		"secrets":      map[string]string{},
+		"schema": map[string]any{
+			ctx.Name: map[string]any{
+				"primary_key": []string{"timestamp"},
+				"columns": map[string]string{
+					"timestamp":     "UTC_DATETIME",
+					"temp":          "DOUBLE",
+					"humidity":      "DOUBLE",
+					"battery_mv":    "SHORT",
+					"battery_level": "SHORT",
+				},
+			},
+		},
+		"code": map[string]string{
+			"encoding": "base64",
+			"format":   "zip",
+			"data":     base64.StdEncoding.EncodeToString(code),
+		},
+	}
+
+	setAttachment(w, "application/json", exportFilename(history.Mac, "fivetran.json"))
+	writeJSON(w, "application/json", function)
+}
+
+// exportStitch generates the output of a Singer tap (SCHEMA, RECORD and
+// STATE messages) together with the catalog and a config template, for
+// Stitch or any Singer target. Replication is incremental on timestamp,
+// the bookmark of the STATE message can be passed back as from parameter.
+func exportStitch(w http.ResponseWriter, r *http.Request) {
+	history, ok := loadHistory(w, r)
+	if !ok {
+		return
+	}
+	ctx := newExportContext(r, history)
+	schema := sensorReadingSchema()
+
+	var messages bytes.Buffer
+	encoder := json.NewEncoder(&messages)
+	extracted := time.Now().UTC().Format(time.RFC3339)
+	bookmark := r.URL.Query().Get("from")
+	writeState := func() error {
+		return encoder.Encode(map[string]any{
+			"type": "STATE",
+			"value": map[string]any{
+				"bookmarks": map[string]any{
+					ctx.Name: map[string]string{
+						"replication_key":       "timestamp",
+						"replication_key_value": bookmark,
+					},
+				},
+			},
+		})
+	}
+
+	if err := encoder.Encode(map[string]any{
+		"type":                "SCHEMA",
+		"stream":              ctx.Name,
+		"schema":              schema,
+		"key_properties":      []string{"timestamp"},
+		"bookmark_properties": []string{"timestamp"},
+	}); err != nil {
+		exportError(w, err)
+		return
+	}
+	for i, reading := range history.Readings {
+		if err := encoder.Encode(map[string]any{
+			"type":           "RECORD",
+			"stream":         ctx.Name,
+			"record":         reading,
+			"time_extracted": extracted,
+		}); err != nil {
+			exportError(w, err)
+			return
+		}
+		bookmark = reading.Timestamp.Format(time.RFC3339)
+		// emit a bookmark regularly so interrupted loads can resume
+		if (i+1)%1000 == 0 {
+			if err := writeState(); err != nil {
+				exportError(w, err)
+				return
+			}
+		}
+	}
+	if err := writeState(); err != nil {
+		exportError(w, err)
+		return
+	}
+
+	metadata := []map[string]any{
+		{
+			"breadcrumb": []string{},
+			"metadata": map[string]any{
+				"selected":             true,
+				"replication-method":   "INCREMENTAL",
+				"replication-key":      "timestamp",
+				"table-key-properties": []string{"timestamp"},
+			},
+		},
+	}
+	for _, property := range []string{"timestamp", "temp", "humidity", "battery_mv", "battery_level"} {
+		inclusion := "available"
+		if property == "timestamp" {
+			inclusion = "automatic"
+		}
+		metadata = append(metadata, map[string]any{
+			"breadcrumb": []string{"properties", property},
+			"metadata":   map[string]any{"inclusion": inclusion},
+		})
+	}
+	catalog, err := json.MarshalIndent(map[string]any{
+		"streams": []map[string]any{
+			{
+				"tap_stream_id":      ctx.Name,
+				"stream":             ctx.Name,
+				"key_properties":     []string{"timestamp"},
+				"replication_key":    "timestamp",
+				"replication_method": "INCREMENTAL",
+				"schema":             schema,
+				"metadata":           metadata,
+			},
+		},
+	}, "", "  ")
+	if err != nil {
+		exportError(w, err)
+		return
+	}
+
+	config, err := json.MarshalIndent(map[string]string{
+		"history_url": ctx.HistoryURL,
+		"start_date":  r.URL.Query().Get("from"),
+	}, "", "  ")
+	if err != nil {
+		exportError(w, err)
+		return
+	}
+
+	writeZip(w, exportFilename(history.Mac, "singer.zip"), []zipFile{
+		{Name: "messages.jsonl", Data: messages.Bytes()},
+		{Name: "catalog.json", Data: catalog},
+		{Name: "config.json", Data: config},
+	})
+}
+
+// sensorReadingAvroSchema is the Avro record schema of a SensorReading.
+func sensorReadingAvroSchema() map[string]any {
+	return map[string]any{
+		"type":      "record",
+		"name":      "SensorReading",
+		"namespace": "mijia",
+		"fields": []map[string]any{
+			{"name": "timestamp", "type": map[string]string{"type": "long", "logicalType": "timestamp-millis"}},
+			{"name": "temp", "type": "double"},
+			{"name": "humidity", "type": "double"},
+			{"name": "battery_mv", "type": "int"},
+			{"name": "battery_level", "type": "int"},
+		},
+	}
+}
+
+// newUUID returns a random version 4 UUID.
+func newUUID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// exportNifi generates a NiFi Registry flow snapshot with the processors
+// GetHTTP -> ConvertRecord -> PutDatabaseRecord, loading the JSON history
+// into a sensor_data table of the configured database.
+func exportNifi(w http.ResponseWriter, r *http.Request) {
+	history, ok := loadSensor(w, r)
+	if !ok {
+		return
+	}
+	ctx := newExportContext(r, history)
+
+	avroSchema, err := json.Marshal(sensorReadingAvroSchema())
+	if err != nil {
+		exportError(w, err)
+		return
+	}
+
+	groupID := newUUID()
+	const nifiVersion = "1.25.0"
+	bundle := func(artifact string) map[string]string {
+		return map[string]string{"group": "org.apache.nifi", "artifact": artifact, "version": nifiVersion}
+	}
+	service := func(id string, name string, typ string, artifact string, properties map[string]string) map[string]any {
+		return map[string]any{
+			"identifier":      id,
+			"groupIdentifier": groupID,
+			"name":            name,
+			"type":            typ,
+			"bundle":          bundle(artifact),
+			"properties":      properties,
+			"componentType":   "CONTROLLER_SERVICE",
+		}
+	}
+	processor := func(id string, name string, typ string, y int, period string, properties map[string]string, comments string, terminated []string) map[string]any {
+		return map[string]any{
+			"identifier":                       id,
+			"groupIdentifier":                  groupID,
+			"name":                             name,
+			"type":                             typ,
+			"bundle":                           bundle("nifi-standard-nar"),
+			"properties":                       properties,
+			"comments":                         comments,
+			"schedulingStrategy":               "TIMER_DRIVEN",
+			"schedulingPeriod":                 period,
+			"concurrentlySchedulableTaskCount": 1,
+			"autoTerminatedRelationships":      terminated,
+			"position":                         map[string]int{"x": 0, "y": y},
+			"componentType":                    "PROCESSOR",
+		}
+	}
+	connection := func(source map[string]any, destination map[string]any, relationship string) map[string]any {
+		endpoint := func(p map[string]any) map[string]any {
+			return map[string]any{"id": p["identifier"], "groupId": groupID, "name": p["name"], "type": "PROCESSOR"}
+		}
+		return map[string]any{
+			"identifier":                    newUUID(),
+			"groupIdentifier":               groupID,
+			"source":                        endpoint(source),
+			"destination":                   endpoint(destination),
+			"selectedRelationships":         []string{relationship},
+			"backPressureObjectThreshold":   10000,
+			"backPressureDataSizeThreshold": "1 GB",
+			"flowFileExpiration":            "0 sec",
+			"bends":                         []any{},
+			"componentType":                 "CONNECTION",
+		}
+	}
+
+	jsonReaderID, avroWriterID, avroReaderID, dbcpID := newUUID(), newUUID(), newUUID(), newUUID()
+	services := []any{
+		service(jsonReaderID, "SensorReading JSON reader", "org.apache.nifi.json.JsonTreeReader", "nifi-record-serialization-services-nar", map[string]string{
+			"schema-access-strategy": "schema-text-property",
+			"schema-text":            string(avroSchema),
+			"Timestamp Format":       "yyyy-MM-dd'T'HH:mm:ssX",
+		}),
+		service(avroWriterID, "SensorReading Avro writer", "org.apache.nifi.avro.AvroRecordSetWriter", "nifi-record-serialization-services-nar", map[string]string{
+			"Schema Write Strategy":  "avro-embedded",
+			"schema-access-strategy": "inherit-record-schema",
+		}),
+		service(avroReaderID, "SensorReading Avro reader", "org.apache.nifi.avro.AvroReader", "nifi-record-serialization-services-nar", map[string]string{
+			"schema-access-strategy": "embedded-avro-schema",
+		}),
+		service(dbcpID, "Target database", "org.apache.nifi.dbcp.DBCPConnectionPool", "nifi-dbcp-service-nar", map[string]string{
+			"Database Connection URL":    "jdbc:postgresql://localhost:5432/mijia",
+			"Database Driver Class Name": "org.postgresql.Driver",
+			"database-driver-locations":  "/opt/nifi/drivers/postgresql.jar",
+			"Database User":              "mijia",
+		}),
+	}
+
+	getHTTP := processor(newUUID(), "Fetch sensor history", "org.apache.nifi.processors.standard.GetHTTP", 0, "1 day", map[string]string{
+		"URL":                 ctx.HistoryURL,
+		"Filename":            ctx.Name + ".json",
+		"Accept Content-Type": "application/json",
+		"Follow Redirects":    "true",
+		"Connection Timeout":  "30 sec",
+		"Data Timeout":        "5 min",
+	}, "Mijia sensor "+history.Loc+" ("+history.Mac+")", []string{})
+	convert := processor(newUUID(), "JSON to Avro", "org.apache.nifi.processors.standard.ConvertRecord", 200, "0 sec", map[string]string{
+		"record-reader": jsonReaderID,
+		"record-writer": avroWriterID,
+	}, "", []string{"failure"})
+	put := processor(newUUID(), "Insert into sensor_data", "org.apache.nifi.processors.standard.PutDatabaseRecord", 400, "0 sec", map[string]string{
+		"put-db-record-record-reader":         avroReaderID,
+		"put-db-record-statement-type":        "INSERT",
+		"put-db-record-dcbp-service":          dbcpID,
+		"put-db-record-table-name":            "sensor_data",
+		"put-db-record-translate-field-names": "false",
+	}, "INSERT INTO sensor_data (timestamp, temp, humidity, battery_mv, battery_level) VALUES (?, ?, ?, ?, ?)", []string{"success", "failure", "retry"})
+
+	snapshot := map[string]any{
+		"flowEncodingVersion": "1.0",
+		"flowContents": map[string]any{
+			"identifier":         groupID,
+			"name":               "Mijia " + history.Loc,
+			"comments":           "Loads the history of " + history.Mac + " into a database",
+			"componentType":      "PROCESS_GROUP",
+			"processors":         []any{getHTTP, convert, put},
+			"connections":        []any{connection(getHTTP, convert, "success"), connection(convert, put, "success")},
+			"controllerServices": services,
+			"processGroups":      []any{},
+			"inputPorts":         []any{},
+			"outputPorts":        []any{},
+			"funnels":            []any{},
+			"labels":             []any{},
+			"variables":          map[string]string{},
+		},
+	}
+
+	setAttachment(w, "application/json", exportFilename(history.Mac, "nifi.json"))
+	writeJSON(w, "application/json", snapshot)
+}
+
+// sensorReadingProto is the protobuf definition of a SensorReading.
+const sensorReadingProto = `syntax = "proto3";
+
+package mijia;
+
+import "google/protobuf/timestamp.proto";
+
+message SensorReading {
+  google.protobuf.Timestamp timestamp = 1;
+  double temp = 2;
+  double humidity = 3;
+  int32 battery_mv = 4;
+  int32 battery_level = 5;
+}
+`
+
+// exportKafkaSchemaRegistry returns the SensorReading schema as body for
+// POST /subjects/sensors-value/versions of the Confluent Schema Registry.
+// The format parameter selects json (default), avro or protobuf.
+func exportKafkaSchemaRegistry(w http.ResponseWriter, r *http.Request) {
+	if _, ok := loadSensor(w, r); !ok {
+		return
+	}
+
+	var schemaType, schema string
+	switch format := r.URL.Query().Get("format"); format {
+	case "", "json":
+		data, err := json.Marshal(sensorReadingSchema())
+		if err != nil {
+			exportError(w, err)
+			return
+		}
+		schemaType, schema = "JSON", string(data)
+	case "avro":
+		data, err := json.Marshal(sensorReadingAvroSchema())
+		if err != nil {
+			exportError(w, err)
+			return
+		}
+		schemaType, schema = "AVRO", string(data)
+	case "protobuf":
+		schemaType, schema = "PROTOBUF", sensorReadingProto
+	default:
+		http.Error(w, "invalid format parameter, expected avro, json or protobuf", http.StatusBadRequest)
+		return
+	}
+
+	writeJSON(w, "application/vnd.schemaregistry.v1+json", map[string]any{
+		// TopicNameStrategy: <topic>-value
+		"subject":    "sensors-value",
+		"schemaType": schemaType,
+		"schema":     schema,
+		"references": []any{},
+	})
+}
+
+// exportAwsGlue generates a Glue CreateTable request for a Parquet table
+// below the s3_prefix parameter and a Glue ETL job filling it from the
+// CSV export.
+func exportAwsGlue(w http.ResponseWriter, r *http.Request) {
+	history, ok := loadSensor(w, r)
+	if !ok {
+		return
+	}
+	ctx := newExportContext(r, history)
+
+	s3Prefix := r.URL.Query().Get("s3_prefix")
+	if s3Prefix == "" {
+		s3Prefix = "s3://my-bucket/mijia/" + ctx.Name + "/"
+	}
+
+	createTable, err := json.MarshalIndent(map[string]any{
+		"DatabaseName": "mijia",
+		"TableInput": map[string]any{
+			"Name":        ctx.Name,
+			"Description": "Mijia sensor " + history.Loc + " (" + history.Mac + ")",
+			"TableType":   "EXTERNAL_TABLE",
+			"Parameters":  map[string]string{"classification": "parquet"},
+			"StorageDescriptor": map[string]any{
+				"Columns": []map[string]string{
+					{"Name": "timestamp", "Type": "timestamp", "Comment": "Time of the reading in UTC"},
+					{"Name": "temp", "Type": "double", "Comment": "Temperature in °C"},
+					{"Name": "humidity", "Type": "double", "Comment": "Relative humidity in %"},
+					{"Name": "battery_mv", "Type": "smallint", "Comment": "Battery voltage in mV"},
+					{"Name": "battery_level", "Type": "tinyint", "Comment": "Battery level in %"},
+				},
+				"Location":     s3Prefix,
+				"InputFormat":  "org.apache.hadoop.hive.ql.io.parquet.MapredParquetInputFormat",
+				"OutputFormat": "org.apache.hadoop.hive.ql.io.parquet.MapredParquetOutputFormat",
+				"SerdeInfo": map[string]any{
+					"SerializationLibrary": "org.apache.hadoop.hive.ql.io.parquet.serde.ParquetHiveSerDe",
+					"Parameters":           map[string]string{"serialization.format": "1"},
+				},
+			},
+		},
+	}, "", "  ")
+	if err != nil {
+		exportError(w, err)
+		return
+	}
+
+	script, err := renderExportTemplate("glue_etl_script.py", struct {
+		exportContext
+		S3Prefix string
+	}{ctx, s3Prefix})
+	if err != nil {
+		exportError(w, err)
+		return
+	}
+
+	writeZip(w, exportFilename(history.Mac, "glue.zip"), []zipFile{
+		{Name: "create_table.json", Data: createTable},
+		{Name: "glue_etl_script.py", Data: script},
+	})
+}
+
+// exportDatabricks generates a Databricks notebook in source format that
+// loads the CSV export into Delta tables with hourly aggregations.
+func exportDatabricks(w http.ResponseWriter, r *http.Request) {
+	history, ok := loadSensor(w, r)
+	if !ok {
+		return
+	}
+
+	notebook, err := renderExportTemplate("databricks_notebook.py", newExportContext(r, history))
+	if err != nil {
+		exportError(w, err)
+		return
+	}
+
+	setAttachment(w, "text/x-python", exportFilename(history.Mac, "py"))
+	w.Write(notebook)
+}
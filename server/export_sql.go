@@ -0,0 +1,889 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// exportSnowflake generates the Snowflake DDL, stage and COPY INTO script
+// for the CSV export along with a SnowSQL connection config.
+func exportSnowflake(w http.ResponseWriter, r *http.Request) {
+	history, ok := loadSensor(w, r)
+	if !ok {
+		return
+	}
+
+	files, err := renderExportFiles(newExportContext(r, history), [][2]string{
+		{"snowflake.sql", "snowflake.sql"},
+		{"snowsql_config", "snowsql_config"},
+	})
+	if err != nil {
+		exportError(w, err)
+		return
+	}
+
+	writeZip(w, exportFilename(history.Mac, "snowflake.zip"), files)
+}
+
+// exportBigquery returns the BigQuery table schema with a bq load command
+// for the CSV export, and a Storage Write API AppendRows request that
+// streams the whole history into the table's default stream.
+func exportBigquery(w http.ResponseWriter, r *http.Request) {
+	history, ok := loadHistory(w, r)
+	if !ok {
+		return
+	}
+	ctx := newExportContext(r, history)
+
+	schema := []map[string]string{
+		{"name": "timestamp", "type": "TIMESTAMP", "mode": "REQUIRED", "description": "Time of the reading in UTC"},
+		{"name": "temp", "type": "FLOAT64", "mode": "REQUIRED", "description": "Temperature in °C"},
+		{"name": "humidity", "type": "FLOAT64", "mode": "REQUIRED", "description": "Relative humidity in %"},
+		{"name": "battery_mv", "type": "INT64", "mode": "REQUIRED", "description": "Battery voltage in mV"},
+		{"name": "battery_level", "type": "INT64", "mode": "REQUIRED", "description": "Battery level in %"},
+	}
+	schemaJSON, err := json.Marshal(schema)
+	if err != nil {
+		exportError(w, err)
+		return
+	}
+	table := "mijia." + ctx.Name
+	loadCommand := fmt.Sprintf(
+		"curl -o %[1]s.csv %[2]s && bq load --source_format=CSV --skip_leading_rows=1 %[3]s %[1]s.csv '%[4]s'",
+		ctx.Name, ctx.CSVURL, table, schemaJSON,
+	)
+
+	// rows are serialized with the descriptor below, TIMESTAMP columns
+	// are expected as microseconds since epoch
+	var rows []string
+	for _, reading := range history.Readings {
+		var row protoMessage
+		row.Int64(1, reading.Timestamp.UnixMicro())
+		row.Double(2, reading.Temp)
+		row.Double(3, reading.Humidity)
+		row.Int64(4, int64(reading.BatteryMV))
+		row.Int64(5, int64(reading.BatteryLevel))
+		rows = append(rows, base64.StdEncoding.EncodeToString(row.Encoded()))
+	}
+	descriptorField := func(name string, number int, typ string) map[string]any {
+		return map[string]any{"name": name, "number": number, "type": typ, "label": "LABEL_REQUIRED"}
+	}
+	writeRequest := map[string]any{
+		"writeStream": "projects/<project>/datasets/mijia/tables/" + ctx.Name + "/streams/_default",
+		"protoRows": map[string]any{
+			"writerSchema": map[string]any{
+				"protoDescriptor": map[string]any{
+					"name": "SensorReading",
+					"field": []any{
+						descriptorField("timestamp", 1, "TYPE_INT64"),
+						descriptorField("temp", 2, "TYPE_DOUBLE"),
+						descriptorField("humidity", 3, "TYPE_DOUBLE"),
+						descriptorField("battery_mv", 4, "TYPE_INT64"),
+						descriptorField("battery_level", 5, "TYPE_INT64"),
+					},
+				},
+			},
+			"rows": map[string]any{
+				"serializedRows": rows,
+			},
+		},
+	}
+
+	writeJSON(w, "application/json", map[string]any{
+		"schema":        schema,
+		"load_command":  loadCommand,
+		"write_request": writeRequest,
+	})
+}
+
+// s3PrefixPattern matches the s3_prefix parameter: an S3 URL with a bucket
+// name and a key prefix without quotes or spaces, it ends up in SQL
+// literals and comments of the scripts.
+var s3PrefixPattern = regexp.MustCompile(`^s3://[a-z0-9.-]+/[^'\s]*$`)
+
+// s3PrefixParam returns the s3_prefix parameter or the placeholder prefix,
+// or replies with 400 if it is invalid.
+func s3PrefixParam(w http.ResponseWriter, r *http.Request) (string, bool) {
+	s3Prefix := r.URL.Query().Get("s3_prefix")
+	if s3Prefix == "" {
+		return "s3://my-bucket/mijia/", true
+	}
+	if !s3PrefixPattern.MatchString(s3Prefix) {
+		http.Error(w, "invalid s3_prefix, expected s3://bucket/prefix", http.StatusBadRequest)
+		return "", false
+	}
+	return s3Prefix, true
+}
+
+// exportRedshift generates the Redshift DDL with COPY from S3 and a
+// psycopg2 script inserting directly for setups without S3.
+func exportRedshift(w http.ResponseWriter, r *http.Request) {
+	history, ok := loadSensor(w, r)
+	if !ok {
+		return
+	}
+	ctx := newExportContext(r, history)
+
+	s3Prefix, ok := s3PrefixParam(w, r)
+	if !ok {
+		return
+	}
+	files, err := renderExportFiles(struct {
+		exportContext
+		S3Prefix string
+	}{ctx, s3Prefix}, [][2]string{
+		{"redshift.sql", "redshift.sql"},
+		{"redshift_insert.py", "redshift_insert.py"},
+	})
+	if err != nil {
+		exportError(w, err)
+		return
+	}
+
+	writeZip(w, exportFilename(history.Mac, "redshift.zip"), files)
+}
+
+// exportClickhouse generates a MergeTree DDL with batched INSERTs, and
+// alternatively a JSONEachRow payload for the ClickHouse HTTP interface.
+func exportClickhouse(w http.ResponseWriter, r *http.Request) {
+	history, ok := loadHistory(w, r)
+	if !ok {
+		return
+	}
+
+	files, err := renderExportFiles(newExportContext(r, history), [][2]string{
+		{"clickhouse.sql", "clickhouse.sql"},
+		{"clickhouse_http_insert.sh", "http_insert.sh"},
+	})
+	if err != nil {
+		exportError(w, err)
+		return
+	}
+
+	var rows bytes.Buffer
+	encoder := json.NewEncoder(&rows)
+	for _, reading := range history.Readings {
+		if err := encoder.Encode(map[string]any{
+			"mac":           history.Mac,
+			"timestamp":     reading.Timestamp.Format(sqliteTimeFormat),
+			"temp":          reading.Temp,
+			"humidity":      reading.Humidity,
+			"battery_mv":    reading.BatteryMV,
+			"battery_level": reading.BatteryLevel,
+		}); err != nil {
+			exportError(w, err)
+			return
+		}
+	}
+	files = append(files, zipFile{Name: "sensor_data.jsonl", Data: rows.Bytes()})
+
+	writeZip(w, exportFilename(history.Mac, "clickhouse.zip"), files)
+}
+
+// exportDuckdb generates a DuckDB script reading the CSV export directly,
+// computing daily summaries and writing a Parquet file.
+func exportDuckdb(w http.ResponseWriter, r *http.Request) {
+	history, ok := loadSensor(w, r)
+	if !ok {
+		return
+	}
+
+	script, err := renderExportTemplate("duckdb.sql", newExportContext(r, history))
+	if err != nil {
+		exportError(w, err)
+		return
+	}
+
+	setAttachment(w, "application/sql", exportFilename(history.Mac, "duckdb.sql"))
+	w.Write(script)
+}
+
+// exportSqliteImport generates SQL merging the history into the SQLite
+// database of another Mijia server given by the target parameter,
+// skipping readings that are already present.
+func exportSqliteImport(w http.ResponseWriter, r *http.Request) {
+	history, ok := loadHistory(w, r)
+	if !ok {
+		return
+	}
+
+	target := r.URL.Query().Get("target")
+	if target == "" {
+		target = "/path/to/target.db"
+	}
+	script, err := renderExportTemplate("sqlite_import.sql", struct {
+		exportContext
+		Target string
+	}{newExportContext(r, history), target})
+	if err != nil {
+		exportError(w, err)
+		return
+	}
+
+	setAttachment(w, "application/sql", exportFilename(history.Mac, "sqlite.sql"))
+	w.Write(script)
+}
+
+// exportMysql generates MySQL DDL and INSERT IGNORE statements of 100 rows
+// each. With upsert=true existing rows are updated by ON DUPLICATE KEY
+// UPDATE instead of being skipped.
+func exportMysql(w http.ResponseWriter, r *http.Request) {
+	history, ok := loadHistory(w, r)
+	if !ok {
+		return
+	}
+
+	script, err := renderExportTemplate("mysql.sql", struct {
+		exportContext
+		Upsert bool
+	}{newExportContext(r, history), r.URL.Query().Get("upsert") == "true"})
+	if err != nil {
+		exportError(w, err)
+		return
+	}
+
+	setAttachment(w, "application/sql", exportFilename(history.Mac, "mysql.sql"))
+	w.Write(script)
+}
+
+// exportPostgresql generates a psql script with the PostgreSQL DDL and the
+// readings as COPY FROM STDIN data section.
+func exportPostgresql(w http.ResponseWriter, r *http.Request) {
+	history, ok := loadHistory(w, r)
+	if !ok {
+		return
+	}
+
+	script, err := renderExportTemplate("postgresql.sql", newExportContext(r, history))
+	if err != nil {
+		exportError(w, err)
+		return
+	}
+
+	setAttachment(w, "application/sql", exportFilename(history.Mac, "postgresql.sql"))
+	w.Write(script)
+}
+
+// exportCratedb generates CrateDB DDL sharded by mac with batched INSERTs,
+// and a COPY FROM of the CSV export as bulk alternative.
+func exportCratedb(w http.ResponseWriter, r *http.Request) {
+	history, ok := loadHistory(w, r)
+	if !ok {
+		return
+	}
+
+	script, err := renderExportTemplate("cratedb.sql", newExportContext(r, history))
+	if err != nil {
+		exportError(w, err)
+		return
+	}
+
+	setAttachment(w, "application/sql", exportFilename(history.Mac, "cratedb.sql"))
+	w.Write(script)
+}
+
+// exportSinglestore generates the SingleStore columnstore DDL, a LOAD DATA
+// of the CSV export and a Kafka pipeline for new readings.
+func exportSinglestore(w http.ResponseWriter, r *http.Request) {
+	history, ok := loadSensor(w, r)
+	if !ok {
+		return
+	}
+
+	script, err := renderExportTemplate("singlestore.sql", newExportContext(r, history))
+	if err != nil {
+		exportError(w, err)
+		return
+	}
+
+	setAttachment(w, "application/sql", exportFilename(history.Mac, "singlestore.sql"))
+	w.Write(script)
+}
+
+// exportExasol generates the Exasol DDL and an IMPORT fetching the CSV
+// export over HTTP through a connection object.
+func exportExasol(w http.ResponseWriter, r *http.Request) {
+	history, ok := loadSensor(w, r)
+	if !ok {
+		return
+	}
+
+	script, err := renderExportTemplate("exasol.sql", newExportContext(r, history))
+	if err != nil {
+		exportError(w, err)
+		return
+	}
+
+	setAttachment(w, "application/sql", exportFilename(history.Mac, "exasol.sql"))
+	w.Write(script)
+}
+
+// exportVertica generates Vertica DDL with column encodings and a COPY
+// fetching the CSV export through a cURL based HTTP source.
+func exportVertica(w http.ResponseWriter, r *http.Request) {
+	history, ok := loadSensor(w, r)
+	if !ok {
+		return
+	}
+
+	script, err := renderExportTemplate("vertica.sql", newExportContext(r, history))
+	if err != nil {
+		exportError(w, err)
+		return
+	}
+
+	setAttachment(w, "application/sql", exportFilename(history.Mac, "vertica.sql"))
+	w.Write(script)
+}
+
+// writeSQLCSV writes the readings as CSV with the mac as first column and
+// timestamps as SQL literals, for bulk loaders that only insert the fields
+// of the file.
+func writeSQLCSV(w io.Writer, history *SensorHistory) error {
+	out := csv.NewWriter(w)
+	out.Write([]string{"mac", "timestamp", "temp", "humidity", "battery_mv", "battery_level"})
+	for _, reading := range history.Readings {
+		out.Write([]string{
+			history.Mac,
+			reading.Timestamp.Format(sqliteTimeFormat),
+			strconv.FormatFloat(reading.Temp, 'f', -1, 64),
+			strconv.FormatFloat(reading.Humidity, 'f', -1, 64),
+			strconv.Itoa(int(reading.BatteryMV)),
+			strconv.Itoa(int(reading.BatteryLevel)),
+		})
+	}
+	out.Flush()
+	return out.Error()
+}
+
+// exportTeradata generates BTEQ scripts creating and filling a multiset
+// table and a FastLoad script loading the readings into a staging table.
+// The CSV of the archive has the mac as first column, as FastLoad only
+// inserts fields of the input records.
+func exportTeradata(w http.ResponseWriter, r *http.Request) {
+	history, ok := loadHistory(w, r)
+	if !ok {
+		return
+	}
+
+	files, err := renderExportFiles(newExportContext(r, history), [][2]string{
+		{"teradata_setup.bteq", "teradata_setup.bteq"},
+		{"teradata.fastload", "teradata.fastload"},
+		{"teradata_merge.bteq", "teradata_merge.bteq"},
+		{"teradata_load.sh", "teradata_load.sh"},
+	})
+	if err != nil {
+		exportError(w, err)
+		return
+	}
+
+	var data bytes.Buffer
+	if err := writeSQLCSV(&data, history); err != nil {
+		exportError(w, err)
+		return
+	}
+	files = append(files, zipFile{Name: "sensor_data.csv", Data: data.Bytes()})
+
+	writeZip(w, exportFilename(history.Mac, "teradata.zip"), files)
+}
+
+// exportOracle generates the Oracle DDL with monthly interval partitions
+// and a SQL*Loader control file for the CSV export.
+func exportOracle(w http.ResponseWriter, r *http.Request) {
+	history, ok := loadSensor(w, r)
+	if !ok {
+		return
+	}
+
+	files, err := renderExportFiles(newExportContext(r, history), [][2]string{
+		{"oracle.sql", "oracle.sql"},
+		{"oracle_sqlldr.ctl", "sensor_data.ctl"},
+	})
+	if err != nil {
+		exportError(w, err)
+		return
+	}
+
+	writeZip(w, exportFilename(history.Mac, "oracle.zip"), files)
+}
+
+// exportDb2 generates the Db2 DDL and a LOAD of the readings, which are
+// in the delimited ASCII format of Db2 with the mac as first column.
+func exportDb2(w http.ResponseWriter, r *http.Request) {
+	history, ok := loadHistory(w, r)
+	if !ok {
+		return
+	}
+
+	files, err := renderExportFiles(newExportContext(r, history), [][2]string{
+		{"db2.sql", "db2.sql"},
+	})
+	if err != nil {
+		exportError(w, err)
+		return
+	}
+
+	// character fields are enclosed in double quotes, which the MAC never
+	// contains
+	var data bytes.Buffer
+	for _, reading := range history.Readings {
+		fmt.Fprintf(&data, "%q,%q,%s,%s,%d,%d\n",
+			history.Mac,
+			reading.Timestamp.Format(sqliteTimeFormat),
+			strconv.FormatFloat(reading.Temp, 'f', -1, 64),
+			strconv.FormatFloat(reading.Humidity, 'f', -1, 64),
+			reading.BatteryMV,
+			reading.BatteryLevel,
+		)
+	}
+	files = append(files, zipFile{Name: "sensor_data.del", Data: data.Bytes()})
+
+	writeZip(w, exportFilename(history.Mac, "db2.zip"), files)
+}
+
+// exportSybase generates SAP HANA SQL, the successor of Sybase ASE: a
+// column table with monthly range partitions and an IMPORT FROM CSV FILE
+// of the CSV export.
+func exportSybase(w http.ResponseWriter, r *http.Request) {
+	history, ok := loadSensor(w, r)
+	if !ok {
+		return
+	}
+
+	script, err := renderExportTemplate("hana.sql", newExportContext(r, history))
+	if err != nil {
+		exportError(w, err)
+		return
+	}
+
+	setAttachment(w, "application/sql", exportFilename(history.Mac, "hana.sql"))
+	w.Write(script)
+}
+
+// exportMonetdb generates the MonetDB DDL and a script piping the CSV
+// export into COPY INTO ... FROM STDIN with mclient.
+func exportMonetdb(w http.ResponseWriter, r *http.Request) {
+	history, ok := loadSensor(w, r)
+	if !ok {
+		return
+	}
+
+	files, err := renderExportFiles(newExportContext(r, history), [][2]string{
+		{"monetdb.sql", "monetdb.sql"},
+		{"monetdb_import.sh", "monetdb_import.sh"},
+	})
+	if err != nil {
+		exportError(w, err)
+		return
+	}
+
+	writeZip(w, exportFilename(history.Mac, "monetdb.zip"), files)
+}
+
+// exportDolt generates a script importing the MySQL export into a clone of
+// a Dolt repository, committing and pushing the import.
+func exportDolt(w http.ResponseWriter, r *http.Request) {
+	history, ok := loadHistory(w, r)
+	if !ok {
+		return
+	}
+	ctx := newExportContext(r, history)
+
+	sql, err := renderExportTemplate("mysql.sql", struct {
+		exportContext
+		Upsert bool
+	}{ctx, false})
+	if err != nil {
+		exportError(w, err)
+		return
+	}
+	script, err := renderExportTemplate("dolt.sh", struct {
+		exportContext
+		SQL     string
+		Message string
+	}{ctx, string(sql), "Import sensor history for " + history.Mac})
+	if err != nil {
+		exportError(w, err)
+		return
+	}
+
+	setAttachment(w, "application/x-sh", exportFilename(history.Mac, "dolt.sh"))
+	w.Write(script)
+}
+
+// exportNeon generates a script importing the PostgreSQL export into a new
+// branch of a Neon project, named after the import time.
+func exportNeon(w http.ResponseWriter, r *http.Request) {
+	history, ok := loadHistory(w, r)
+	if !ok {
+		return
+	}
+
+	script, err := renderExportTemplate("neon.sh", newExportContext(r, history), "postgresql.sql")
+	if err != nil {
+		exportError(w, err)
+		return
+	}
+
+	setAttachment(w, "application/x-sh", exportFilename(history.Mac, "neon.sh"))
+	w.Write(script)
+}
+
+// exportPlanetscale generates the DDL with a Vitess VSchema sharding by
+// mac, the pscale commands deploying it by deploy request and the readings
+// as INSERT IGNORE statements.
+func exportPlanetscale(w http.ResponseWriter, r *http.Request) {
+	history, ok := loadHistory(w, r)
+	if !ok {
+		return
+	}
+
+	files, err := renderExportFiles(newExportContext(r, history), [][2]string{
+		{"planetscale_schema.sql", "planetscale_schema.sql"},
+		{"planetscale_data.sql", "planetscale_data.sql"},
+		{"planetscale_deploy.sh", "planetscale_deploy.sh"},
+	})
+	if err != nil {
+		exportError(w, err)
+		return
+	}
+	vschema, err := json.MarshalIndent(map[string]any{
+		"sharded": true,
+		"vindexes": map[string]any{
+			"hash": map[string]string{"type": "xxhash"},
+		},
+		"tables": map[string]any{
+			"sensor_data": map[string]any{
+				"column_vindexes": []map[string]string{
+					{"column": "mac", "name": "hash"},
+				},
+			},
+		},
+	}, "", "  ")
+	if err != nil {
+		exportError(w, err)
+		return
+	}
+	files = append(files, zipFile{Name: "vschema.json", Data: vschema})
+
+	writeZip(w, exportFilename(history.Mac, "planetscale.zip"), files)
+}
+
+// cockroachTTLPattern matches the ttl parameter, an interval of a single
+// unit, it is written into a comment of the script as well.
+var cockroachTTLPattern = regexp.MustCompile(`^\d+ (second|minute|hour|day|week|month|year)s?$`)
+
+// exportCockroachdb generates CockroachDB DDL with row level TTL and list
+// partitioning by mac, and an IMPORT INTO of the CSV export. The ttl
+// parameter is an interval, 90 days by default.
+func exportCockroachdb(w http.ResponseWriter, r *http.Request) {
+	history, ok := loadSensor(w, r)
+	if !ok {
+		return
+	}
+
+	ttl := r.URL.Query().Get("ttl")
+	if ttl == "" {
+		ttl = "90 days"
+	} else if !cockroachTTLPattern.MatchString(ttl) {
+		http.Error(w, "invalid ttl, expected an interval like 90 days", http.StatusBadRequest)
+		return
+	}
+	script, err := renderExportTemplate("cockroachdb.sql", struct {
+		exportContext
+		TTL string
+	}{newExportContext(r, history), ttl})
+	if err != nil {
+		exportError(w, err)
+		return
+	}
+
+	setAttachment(w, "application/sql", exportFilename(history.Mac, "cockroachdb.sql"))
+	w.Write(script)
+}
+
+// exportTidb generates the TiDB DDL with monthly interval partitions and a
+// TiFlash replica, a LOAD DATA of the readings and a TiDB Lightning config
+// for the same CSV file.
+func exportTidb(w http.ResponseWriter, r *http.Request) {
+	history, ok := loadHistory(w, r)
+	if !ok {
+		return
+	}
+
+	// the partitions span the months of the readings and another year
+	first, last := time.Now().UTC(), time.Now().UTC()
+	if len(history.Readings) > 0 {
+		first = history.Readings[0].Timestamp
+		last = history.Readings[len(history.Readings)-1].Timestamp
+	}
+	first = time.Date(first.Year(), first.Month(), 1, 0, 0, 0, 0, time.UTC)
+	last = time.Date(last.Year()+1, last.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+
+	files, err := renderExportFiles(struct {
+		exportContext
+		FirstPartition string
+		LastPartition  string
+	}{newExportContext(r, history), first.Format(time.DateOnly), last.Format(time.DateOnly)}, [][2]string{
+		{"tidb.sql", "tidb.sql"},
+		{"tidb-lightning.toml", "tidb-lightning.toml"},
+	})
+	if err != nil {
+		exportError(w, err)
+		return
+	}
+	var data bytes.Buffer
+	if err := writeSQLCSV(&data, history); err != nil {
+		exportError(w, err)
+		return
+	}
+	files = append(files, zipFile{Name: "mijia.sensor_data.0.csv", Data: data.Bytes()})
+
+	writeZip(w, exportFilename(history.Mac, "tidb.zip"), files)
+}
+
+// exportYugabyte generates the YSQL import with the DDL pre-split by month
+// and the readings as COPY data, and the YCQL DDL with a COPY FROM of the
+// Cassandra CSV.
+func exportYugabyte(w http.ResponseWriter, r *http.Request) {
+	history, ok := loadHistory(w, r)
+	if !ok {
+		return
+	}
+
+	var splitPoints []string
+	if len(history.Readings) > 0 {
+		first := history.Readings[0].Timestamp
+		last := history.Readings[len(history.Readings)-1].Timestamp
+		month := time.Date(first.Year(), first.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+		for ; !month.After(last); month = month.AddDate(0, 1, 0) {
+			splitPoints = append(splitPoints, month.Format("2006-01-02 15:04:05-07"))
+		}
+	}
+	data := struct {
+		exportContext
+		SplitPoints []string
+	}{newExportContext(r, history), splitPoints}
+	ysql, err := renderExportTemplate("ysql_import.sql", data, "postgresql.sql")
+	if err != nil {
+		exportError(w, err)
+		return
+	}
+	ycql, err := renderExportTemplate("ycql_import.cql", data)
+	if err != nil {
+		exportError(w, err)
+		return
+	}
+	var rows bytes.Buffer
+	writeCassandraCSV(&rows, history)
+
+	writeZip(w, exportFilename(history.Mac, "yugabyte.zip"), []zipFile{
+		{Name: "ysql_import.sql", Data: ysql},
+		{Name: "ycql_import.cql", Data: ycql},
+		{Name: "sensor_data.csv", Data: rows.Bytes()},
+	})
+}
+
+// exportSpanner generates the Cloud Spanner DDL with the readings
+// interleaved in their sensor, the gcloud commands applying it and a
+// Python import of the JSON history API.
+func exportSpanner(w http.ResponseWriter, r *http.Request) {
+	history, ok := loadSensor(w, r)
+	if !ok {
+		return
+	}
+
+	files, err := renderExportFiles(newExportContext(r, history), [][2]string{
+		{"spanner.sql", "spanner.sql"},
+		{"spanner_setup.sh", "spanner_setup.sh"},
+		{"spanner_import.py", "spanner_import.py"},
+	})
+	if err != nil {
+		exportError(w, err)
+		return
+	}
+
+	writeZip(w, exportFilename(history.Mac, "spanner.zip"), files)
+}
+
+// exportAlloydb generates the PostgreSQL export with the AlloyDB columnar
+// engine enabled for the table, queries using it and the gcloud commands
+// creating a cluster and importing the script.
+func exportAlloydb(w http.ResponseWriter, r *http.Request) {
+	history, ok := loadHistory(w, r)
+	if !ok {
+		return
+	}
+	ctx := newExportContext(r, history)
+
+	script, err := renderExportTemplate("alloydb.sql", ctx, "postgresql.sql")
+	if err != nil {
+		exportError(w, err)
+		return
+	}
+	files, err := renderExportFiles(ctx, [][2]string{
+		{"alloydb_queries.sql", "alloydb_queries.sql"},
+		{"alloydb_setup.sh", "alloydb_setup.sh"},
+	})
+	if err != nil {
+		exportError(w, err)
+		return
+	}
+	files = append([]zipFile{{Name: "alloydb.sql", Data: script}}, files...)
+
+	writeZip(w, exportFilename(history.Mac, "alloydb.zip"), files)
+}
+
+// exportAurora generates the Aurora MySQL LOAD DATA FROM S3 and Aurora
+// PostgreSQL aws_s3 imports of the CSV export below the s3_prefix
+// parameter, with the IAM policy and a CloudFormation template for the
+// role and the aurora_load_from_s3_role parameter.
+func exportAurora(w http.ResponseWriter, r *http.Request) {
+	history, ok := loadSensor(w, r)
+	if !ok {
+		return
+	}
+	ctx := newExportContext(r, history)
+
+	s3Prefix, ok := s3PrefixParam(w, r)
+	if !ok {
+		return
+	}
+	region := r.URL.Query().Get("region")
+	if region == "" {
+		region = "us-east-1"
+	}
+	bucket, prefix, _ := strings.Cut(strings.TrimPrefix(s3Prefix, "s3://"), "/")
+	data := struct {
+		exportContext
+		S3Prefix string
+		Bucket   string
+		Key      string
+		Region   string
+	}{ctx, s3Prefix, bucket, prefix + ctx.Name + ".csv", region}
+
+	files, err := renderExportFiles(data, [][2]string{
+		{"aurora_mysql.sql", "aurora_mysql.sql"},
+		{"aurora_cloudformation.yaml", "aurora_cloudformation.yaml"},
+	})
+	if err != nil {
+		exportError(w, err)
+		return
+	}
+	postgresql, err := renderExportTemplate("aurora_postgresql.sql", data, "postgresql.sql")
+	if err != nil {
+		exportError(w, err)
+		return
+	}
+	policy, err := json.MarshalIndent(map[string]any{
+		"Version": "2012-10-17",
+		"Statement": []map[string]any{
+			{
+				"Effect":   "Allow",
+				"Action":   []string{"s3:GetObject", "s3:ListBucket"},
+				"Resource": []string{"arn:aws:s3:::" + bucket, "arn:aws:s3:::" + bucket + "/*"},
+			},
+		},
+	}, "", "  ")
+	if err != nil {
+		exportError(w, err)
+		return
+	}
+	files = append(files,
+		zipFile{Name: "aurora_postgresql.sql", Data: postgresql},
+		zipFile{Name: "aurora_iam_policy.json", Data: policy},
+	)
+
+	writeZip(w, exportFilename(history.Mac, "aurora.zip"), files)
+}
+
+// exportSupabase generates the PostgreSQL export with row level security
+// for Supabase, the same DDL as migration for supabase db push, and an
+// Edge Function with a pg_cron schedule syncing new readings from the JSON
+// API.
+func exportSupabase(w http.ResponseWriter, r *http.Request) {
+	history, ok := loadHistory(w, r)
+	if !ok {
+		return
+	}
+	ctx := newExportContext(r, history)
+
+	script, err := renderExportTemplate("supabase.sql", ctx, "postgresql.sql")
+	if err != nil {
+		exportError(w, err)
+		return
+	}
+	migration, err := renderExportTemplate("supabase_migration.sql", ctx, "postgresql.sql", "supabase.sql")
+	if err != nil {
+		exportError(w, err)
+		return
+	}
+	files, err := renderExportFiles(ctx, [][2]string{
+		{"supabase_sync.ts", "supabase/functions/mijia-sync/index.ts"},
+		{"supabase_schedule.sql", "supabase_schedule.sql"},
+	})
+	if err != nil {
+		exportError(w, err)
+		return
+	}
+	version := time.Now().UTC().Format("20060102150405")
+	files = append([]zipFile{
+		{Name: ctx.Name + ".supabase.sql", Data: script},
+		{Name: "supabase/migrations/" + version + "_create_sensor_data.sql", Data: migration},
+	}, files...)
+
+	writeZip(w, exportFilename(history.Mac, "supabase.zip"), files)
+}
+
+// exportHasura generates the PostgreSQL export with a sensors table, the
+// Hasura metadata tracking both tables with relationships and select
+// permissions for the role user, and example GraphQL queries.
+func exportHasura(w http.ResponseWriter, r *http.Request) {
+	history, ok := loadHistory(w, r)
+	if !ok {
+		return
+	}
+	ctx := newExportContext(r, history)
+
+	script, err := renderExportTemplate("hasura.sql", ctx, "postgresql.sql")
+	if err != nil {
+		exportError(w, err)
+		return
+	}
+
+	// time range of the example query variables
+	from, to := time.Now().UTC().AddDate(0, 0, -1), time.Now().UTC()
+	if len(history.Readings) > 0 {
+		from, to = history.Readings[0].Timestamp, history.Readings[len(history.Readings)-1].Timestamp
+	}
+	files, err := renderExportFiles(struct {
+		exportContext
+		From, To string
+	}{ctx, from.Format(time.RFC3339), to.Format(time.RFC3339)}, [][2]string{
+		{"hasura_databases.yaml", "metadata/databases/databases.yaml"},
+		{"hasura_sensors.yaml", "metadata/databases/default/tables/public_sensors.yaml"},
+		{"hasura_sensor_data.yaml", "metadata/databases/default/tables/public_sensor_data.yaml"},
+		{"hasura_queries.graphql", "queries.graphql"},
+	})
+	if err != nil {
+		exportError(w, err)
+		return
+	}
+	files = append(files,
+		zipFile{Name: "hasura.sql", Data: script},
+		zipFile{Name: "metadata/version.yaml", Data: []byte("version: 3\n")},
+		zipFile{Name: "metadata/databases/default/tables/tables.yaml", Data: []byte(
+			"- \"!include public_sensors.yaml\"\n- \"!include public_sensor_data.yaml\"\n")},
+	)
+
+	writeZip(w, exportFilename(history.Mac, "hasura.zip"), files)
+}
@@ -0,0 +1,957 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/apache/pulsar-client-go/pulsar"
+	"github.com/go-zeromq/zmq4"
+	"github.com/gorilla/websocket"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// sensorDatabasePath returns the absolute path of the logger database of
+// the sensor, for connectors reading it directly.
+func sensorDatabasePath(mac string) (string, error) {
+	return filepath.Abs(fmt.Sprintf("../logs/%s.db", mac))
+}
+
+// exportDatastream generates a script replicating the readings into
+// BigQuery with Google Cloud Datastream, staged in MySQL.
+func exportDatastream(w http.ResponseWriter, r *http.Request) {
+	history, ok := loadSensor(w, r)
+	if !ok {
+		return
+	}
+	ctx := newExportContext(r, history)
+
+	script, err := renderExportTemplate("datastream.sh", struct {
+		exportContext
+		MySQLURL string
+		StreamID string
+	}{ctx, historyURL(r, history.Mac, "mysql"), strings.ReplaceAll(ctx.Name, "_", "-")})
+	if err != nil {
+		exportError(w, err)
+		return
+	}
+
+	setAttachment(w, "application/x-sh", exportFilename(history.Mac, "datastream.sh"))
+	w.Write(script)
+}
+
+// exportDebezium generates the Kafka Connect configuration of a Debezium
+// SQLite source connector for the sensor database and a script creating
+// the topics it needs.
+func exportDebezium(w http.ResponseWriter, r *http.Request) {
+	history, ok := loadSensor(w, r)
+	if !ok {
+		return
+	}
+	ctx := newExportContext(r, history)
+
+	hostname := r.Host
+	if host, _, err := net.SplitHostPort(r.Host); err == nil {
+		hostname = host
+	}
+	dbPath, err := sensorDatabasePath(history.Mac)
+	if err != nil {
+		exportError(w, err)
+		return
+	}
+	const topicPrefix = "sensors"
+	topics := struct {
+		exportContext
+		HeartbeatTopic     string
+		OffsetTopic        string
+		SchemaHistoryTopic string
+		DataTopic          string
+	}{
+		exportContext:      ctx,
+		HeartbeatTopic:     "__debezium-heartbeat." + topicPrefix,
+		OffsetTopic:        topicPrefix + "-offsets",
+		SchemaHistoryTopic: topicPrefix + "-schema-history",
+		DataTopic:          topicPrefix + ".sensor_data",
+	}
+
+	connector, err := json.MarshalIndent(map[string]any{
+		"name": "mijia-" + strings.ReplaceAll(history.Mac, ":", ""),
+		"config": map[string]string{
+			"connector.class":                     "io.debezium.connector.sqlite.SqliteConnector",
+			"tasks.max":                           "1",
+			"database.hostname":                   hostname,
+			"database.dbname":                     dbPath,
+			"table.include.list":                  "sensor_data",
+			"topic.prefix":                        topicPrefix,
+			"topic.heartbeat.prefix":              "__debezium-heartbeat",
+			"heartbeat.interval.ms":               "60000",
+			"offsets.storage.topic":               topics.OffsetTopic,
+			"schema.history.internal.kafka.topic": topics.SchemaHistoryTopic,
+			"schema.history.internal.kafka.bootstrap.servers": "localhost:9092",
+			"key.converter":   "org.apache.kafka.connect.json.JsonConverter",
+			"value.converter": "org.apache.kafka.connect.json.JsonConverter",
+		},
+	}, "", "  ")
+	if err != nil {
+		exportError(w, err)
+		return
+	}
+	script, err := renderExportTemplate("debezium_topics.sh", topics)
+	if err != nil {
+		exportError(w, err)
+		return
+	}
+
+	writeZip(w, exportFilename(history.Mac, "debezium.zip"), []zipFile{
+		{Name: "debezium_connector.json", Data: connector},
+		{Name: "debezium_topics.sh", Data: script},
+	})
+}
+
+// exportFlinkCdc generates a Flink SQL job streaming the changes of the
+// sensor database into a Kafka topic with the sqlite-cdc connector.
+func exportFlinkCdc(w http.ResponseWriter, r *http.Request) {
+	history, ok := loadSensor(w, r)
+	if !ok {
+		return
+	}
+	dbPath, err := sensorDatabasePath(history.Mac)
+	if err != nil {
+		exportError(w, err)
+		return
+	}
+
+	script, err := renderExportTemplate("flink_cdc.sql", struct {
+		exportContext
+		Database string
+		Topic    string
+	}{newExportContext(r, history), dbPath, "sensors.sensor_data"})
+	if err != nil {
+		exportError(w, err)
+		return
+	}
+
+	setAttachment(w, "application/sql", exportFilename(history.Mac, "flink-cdc.sql"))
+	w.Write(script)
+}
+
+// exportMaterialize generates the Materialize DDL of a webhook source fed
+// with the JSON history API, materialized temperature averages and a Kafka
+// sink of the hourly averages.
+func exportMaterialize(w http.ResponseWriter, r *http.Request) {
+	history, ok := loadSensor(w, r)
+	if !ok {
+		return
+	}
+	ctx := newExportContext(r, history)
+
+	script, err := renderExportTemplate("materialize.sql", struct {
+		exportContext
+		Source string
+	}{ctx, ctx.Name + "_webhook"})
+	if err != nil {
+		exportError(w, err)
+		return
+	}
+
+	setAttachment(w, "application/sql", exportFilename(history.Mac, "materialize.sql"))
+	w.Write(script)
+}
+
+// exportRisingwave generates a RisingWave script loading the readings into
+// an append only table, with an hourly materialized view sunk into Kafka
+// at the bootstrap_server parameter.
+func exportRisingwave(w http.ResponseWriter, r *http.Request) {
+	history, ok := loadHistory(w, r)
+	if !ok {
+		return
+	}
+
+	bootstrapServer := r.URL.Query().Get("bootstrap_server")
+	if bootstrapServer == "" {
+		bootstrapServer = "localhost:9092"
+	}
+	script, err := renderExportTemplate("risingwave.sql", struct {
+		exportContext
+		BootstrapServer string
+	}{newExportContext(r, history), bootstrapServer})
+	if err != nil {
+		exportError(w, err)
+		return
+	}
+
+	setAttachment(w, "application/sql", exportFilename(history.Mac, "risingwave.sql"))
+	w.Write(script)
+}
+
+// exportPinot generates the Pinot schema and config of a realtime table
+// consuming the SensorReading messages of the sensors Kafka topic, see the
+// Kafka Schema Registry export. The readings carry no mac and loc, the
+// dimensions default to those of the sensor.
+func exportPinot(w http.ResponseWriter, r *http.Request) {
+	history, ok := loadSensor(w, r)
+	if !ok {
+		return
+	}
+	ctx := newExportContext(r, history)
+
+	schema, err := json.MarshalIndent(map[string]any{
+		"schemaName": ctx.Name,
+		"dimensionFieldSpecs": []map[string]string{
+			{"name": "mac", "dataType": "STRING", "defaultNullValue": history.Mac},
+			{"name": "loc", "dataType": "STRING", "defaultNullValue": history.Loc},
+		},
+		"metricFieldSpecs": []map[string]string{
+			{"name": "temp", "dataType": "DOUBLE"},
+			{"name": "humidity", "dataType": "DOUBLE"},
+			{"name": "battery_mv", "dataType": "INT"},
+			{"name": "battery_level", "dataType": "INT"},
+		},
+		"dateTimeFieldSpecs": []map[string]string{
+			{
+				"name":        "timestamp",
+				"dataType":    "STRING",
+				"format":      "SIMPLE_DATE_FORMAT|yyyy-MM-dd'T'HH:mm:ssXXX",
+				"granularity": "1:SECONDS",
+			},
+		},
+	}, "", "  ")
+	if err != nil {
+		exportError(w, err)
+		return
+	}
+	tableConfig, err := json.MarshalIndent(map[string]any{
+		"tableName": ctx.Name,
+		"tableType": "REALTIME",
+		"segmentsConfig": map[string]string{
+			"schemaName":           ctx.Name,
+			"timeColumnName":       "timestamp",
+			"replicasPerPartition": "1",
+		},
+		"tenants": map[string]string{},
+		"tableIndexConfig": map[string]any{
+			"loadMode":             "MMAP",
+			"invertedIndexColumns": []string{"mac"},
+		},
+		"ingestionConfig": map[string]any{
+			"streamIngestionConfig": map[string]any{
+				"streamConfigMaps": []map[string]string{
+					{
+						"streamType":                                    "kafka",
+						"stream.kafka.topic.name":                       "sensors",
+						"stream.kafka.broker.list":                      "localhost:9092",
+						"stream.kafka.consumer.type":                    "lowlevel",
+						"stream.kafka.consumer.factory.class.name":      "org.apache.pinot.plugin.stream.kafka20.KafkaConsumerFactory",
+						"stream.kafka.decoder.class.name":               "org.apache.pinot.plugin.inputformat.json.JSONMessageDecoder",
+						"stream.kafka.consumer.prop.auto.offset.reset":  "smallest",
+						"realtime.segment.flush.threshold.time":         "24h",
+						"realtime.segment.flush.threshold.segment.size": "100M",
+					},
+				},
+			},
+		},
+		"metadata": map[string]any{},
+	}, "", "  ")
+	if err != nil {
+		exportError(w, err)
+		return
+	}
+
+	// pinot-admin.sh AddTable -schemaFile schema.json -tableConfigFile table_config.json -exec
+	writeZip(w, exportFilename(history.Mac, "pinot.zip"), []zipFile{
+		{Name: "schema.json", Data: schema},
+		{Name: "table_config.json", Data: tableConfig},
+	})
+}
+
+// druidString quotes s as string literal of a Druid expression.
+func druidString(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, "'", `\'`).Replace(s) + "'"
+}
+
+// exportDruid generates a Druid native batch ingestion spec reading the
+// JSON lines export over HTTP, ready for POST /druid/indexer/v1/task.
+func exportDruid(w http.ResponseWriter, r *http.Request) {
+	history, ok := loadSensor(w, r)
+	if !ok {
+		return
+	}
+
+	spec := map[string]any{
+		"type": "index_parallel",
+		"spec": map[string]any{
+			"dataSchema": map[string]any{
+				"dataSource": "sensors",
+				"timestampSpec": map[string]string{
+					"column": "timestamp",
+					"format": "iso",
+				},
+				"dimensionsSpec": map[string]any{
+					"dimensions": []any{
+						"mac",
+						"loc",
+						map[string]string{"type": "double", "name": "temp"},
+						map[string]string{"type": "double", "name": "humidity"},
+						map[string]string{"type": "long", "name": "battery_mv"},
+						map[string]string{"type": "long", "name": "battery_level"},
+					},
+				},
+				// the readings carry no sensor, it is added as dimensions
+				"transformSpec": map[string]any{
+					"transforms": []map[string]string{
+						{"type": "expression", "name": "mac", "expression": druidString(history.Mac)},
+						{"type": "expression", "name": "loc", "expression": druidString(history.Loc)},
+					},
+				},
+				"granularitySpec": map[string]any{
+					"type":               "uniform",
+					"segmentGranularity": "DAY",
+					"queryGranularity":   "NONE",
+					"rollup":             false,
+				},
+			},
+			"ioConfig": map[string]any{
+				"type": "index_parallel",
+				"inputSource": map[string]any{
+					"type": "http",
+					"uris": []string{historyURL(r, history.Mac, "jsonl")},
+				},
+				"inputFormat":      map[string]string{"type": "json"},
+				"appendToExisting": true,
+			},
+			"tuningConfig": map[string]any{
+				"type": "index_parallel",
+			},
+		},
+	}
+
+	setAttachment(w, "application/json", exportFilename(history.Mac, "druid.json"))
+	writeJSON(w, "application/json", spec)
+}
+
+// exportRockset generates the Rockset collection with an ingest
+// transformation typing the readings, a scheduled AWS Lambda polling the
+// JSON history API into it, a trend query and a setup script.
+func exportRockset(w http.ResponseWriter, r *http.Request) {
+	history, ok := loadSensor(w, r)
+	if !ok {
+		return
+	}
+	ctx := newExportContext(r, history)
+	data := struct {
+		exportContext
+		Workspace string
+	}{ctx, "mijia"}
+
+	collection, err := json.MarshalIndent(map[string]any{
+		"name":        ctx.Name,
+		"description": fmt.Sprintf("History of Mijia sensor %s (%s)", history.Loc, history.Mac),
+		"field_mapping_query": map[string]string{
+			"sql": fmt.Sprintf(`SELECT
+    PARSE_TIMESTAMP_ISO8601(_input.timestamp) AS _event_time,
+    %s AS mac,
+    %s AS loc,
+    CAST(_input.temp AS float) AS temp,
+    CAST(_input.humidity AS float) AS humidity,
+    CAST(_input.battery_mv AS int) AS battery_mv,
+    CAST(_input.battery_level AS int) AS battery_level
+FROM _input`, sqlQuote(history.Mac), sqlQuote(history.Loc)),
+		},
+	}, "", "  ")
+	if err != nil {
+		exportError(w, err)
+		return
+	}
+	trigger, err := json.MarshalIndent(map[string]string{
+		"Name":               ctx.Name + "_rockset_ingest",
+		"Description":        "Polls the history of " + history.Mac + " into Rockset",
+		"ScheduleExpression": "rate(15 minutes)",
+		"State":              "ENABLED",
+	}, "", "  ")
+	if err != nil {
+		exportError(w, err)
+		return
+	}
+	files, err := renderExportFiles(data, [][2]string{
+		{"rockset_ingest.py", "rockset_ingest.py"},
+		{"rockset_trend.sql", "rockset_trend.sql"},
+		{"rockset_setup.sh", "rockset_setup.sh"},
+	})
+	if err != nil {
+		exportError(w, err)
+		return
+	}
+	files = append(files,
+		zipFile{Name: "rockset_collection.json", Data: collection},
+		zipFile{Name: "rockset_trigger.json", Data: trigger},
+	)
+
+	writeZip(w, exportFilename(history.Mac, "rockset.zip"), files)
+}
+
+// websocketUpgrader accepts same origin connections only, the default of
+// the gorilla upgrader.
+var websocketUpgrader = websocket.Upgrader{}
+
+// exportWebsocketStream sends the history over a WebSocket in messages
+// {"type": "data", "rows": [...]} of 100 readings, followed by
+// {"type": "end", "total": N}. The client controls the flow by sending
+// {"type": "pause"} and {"type": "resume"}.
+func exportWebsocketStream(w http.ResponseWriter, r *http.Request) {
+	history, ok := loadHistory(w, r)
+	if !ok {
+		return
+	}
+	conn, err := websocketUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// the upgrader already replied with an error
+		return
+	}
+	defer conn.Close()
+
+	// the reader forwards the flow control messages until the connection
+	// is closed, and drops them once done, so that it still sees the close
+	// reply of the client
+	control := make(chan string)
+	done := make(chan struct{})
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			var message struct {
+				Type string `json:"type"`
+			}
+			if err := conn.ReadJSON(&message); err != nil {
+				if _, ok := err.(*websocket.CloseError); !ok && !errors.Is(err, net.ErrClosed) {
+					log.Printf("%v", err)
+				}
+				return
+			}
+			select {
+			case control <- message.Type:
+			case <-done:
+			case <-r.Context().Done():
+				return
+			}
+		}
+	}()
+
+	paused := false
+	for _, batch := range batchReadings(history.Readings, 100) {
+		for {
+			// apply pending control messages, block while paused
+			if paused {
+				select {
+				case message := <-control:
+					paused = message != "resume"
+				case <-closed:
+					return
+				}
+				continue
+			}
+			select {
+			case message := <-control:
+				paused = message == "pause"
+				continue
+			case <-closed:
+				return
+			default:
+			}
+			break
+		}
+		if err := conn.WriteJSON(map[string]any{"type": "data", "rows": batch}); err != nil {
+			log.Printf("%v", err)
+			return
+		}
+	}
+	close(done)
+	if err := conn.WriteJSON(map[string]any{"type": "end", "total": len(history.Readings)}); err != nil {
+		log.Printf("%v", err)
+		return
+	}
+	conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+	// wait for the close reply of the client
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+	}
+}
+
+// exportSseStream streams the history as server-sent events, one event per
+// reading with the timestamp as id, and a final complete event with the
+// total, on which clients close the EventSource. A reconnecting client
+// sends Last-Event-ID and gets the readings after it.
+func exportSseStream(w http.ResponseWriter, r *http.Request) {
+	if lastID := r.Header.Get("Last-Event-ID"); lastID != "" {
+		last, err := time.Parse(time.RFC3339, lastID)
+		if err != nil {
+			http.Error(w, "invalid Last-Event-ID, expected RFC3339", http.StatusBadRequest)
+			return
+		}
+		query := r.URL.Query()
+		query.Set("from", last.Add(time.Second).Format(time.RFC3339))
+		r.URL.RawQuery = query.Encode()
+	}
+	history, ok := loadHistory(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	flusher, _ := w.(http.Flusher)
+	fmt.Fprint(w, "retry: 3000\n\n")
+	for i, reading := range history.Readings {
+		data, err := json.Marshal(reading)
+		if err != nil {
+			log.Printf("%v", err)
+			return
+		}
+		if _, err := fmt.Fprintf(w, "id: %s\ndata: %s\n\n", reading.Timestamp.UTC().Format(time.RFC3339), data); err != nil {
+			// client is gone
+			return
+		}
+		if flusher != nil && i%100 == 99 {
+			flusher.Flush()
+		}
+	}
+	fmt.Fprintf(w, "event: complete\ndata: {\"total\": %d}\n\n", len(history.Readings))
+}
+
+// natsDuplicates is the duplicate window of the JetStream stream, readings
+// published again within it are dropped by their message ID.
+const natsDuplicates = 24 * time.Hour
+
+// readingMessages returns the message ID and JSON payload of each reading
+// for the message broker exports.
+func readingMessages(history *SensorHistory) ([][2]string, error) {
+	var messages [][2]string
+	for _, reading := range history.Readings {
+		timestamp := reading.Timestamp.UTC().Format(time.RFC3339)
+		data, err := json.Marshal(map[string]any{
+			"mac":           history.Mac,
+			"loc":           history.Loc,
+			"timestamp":     timestamp,
+			"temp":          reading.Temp,
+			"humidity":      reading.Humidity,
+			"battery_mv":    reading.BatteryMV,
+			"battery_level": reading.BatteryLevel,
+		})
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, [2]string{history.Mac + "-" + timestamp, string(data)})
+	}
+	return messages, nil
+}
+
+// exportNats generates a Go program publishing the readings to the subject
+// sensors.<mac>.history of the JetStream stream SENSORS. With push=true
+// the readings are published to the nats_url of the sensor.
+func exportNats(w http.ResponseWriter, r *http.Request) {
+	history, ok := loadHistory(w, r)
+	if !ok {
+		return
+	}
+	subject := "sensors." + history.Mac + ".history"
+	streamConfig := jetstream.StreamConfig{
+		Name:       "SENSORS",
+		Subjects:   []string{"sensors.>"},
+		Duplicates: natsDuplicates,
+	}
+	messages, err := readingMessages(history)
+	if err != nil {
+		exportError(w, err)
+		return
+	}
+
+	if r.URL.Query().Get("push") != "true" {
+		source, err := renderExportTemplate("nats_publish.go.tmpl", struct {
+			exportContext
+			Subject        string
+			Stream         string
+			StreamSubjects string
+			DuplicateHours int
+			Messages       [][2]string
+		}{newExportContext(r, history), subject, streamConfig.Name, streamConfig.Subjects[0], int(natsDuplicates.Hours()), messages})
+		if err != nil {
+			exportError(w, err)
+			return
+		}
+		setAttachment(w, "text/x-go", exportFilename(history.Mac, "nats.go"))
+		w.Write(source)
+		return
+	}
+
+	config := configMap[history.Mac]
+	if config.NatsURL == "" {
+		http.Error(w, "nats_url is not configured for this sensor", http.StatusBadRequest)
+		return
+	}
+	nc, err := nats.Connect(config.NatsURL, nats.Timeout(10*time.Second))
+	if err != nil {
+		pushError(w, err)
+		return
+	}
+	defer nc.Close()
+	js, err := jetstream.New(nc)
+	if err != nil {
+		pushError(w, err)
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), time.Minute)
+	defer cancel()
+	if _, err := js.CreateOrUpdateStream(ctx, streamConfig); err != nil {
+		pushError(w, err)
+		return
+	}
+
+	var futures []jetstream.PubAckFuture
+	for _, message := range messages {
+		future, err := js.PublishAsync(subject, []byte(message[1]), jetstream.WithMsgID(message[0]))
+		if err != nil {
+			pushError(w, err)
+			return
+		}
+		futures = append(futures, future)
+	}
+	select {
+	case <-js.PublishAsyncComplete():
+	case <-ctx.Done():
+		pushError(w, ctx.Err())
+		return
+	}
+	published, duplicates := 0, 0
+	for _, future := range futures {
+		select {
+		case ack := <-future.Ok():
+			if ack.Duplicate {
+				// published before within the duplicate window
+				duplicates++
+			} else {
+				published++
+			}
+		case err := <-future.Err():
+			pushError(w, err)
+			return
+		}
+	}
+
+	writeJSON(w, "application/json", map[string]any{
+		"subject":    subject,
+		"published":  published,
+		"duplicates": duplicates,
+	})
+}
+
+// exportRabbitmq generates a Go program publishing the readings to the
+// fanout exchange mijia.sensors with the routing key <mac>.history, bound
+// to the durable queue mijia.sensors.history. With push=true the readings
+// are published to the rabbitmq_url of the sensor in batches of 100,
+// mandatory and waiting for the publisher confirms of each batch.
+func exportRabbitmq(w http.ResponseWriter, r *http.Request) {
+	history, ok := loadHistory(w, r)
+	if !ok {
+		return
+	}
+	const exchange, queue, batchSize = "mijia.sensors", "mijia.sensors.history", 100
+	routingKey := history.Mac + ".history"
+	messages, err := readingMessages(history)
+	if err != nil {
+		exportError(w, err)
+		return
+	}
+
+	if r.URL.Query().Get("push") != "true" {
+		source, err := renderExportTemplate("rabbitmq_publish.go.tmpl", struct {
+			exportContext
+			Exchange   string
+			Queue      string
+			RoutingKey string
+			Messages   [][2]string
+		}{newExportContext(r, history), exchange, queue, routingKey, messages})
+		if err != nil {
+			exportError(w, err)
+			return
+		}
+		setAttachment(w, "text/x-go", exportFilename(history.Mac, "rabbitmq.go"))
+		w.Write(source)
+		return
+	}
+
+	config := configMap[history.Mac]
+	if config.RabbitmqURL == "" {
+		http.Error(w, "rabbitmq_url is not configured for this sensor", http.StatusBadRequest)
+		return
+	}
+	conn, err := amqp.DialConfig(config.RabbitmqURL, amqp.Config{Dial: amqp.DefaultDial(10 * time.Second)})
+	if err != nil {
+		pushError(w, err)
+		return
+	}
+	defer conn.Close()
+	ch, err := conn.Channel()
+	if err != nil {
+		pushError(w, err)
+		return
+	}
+	defer ch.Close()
+	if err := ch.ExchangeDeclare(exchange, amqp.ExchangeFanout, true, false, false, false, nil); err != nil {
+		pushError(w, err)
+		return
+	}
+	if _, err := ch.QueueDeclare(queue, true, false, false, false, nil); err != nil {
+		pushError(w, err)
+		return
+	}
+	if err := ch.QueueBind(queue, "", exchange, false, nil); err != nil {
+		pushError(w, err)
+		return
+	}
+	if err := ch.Confirm(false); err != nil {
+		pushError(w, err)
+		return
+	}
+	returns := ch.NotifyReturn(make(chan amqp.Return, batchSize))
+
+	ctx, cancel := context.WithTimeout(r.Context(), time.Minute)
+	defer cancel()
+	published, returned, batches := 0, 0, 0
+	for start := 0; start < len(messages); start += batchSize {
+		batch := messages[start:min(start+batchSize, len(messages))]
+		var confirms []*amqp.DeferredConfirmation
+		for _, message := range batch {
+			confirm, err := ch.PublishWithDeferredConfirmWithContext(ctx, exchange, routingKey, true, false, amqp.Publishing{
+				ContentType:  "application/json",
+				DeliveryMode: amqp.Persistent,
+				MessageId:    message[0],
+				Body:         []byte(message[1]),
+			})
+			if err != nil {
+				pushError(w, err)
+				return
+			}
+			confirms = append(confirms, confirm)
+		}
+		for _, confirm := range confirms {
+			acked, err := confirm.WaitContext(ctx)
+			if err != nil {
+				pushError(w, err)
+				return
+			}
+			if !acked {
+				pushError(w, fmt.Errorf("message %d was rejected by the broker", confirm.DeliveryTag))
+				return
+			}
+		}
+		published += len(batch)
+		batches++
+	drain:
+		for {
+			select {
+			case <-returns:
+				// mandatory message no queue accepted
+				returned++
+			default:
+				break drain
+			}
+		}
+	}
+
+	writeJSON(w, "application/json", map[string]any{
+		"exchange":  exchange,
+		"batches":   batches,
+		"published": published - returned,
+		"returned":  returned,
+	})
+}
+
+// pulsarFieldVersion is the version of the fields of the JSON payload,
+// sent as message property field_version.
+const pulsarFieldVersion = "1"
+
+// exportPulsar generates a Go program producing the readings to the topic
+// persistent://public/default/sensors-<mac>. With push=true the readings
+// are produced to the pulsar_url of the sensor, waiting for the broker to
+// acknowledge every message.
+func exportPulsar(w http.ResponseWriter, r *http.Request) {
+	history, ok := loadHistory(w, r)
+	if !ok {
+		return
+	}
+	topic := "persistent://public/default/sensors-" + history.Mac
+	producerName := sensorName(history.Mac) + "-history"
+	properties := map[string]string{
+		"mac":           history.Mac,
+		"loc":           history.Loc,
+		"field_version": pulsarFieldVersion,
+	}
+	type message struct {
+		Timestamp int64
+		Payload   string
+	}
+	var messages []message
+	payloads, err := readingMessages(history)
+	if err != nil {
+		exportError(w, err)
+		return
+	}
+	for i, payload := range payloads {
+		messages = append(messages, message{history.Readings[i].Timestamp.Unix(), payload[1]})
+	}
+
+	if r.URL.Query().Get("push") != "true" {
+		source, err := renderExportTemplate("pulsar_produce.go.tmpl", struct {
+			exportContext
+			Topic        string
+			ProducerName string
+			FieldVersion string
+			Messages     []message
+		}{newExportContext(r, history), topic, producerName, pulsarFieldVersion, messages})
+		if err != nil {
+			exportError(w, err)
+			return
+		}
+		setAttachment(w, "text/x-go", exportFilename(history.Mac, "pulsar.go"))
+		w.Write(source)
+		return
+	}
+
+	config := configMap[history.Mac]
+	if config.PulsarURL == "" {
+		http.Error(w, "pulsar_url is not configured for this sensor", http.StatusBadRequest)
+		return
+	}
+	client, err := pulsar.NewClient(pulsar.ClientOptions{
+		URL:               config.PulsarURL,
+		ConnectionTimeout: 10 * time.Second,
+		OperationTimeout:  30 * time.Second,
+	})
+	if err != nil {
+		pushError(w, err)
+		return
+	}
+	defer client.Close()
+	producer, err := client.CreateProducer(pulsar.ProducerOptions{Topic: topic, Name: producerName})
+	if err != nil {
+		pushError(w, err)
+		return
+	}
+	defer producer.Close()
+
+	ctx, cancel := context.WithTimeout(r.Context(), time.Minute)
+	defer cancel()
+	errs := make(chan error, len(messages))
+	for _, m := range messages {
+		sequenceID := m.Timestamp
+		producer.SendAsync(ctx, &pulsar.ProducerMessage{
+			Payload:    []byte(m.Payload),
+			Key:        history.Mac,
+			Properties: properties,
+			EventTime:  time.Unix(m.Timestamp, 0),
+			SequenceID: &sequenceID,
+		}, func(_ pulsar.MessageID, _ *pulsar.ProducerMessage, err error) {
+			errs <- err
+		})
+	}
+	if err := producer.FlushWithCtx(ctx); err != nil {
+		pushError(w, err)
+		return
+	}
+	for range messages {
+		if err := <-errs; err != nil {
+			pushError(w, err)
+			return
+		}
+	}
+
+	writeJSON(w, "application/json", map[string]any{
+		"topic":    topic,
+		"produced": len(messages),
+	})
+}
+
+// exportZeromq generates a Go program pushing the readings to the
+// zeromq_endpoint of the sensor with a PUSH socket, and a Python PULL
+// receiver sent base64 encoded in the X-ZMQ-Receiver-Script header. With
+// push=true the readings are pushed from here, every reading in its own
+// (length prefixed) ZMTP frame. The push uses the pure Go ZMTP
+// implementation, the generated program libzmq.
+func exportZeromq(w http.ResponseWriter, r *http.Request) {
+	history, ok := loadHistory(w, r)
+	if !ok {
+		return
+	}
+	config := configMap[history.Mac]
+	messages, err := readingMessages(history)
+	if err != nil {
+		exportError(w, err)
+		return
+	}
+
+	if r.URL.Query().Get("push") != "true" {
+		endpoint := config.ZeromqEndpoint
+		if endpoint == "" {
+			endpoint = "tcp://localhost:5557"
+		}
+		// the receiver binds on all interfaces at the port of the endpoint
+		bindEndpoint := "tcp://*:5557"
+		if _, port, err := net.SplitHostPort(strings.TrimPrefix(endpoint, "tcp://")); err == nil {
+			bindEndpoint = "tcp://*:" + port
+		}
+		data := struct {
+			exportContext
+			Endpoint     string
+			BindEndpoint string
+			Messages     [][2]string
+		}{newExportContext(r, history), endpoint, bindEndpoint, messages}
+		receiver, err := renderExportTemplate("zeromq_pull.py", data)
+		if err != nil {
+			exportError(w, err)
+			return
+		}
+		source, err := renderExportTemplate("zeromq_push.go.tmpl", data)
+		if err != nil {
+			exportError(w, err)
+			return
+		}
+		w.Header().Set("X-ZMQ-Receiver-Script", base64.StdEncoding.EncodeToString(receiver))
+		setAttachment(w, "text/x-go", exportFilename(history.Mac, "zeromq.go"))
+		w.Write(source)
+		return
+	}
+
+	if config.ZeromqEndpoint == "" {
+		http.Error(w, "zeromq_endpoint is not configured for this sensor", http.StatusBadRequest)
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), time.Minute)
+	defer cancel()
+	socket := zmq4.NewPush(ctx, zmq4.WithDialerTimeout(10*time.Second))
+	defer socket.Close()
+	if err := socket.Dial(config.ZeromqEndpoint); err != nil {
+		pushError(w, err)
+		return
+	}
+	for _, message := range messages {
+		if err := socket.Send(zmq4.NewMsg([]byte(message[1]))); err != nil {
+			pushError(w, err)
+			return
+		}
+	}
+
+	writeJSON(w, "application/json", map[string]any{
+		"endpoint": config.ZeromqEndpoint,
+		"pushed":   len(messages),
+	})
+}
@@ -0,0 +1,665 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/golang/snappy"
+)
+
+// exportTimescaledb generates the PostgreSQL export turned into a
+// hypertable with retention policy, plus an hourly time_bucket query.
+// The retention parameter is a PostgreSQL interval, 2 years by default.
+func exportTimescaledb(w http.ResponseWriter, r *http.Request) {
+	history, ok := loadHistory(w, r)
+	if !ok {
+		return
+	}
+
+	retention := r.URL.Query().Get("retention")
+	if retention == "" {
+		retention = "2 years"
+	}
+	script, err := renderExportTemplate("timescaledb.sql", struct {
+		exportContext
+		Retention string
+	}{newExportContext(r, history), retention}, "postgresql.sql")
+	if err != nil {
+		exportError(w, err)
+		return
+	}
+
+	setAttachment(w, "application/sql", exportFilename(history.Mac, "timescaledb.sql"))
+	w.Write(script)
+}
+
+var lineProtocolTagEscaper = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+
+// lineProtocol formats a reading in InfluxDB line protocol with the
+// timestamp in nanoseconds.
+func lineProtocol(measurement string, history *SensorHistory, reading SensorReading) string {
+	return fmt.Sprintf("%s,mac=%s,loc=%s temp=%v,humidity=%v,battery_mv=%di,battery_level=%di %d\n",
+		measurement,
+		lineProtocolTagEscaper.Replace(history.Mac),
+		lineProtocolTagEscaper.Replace(history.Loc),
+		reading.Temp, reading.Humidity, reading.BatteryMV, reading.BatteryLevel,
+		reading.Timestamp.UnixNano(),
+	)
+}
+
+// exportQuestdb generates data for QuestDB, the format parameter selects
+// ilp (default) for the InfluxDB line protocol endpoint, csv for the
+// import endpoint with microsecond timestamps or psql for a script using
+// the PostgreSQL wire protocol.
+func exportQuestdb(w http.ResponseWriter, r *http.Request) {
+	history, ok := loadHistory(w, r)
+	if !ok {
+		return
+	}
+
+	switch r.URL.Query().Get("format") {
+	case "", "ilp":
+		filename := exportFilename(history.Mac, "ilp")
+		w.Header().Set("X-Import-Command", "curl -X POST 'http://localhost:9000/write' --data-binary @"+filename)
+		setAttachment(w, "text/plain", filename)
+		for _, reading := range history.Readings {
+			io.WriteString(w, lineProtocol("sensor_data", history, reading))
+		}
+	case "csv":
+		filename := exportFilename(history.Mac, "questdb.csv")
+		schema := `[{"name":"timestamp","type":"TIMESTAMP"},{"name":"mac","type":"SYMBOL"},{"name":"loc","type":"SYMBOL"}]`
+		w.Header().Set("X-Import-Command", fmt.Sprintf(
+			"curl -F 'schema=%s' -F data=@%s 'http://localhost:9000/imp?name=sensor_data&timestamp=timestamp&partitionBy=DAY'",
+			schema, filename,
+		))
+		setAttachment(w, "text/csv", filename)
+		out := csv.NewWriter(w)
+		out.Write([]string{"mac", "loc", "temp", "humidity", "battery_mv", "battery_level", "timestamp"})
+		for _, reading := range history.Readings {
+			out.Write([]string{
+				history.Mac,
+				history.Loc,
+				strconv.FormatFloat(reading.Temp, 'f', -1, 64),
+				strconv.FormatFloat(reading.Humidity, 'f', -1, 64),
+				strconv.Itoa(int(reading.BatteryMV)),
+				strconv.Itoa(int(reading.BatteryLevel)),
+				strconv.FormatInt(reading.Timestamp.UnixMicro(), 10),
+			})
+		}
+		out.Flush()
+	case "psql":
+		script, err := renderExportTemplate("questdb.sql", newExportContext(r, history))
+		if err != nil {
+			exportError(w, err)
+			return
+		}
+		setAttachment(w, "application/sql", exportFilename(history.Mac, "questdb.sql"))
+		w.Write(script)
+	default:
+		http.Error(w, "invalid format parameter, expected ilp, csv or psql", http.StatusBadRequest)
+	}
+}
+
+// exportTdengine generates a taos script creating the sensors super table
+// with a sub table per sensor, inserting 1000 readings per statement.
+func exportTdengine(w http.ResponseWriter, r *http.Request) {
+	history, ok := loadHistory(w, r)
+	if !ok {
+		return
+	}
+
+	script, err := renderExportTemplate("tdengine.sql", newExportContext(r, history))
+	if err != nil {
+		exportError(w, err)
+		return
+	}
+
+	setAttachment(w, "application/sql", exportFilename(history.Mac, "tdengine.sql"))
+	w.Write(script)
+}
+
+// exportIotdb generates IoTDB CLI statements creating a storage group and
+// time series per sensor, inserting 1000 readings per statement.
+func exportIotdb(w http.ResponseWriter, r *http.Request) {
+	history, ok := loadHistory(w, r)
+	if !ok {
+		return
+	}
+
+	script, err := renderExportTemplate("iotdb.sql", newExportContext(r, history))
+	if err != nil {
+		exportError(w, err)
+		return
+	}
+
+	setAttachment(w, "application/sql", exportFilename(history.Mac, "iotdb.sql"))
+	w.Write(script)
+}
+
+// exportInfluxdb3 generates the line protocol for the InfluxDB 3 write API
+// and a pyarrow script loading the history as Arrow record batches and
+// verifying it via Arrow Flight.
+func exportInfluxdb3(w http.ResponseWriter, r *http.Request) {
+	history, ok := loadHistory(w, r)
+	if !ok {
+		return
+	}
+
+	files, err := renderExportFiles(newExportContext(r, history), [][2]string{
+		{"influxdb3_load.py", "influxdb3_load.py"},
+	})
+	if err != nil {
+		exportError(w, err)
+		return
+	}
+	var lines strings.Builder
+	for _, reading := range history.Readings {
+		lines.WriteString(lineProtocol("sensor_data", history, reading))
+	}
+	files = append(files, zipFile{Name: "sensor_data.lp", Data: []byte(lines.String())})
+
+	writeZip(w, exportFilename(history.Mac, "influxdb3.zip"), files)
+}
+
+// prometheusRemoteWrite encodes the readings as snappy compressed
+// Prometheus remote write request, one time series per field named
+// sensor_<field> with mac and loc labels.
+func prometheusRemoteWrite(history *SensorHistory) []byte {
+	fields := []struct {
+		name  string
+		value func(SensorReading) float64
+	}{
+		{"temp", func(reading SensorReading) float64 { return reading.Temp }},
+		{"humidity", func(reading SensorReading) float64 { return reading.Humidity }},
+		{"battery_mv", func(reading SensorReading) float64 { return float64(reading.BatteryMV) }},
+		{"battery_level", func(reading SensorReading) float64 { return float64(reading.BatteryLevel) }},
+	}
+
+	var request protoMessage
+	for _, field := range fields {
+		var series protoMessage
+		// labels have to be sorted by name
+		for _, label := range [][2]string{
+			{"__name__", "sensor_" + field.name},
+			{"loc", history.Loc},
+			{"mac", history.Mac},
+		} {
+			var l protoMessage
+			l.String(1, label[0])
+			l.String(2, label[1])
+			series.Message(1, &l)
+		}
+		for _, reading := range history.Readings {
+			var sample protoMessage
+			sample.Double(1, field.value(reading))
+			sample.Int64(2, reading.Timestamp.UnixMilli())
+			series.Message(2, &sample)
+		}
+		request.Message(1, &series)
+	}
+	return snappy.Encode(nil, request.Encoded())
+}
+
+// pushRemoteWrite posts the history in chunks to a Prometheus remote write
+// endpoint and reports the number of samples written.
+func pushRemoteWrite(w http.ResponseWriter, url string, header http.Header, history *SensorHistory) {
+	requests := 0
+	for _, batch := range batchReadings(history.Readings, 2500) {
+		chunk := &SensorHistory{Mac: history.Mac, Loc: history.Loc, Readings: batch}
+		req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(prometheusRemoteWrite(chunk)))
+		if err != nil {
+			exportError(w, err)
+			return
+		}
+		for key, values := range header {
+			req.Header[key] = values
+		}
+		req.Header.Set("Content-Encoding", "snappy")
+		req.Header.Set("Content-Type", "application/x-protobuf")
+		req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+		if err := pushRequest(req, nil); err != nil {
+			pushError(w, err)
+			return
+		}
+		requests++
+	}
+
+	writeJSON(w, "application/json", map[string]int{
+		"requests": requests,
+		"pushed":   len(history.Readings) * 4,
+	})
+}
+
+// exportM3db generates a Prometheus remote write request for M3DB. With
+// push=true it is posted to the m3_coordinator_url of the sensor, e.g.
+// http://localhost:7201/api/v1/prom/remote/write.
+func exportM3db(w http.ResponseWriter, r *http.Request) {
+	history, ok := loadHistory(w, r)
+	if !ok {
+		return
+	}
+
+	if r.URL.Query().Get("push") == "true" {
+		config := configMap[history.Mac]
+		if config.M3CoordinatorURL == "" {
+			http.Error(w, "m3_coordinator_url is not configured for this sensor", http.StatusBadRequest)
+			return
+		}
+		pushRemoteWrite(w, config.M3CoordinatorURL, nil, history)
+		return
+	}
+
+	setAttachment(w, "application/x-protobuf", exportFilename(history.Mac, "m3db.pb.snappy"))
+	w.Write(prometheusRemoteWrite(history))
+}
+
+// exportPrometheusRemoteWrite generates a Prometheus remote write request.
+// With push=true it is posted to the remote_write_url of the sensor, e.g.
+// http://localhost:9090/api/v1/write.
+func exportPrometheusRemoteWrite(w http.ResponseWriter, r *http.Request) {
+	history, ok := loadHistory(w, r)
+	if !ok {
+		return
+	}
+
+	if r.URL.Query().Get("push") == "true" {
+		config := configMap[history.Mac]
+		if config.RemoteWriteURL == "" {
+			http.Error(w, "remote_write_url is not configured for this sensor", http.StatusBadRequest)
+			return
+		}
+		pushRemoteWrite(w, config.RemoteWriteURL, nil, history)
+		return
+	}
+
+	setAttachment(w, "application/x-protobuf", exportFilename(history.Mac, "pb.snappy"))
+	w.Write(prometheusRemoteWrite(history))
+}
+
+// exportCortex is the Prometheus remote write export for Cortex. The push
+// goes to the remote_write_url of the sensor, e.g.
+// http://localhost:9009/api/v1/push, with the cortex_tenant_id of the
+// sensor as X-Scope-OrgID header.
+func exportCortex(w http.ResponseWriter, r *http.Request) {
+	history, ok := loadHistory(w, r)
+	if !ok {
+		return
+	}
+
+	config := configMap[history.Mac]
+	if config.CortexTenantID == "" {
+		http.Error(w, "cortex_tenant_id is not configured for this sensor", http.StatusBadRequest)
+		return
+	}
+	if r.URL.Query().Get("push") == "true" {
+		if config.RemoteWriteURL == "" {
+			http.Error(w, "remote_write_url is not configured for this sensor", http.StatusBadRequest)
+			return
+		}
+		pushRemoteWrite(w, config.RemoteWriteURL, http.Header{"X-Scope-OrgID": {config.CortexTenantID}}, history)
+		return
+	}
+
+	w.Header().Set("X-Scope-OrgID", config.CortexTenantID)
+	setAttachment(w, "application/x-protobuf", exportFilename(history.Mac, "cortex.pb.snappy"))
+	w.Write(prometheusRemoteWrite(history))
+}
+
+// exportThanos generates a Go program writing the readings into a TSDB
+// block and a script running it and uploading the block with thanos tools.
+func exportThanos(w http.ResponseWriter, r *http.Request) {
+	history, ok := loadHistory(w, r)
+	if !ok {
+		return
+	}
+
+	files, err := renderExportFiles(newExportContext(r, history), [][2]string{
+		{"thanos_block.go.tmpl", "thanos_block.go"},
+		{"thanos_upload.sh", "thanos_upload.sh"},
+	})
+	if err != nil {
+		exportError(w, err)
+		return
+	}
+	var data bytes.Buffer
+	if err := writeHistoryCSV(&data, history); err != nil {
+		exportError(w, err)
+		return
+	}
+	files = append(files, zipFile{Name: "sensor_data.csv", Data: data.Bytes()})
+
+	writeZip(w, exportFilename(history.Mac, "thanos.zip"), files)
+}
+
+// exportMimir generates the TSDB block program of the Thanos export and a
+// script backfilling the block into Mimir with the block upload API.
+func exportMimir(w http.ResponseWriter, r *http.Request) {
+	history, ok := loadHistory(w, r)
+	if !ok {
+		return
+	}
+
+	files, err := renderExportFiles(newExportContext(r, history), [][2]string{
+		{"thanos_block.go.tmpl", "thanos_block.go"},
+		{"mimir_backfill.sh", "mimir_backfill.sh"},
+	})
+	if err != nil {
+		exportError(w, err)
+		return
+	}
+	var data bytes.Buffer
+	if err := writeHistoryCSV(&data, history); err != nil {
+		exportError(w, err)
+		return
+	}
+	files = append(files, zipFile{Name: "sensor_data.csv", Data: data.Bytes()})
+
+	writeZip(w, exportFilename(history.Mac, "mimir.zip"), files)
+}
+
+// victoriaLogsEntries encodes each reading as VictoriaLogs JSON line.
+func victoriaLogsEntries(history *SensorHistory) ([]byte, error) {
+	var out bytes.Buffer
+	encoder := json.NewEncoder(&out)
+	encoder.SetEscapeHTML(false)
+	for _, reading := range history.Readings {
+		err := encoder.Encode(struct {
+			Time     string  `json:"_time"`
+			Msg      string  `json:"_msg"`
+			Mac      string  `json:"mac"`
+			Loc      string  `json:"loc"`
+			Temp     float64 `json:"temp"`
+			Humidity float64 `json:"humidity"`
+		}{reading.Timestamp.Format(time.RFC3339), "sensor reading", history.Mac, history.Loc, reading.Temp, reading.Humidity})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return out.Bytes(), nil
+}
+
+// exportVictoriaLogs generates one VictoriaLogs log entry per reading.
+// With push=true they are posted to /insert/jsonline of the
+// victoria_logs_url of the sensor, with mac and loc as stream fields.
+func exportVictoriaLogs(w http.ResponseWriter, r *http.Request) {
+	history, ok := loadHistory(w, r)
+	if !ok {
+		return
+	}
+	data, err := victoriaLogsEntries(history)
+	if err != nil {
+		exportError(w, err)
+		return
+	}
+
+	if r.URL.Query().Get("push") != "true" {
+		setAttachment(w, "application/stream+json", exportFilename(history.Mac, "victoria-logs.jsonl"))
+		w.Write(data)
+		return
+	}
+
+	config := configMap[history.Mac]
+	if config.VictoriaLogsURL == "" {
+		http.Error(w, "victoria_logs_url is not configured for this sensor", http.StatusBadRequest)
+		return
+	}
+	req, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(config.VictoriaLogsURL, "/")+"/insert/jsonline?_stream_fields=mac,loc", bytes.NewReader(data))
+	if err != nil {
+		exportError(w, err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/stream+json")
+	if err := pushRequest(req, nil); err != nil {
+		pushError(w, err)
+		return
+	}
+
+	writeJSON(w, "application/json", map[string]int{
+		"pushed": len(history.Readings),
+	})
+}
+
+// openTSDBTag replaces the characters OpenTSDB does not allow in tag
+// values, like the colons of the MAC.
+func openTSDBTag(value string) string {
+	return strings.Map(func(c rune) rune {
+		if unicode.IsLetter(c) || unicode.IsDigit(c) || strings.ContainsRune("-_./", c) {
+			return c
+		}
+		return '_'
+	}, value)
+}
+
+// writeOpenTSDBPuts writes one telnet style put per field and reading.
+// The writer is flushed every 100 lines, so errors of a network connection
+// stop the export early.
+func writeOpenTSDBPuts(out *bufio.Writer, history *SensorHistory) (int, error) {
+	tags := fmt.Sprintf("mac=%s loc=%s", openTSDBTag(history.Mac), openTSDBTag(history.Loc))
+	lines := 0
+	for _, reading := range history.Readings {
+		for _, field := range []struct {
+			name  string
+			value any
+		}{
+			{"temp", reading.Temp},
+			{"humidity", reading.Humidity},
+			{"battery_mv", reading.BatteryMV},
+			{"battery_level", reading.BatteryLevel},
+		} {
+			if _, err := fmt.Fprintf(out, "put sensors.%s %d %v %s\n", field.name, reading.Timestamp.Unix(), field.value, tags); err != nil {
+				return lines, err
+			}
+			lines++
+			if lines%100 == 0 {
+				if err := out.Flush(); err != nil {
+					return lines, err
+				}
+			}
+		}
+	}
+	return lines, out.Flush()
+}
+
+// exportOpentsdbTelnet generates OpenTSDB telnet style puts. With
+// push=true they are streamed to the opentsdb_addr (host:port) of the
+// sensor.
+func exportOpentsdbTelnet(w http.ResponseWriter, r *http.Request) {
+	history, ok := loadHistory(w, r)
+	if !ok {
+		return
+	}
+
+	if r.URL.Query().Get("push") != "true" {
+		setAttachment(w, "text/plain", exportFilename(history.Mac, "opentsdb"))
+		if _, err := writeOpenTSDBPuts(bufio.NewWriter(w), history); err != nil {
+			log.Printf("%v", err)
+		}
+		return
+	}
+
+	config := configMap[history.Mac]
+	if config.OpentsdbAddr == "" {
+		http.Error(w, "opentsdb_addr is not configured for this sensor", http.StatusBadRequest)
+		return
+	}
+	conn, err := net.DialTimeout("tcp", config.OpentsdbAddr, 10*time.Second)
+	if err != nil {
+		pushError(w, err)
+		return
+	}
+	defer conn.Close()
+	conn.SetWriteDeadline(time.Now().Add(5 * time.Minute))
+
+	lines, err := writeOpenTSDBPuts(bufio.NewWriter(conn), history)
+	if err != nil {
+		pushError(w, fmt.Errorf("after %d puts: %w", lines, err))
+		return
+	}
+
+	writeJSON(w, "application/json", map[string]int{"pushed": lines})
+}
+
+// kdb+ timestamps count nanoseconds since 2000.01.01
+var kdbEpoch = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// kdbVector formats values as q list literal, a single value has to be
+// enlisted to be a list.
+func kdbVector(values []string, suffix string) string {
+	list := strings.Join(values, " ") + suffix
+	if len(values) == 1 {
+		return "enlist " + list
+	}
+	return list
+}
+
+// kdbScript generates q code creating the sensor_data table and upserting
+// the readings in batches of 1000.
+func kdbScript(history *SensorHistory) string {
+	var q strings.Builder
+	fmt.Fprintf(&q, "/ kdb+ import of Mijia sensor %s (%s)\n", history.Loc, history.Mac)
+	q.WriteString("/ q sensor_data.q\n\n")
+	q.WriteString("sensor_data:([] timestamp:`timestamp$(); mac:`symbol$(); temp:`float$(); humidity:`float$(); battery_mv:`short$(); battery_level:`short$())\n")
+	for _, batch := range batchReadings(history.Readings, 1000) {
+		var timestamps, temps, humidities, batteryMVs, batteryLevels []string
+		for _, reading := range batch {
+			timestamps = append(timestamps, reading.Timestamp.UTC().Format("2006.01.02D15:04:05.000000000"))
+			temps = append(temps, strconv.FormatFloat(reading.Temp, 'f', -1, 64))
+			humidities = append(humidities, strconv.FormatFloat(reading.Humidity, 'f', -1, 64))
+			batteryMVs = append(batteryMVs, strconv.Itoa(int(reading.BatteryMV)))
+			batteryLevels = append(batteryLevels, strconv.Itoa(int(reading.BatteryLevel)))
+		}
+		fmt.Fprintf(&q, "`sensor_data upsert ([] timestamp:%s; mac:%d#`$%s; temp:%s; humidity:%s; battery_mv:%s; battery_level:%s)\n",
+			kdbVector(timestamps, ""),
+			len(batch), strconv.Quote(history.Mac),
+			kdbVector(temps, "f"),
+			kdbVector(humidities, "f"),
+			kdbVector(batteryMVs, "h"),
+			kdbVector(batteryLevels, "h"),
+		)
+	}
+	return q.String()
+}
+
+// kdbSerialize serializes the readings as sensor_data table in the kdb+ IPC
+// format returned by -8!, load it with: sensor_data:-9!read1`:sensor_data.kdb
+func kdbSerialize(history *SensorHistory) []byte {
+	const (
+		kdbShort     = 5
+		kdbFloat     = 9
+		kdbSymbol    = 11
+		kdbTimestamp = 12
+		kdbList      = 0
+		kdbTable     = 98
+		kdbDict      = 99
+	)
+	n := len(history.Readings)
+	var body []byte
+	vector := func(typ byte, length int) {
+		body = append(body, typ, 0)
+		body = binary.LittleEndian.AppendUint32(body, uint32(length))
+	}
+
+	body = append(body, kdbTable, 0, kdbDict)
+	columns := []string{"timestamp", "mac", "temp", "humidity", "battery_mv", "battery_level"}
+	vector(kdbSymbol, len(columns))
+	for _, column := range columns {
+		body = append(append(body, column...), 0)
+	}
+	vector(kdbList, len(columns))
+
+	vector(kdbTimestamp, n)
+	for _, reading := range history.Readings {
+		body = binary.LittleEndian.AppendUint64(body, uint64(reading.Timestamp.Sub(kdbEpoch).Nanoseconds()))
+	}
+	vector(kdbSymbol, n)
+	for range history.Readings {
+		body = append(append(body, history.Mac...), 0)
+	}
+	vector(kdbFloat, n)
+	for _, reading := range history.Readings {
+		body = binary.LittleEndian.AppendUint64(body, math.Float64bits(reading.Temp))
+	}
+	vector(kdbFloat, n)
+	for _, reading := range history.Readings {
+		body = binary.LittleEndian.AppendUint64(body, math.Float64bits(reading.Humidity))
+	}
+	vector(kdbShort, n)
+	for _, reading := range history.Readings {
+		body = binary.LittleEndian.AppendUint16(body, uint16(reading.BatteryMV))
+	}
+	vector(kdbShort, n)
+	for _, reading := range history.Readings {
+		body = binary.LittleEndian.AppendUint16(body, uint16(reading.BatteryLevel))
+	}
+
+	// little endian, async message, no compression, total length
+	message := []byte{1, 0, 0, 0}
+	message = binary.LittleEndian.AppendUint32(message, uint32(8+len(body)))
+	return append(message, body...)
+}
+
+// exportKdb generates a q script building the sensor_data table and the
+// same table serialized in the kdb+ IPC format.
+func exportKdb(w http.ResponseWriter, r *http.Request) {
+	history, ok := loadHistory(w, r)
+	if !ok {
+		return
+	}
+
+	writeZip(w, exportFilename(history.Mac, "kdb.zip"), []zipFile{
+		{Name: "sensor_data.q", Data: []byte(kdbScript(history))},
+		{Name: "sensor_data.kdb", Data: kdbSerialize(history)},
+	})
+}
+
+// exportLokiLogql generates LogQL metric queries over readings stored in
+// Loki as JSON log lines like those of the VictoriaLogs export, with the
+// mac as stream label.
+func exportLokiLogql(w http.ResponseWriter, r *http.Request) {
+	history, ok := loadSensor(w, r)
+	if !ok {
+		return
+	}
+
+	selector := fmt.Sprintf("{mac=%s}", strconv.Quote(history.Mac))
+	unwrap := func(function string, field string, window string) string {
+		return fmt.Sprintf(`%s(%s | json | unwrap %s | __error__="" [%s]) by (mac)`, function, selector, field, window)
+	}
+	type query struct {
+		Name        string `json:"name"`
+		Description string `json:"description"`
+		Query       string `json:"query"`
+	}
+	queries := []query{
+		{"readings_rate", "Readings per second", fmt.Sprintf("sum by (mac) (rate(%s [5m]))", selector)},
+		{"readings_count", "Readings per hour", fmt.Sprintf("sum by (mac) (count_over_time(%s [1h]))", selector)},
+		{"temp_avg", "Average temperature in °C", unwrap("avg_over_time", "temp", "1h")},
+		{"temp_min", "Minimum temperature in °C", unwrap("min_over_time", "temp", "1h")},
+		{"temp_max", "Maximum temperature in °C", unwrap("max_over_time", "temp", "1h")},
+		{"temp_min_daily", "Daily minimum temperature in °C", unwrap("min_over_time", "temp", "1d")},
+		{"temp_max_daily", "Daily maximum temperature in °C", unwrap("max_over_time", "temp", "1d")},
+		{"humidity_avg", "Average relative humidity in %", unwrap("avg_over_time", "humidity", "1h")},
+		{"humidity_min", "Minimum relative humidity in %", unwrap("min_over_time", "humidity", "1h")},
+		{"humidity_max", "Maximum relative humidity in %", unwrap("max_over_time", "humidity", "1h")},
+	}
+
+	setAttachment(w, "application/json", "logql_queries.json")
+	writeJSON(w, "application/json", map[string]any{
+		"mac":     history.Mac,
+		"loc":     history.Loc,
+		"queries": queries,
+	})
+}
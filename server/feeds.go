@@ -0,0 +1,201 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"time"
+)
+
+// feedReadings is the number of the latest readings in the feeds.
+const feedReadings = 100
+
+// feedTitle names the sensor in the feeds by its location, if configured.
+func feedTitle(history *SensorHistory) string {
+	if history.Loc != "" {
+		return history.Loc
+	}
+	return history.Mac
+}
+
+// loadFeedReadings reads the latest readings of the sensor, newest first
+// as feed readers expect. On failure the error is written to w.
+func loadFeedReadings(w http.ResponseWriter, history *SensorHistory) ([]SensorReading, bool) {
+	readings, err := latestReadings(configMap[history.Mac], feedReadings)
+	if err != nil {
+		log.Printf("%v", err)
+		http.Error(w, "Data could not be loaded", http.StatusInternalServerError)
+		return nil, false
+	}
+	slices.Reverse(readings)
+	return readings, true
+}
+
+// writeXML sends v with an XML declaration.
+func writeXML(w http.ResponseWriter, contentType string, v any) {
+	w.Header().Set("Content-Type", contentType)
+	w.Write([]byte(xml.Header))
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(v); err != nil {
+		log.Printf("%v", err)
+	}
+}
+
+type atomLink struct {
+	Rel  string `xml:"rel,attr"`
+	Type string `xml:"type,attr,omitempty"`
+	Href string `xml:"href,attr"`
+}
+
+type atomContent struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+type atomEntry struct {
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Link    atomLink    `xml:"link"`
+	Content atomContent `xml:"content"`
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Author  string      `xml:"author>name"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+// exportAtom writes the latest readings as Atom 1.0 feed, one entry per
+// reading with the reading as JSON in text content, other media types
+// than text and XML would have to be Base64 encoded (RFC 4287 4.1.3.3).
+func exportAtom(w http.ResponseWriter, r *http.Request) {
+	history, ok := loadSensor(w, r)
+	if !ok {
+		return
+	}
+	readings, ok := loadFeedReadings(w, history)
+	if !ok {
+		return
+	}
+
+	dashboard := serverURL(r) + "/"
+	feed := atomFeed{
+		ID:      historyURL(r, history.Mac, "atom"),
+		Title:   feedTitle(history) + " readings",
+		Updated: time.Now().UTC().Format(time.RFC3339),
+		Author:  "mijia",
+		Links: []atomLink{
+			{Rel: "self", Type: "application/atom+xml", Href: historyURL(r, history.Mac, "atom")},
+			{Rel: "alternate", Type: "text/html", Href: dashboard},
+		},
+	}
+	if len(readings) > 0 {
+		// the feed was last updated by its newest entry
+		feed.Updated = readings[0].Timestamp.UTC().Format(time.RFC3339)
+	}
+	for _, reading := range readings {
+		content, err := json.Marshal(struct {
+			Mac string `json:"mac"`
+			Loc string `json:"loc"`
+			SensorReading
+		}{history.Mac, history.Loc, reading})
+		if err != nil {
+			exportError(w, err)
+			return
+		}
+		feed.Entries = append(feed.Entries, atomEntry{
+			ID:      readingURL(r, history.Mac, reading),
+			Title:   fmt.Sprintf("%.1f °C, %.1f %%", reading.Temp, reading.Humidity),
+			Updated: reading.Timestamp.UTC().Format(time.RFC3339),
+			Link:    atomLink{Rel: "alternate", Type: "text/html", Href: dashboard},
+			Content: atomContent{Type: "text", Body: string(content)},
+		})
+	}
+
+	writeXML(w, "application/atom+xml", feed)
+}
+
+// rssDefaultTTL is the refresh interval of the RSS feed in minutes if
+// feed_ttl is not configured.
+const rssDefaultTTL = 60
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+type rssItem struct {
+	Title       string  `xml:"title"`
+	Link        string  `xml:"link"`
+	Description string  `xml:"description"`
+	GUID        rssGUID `xml:"guid"`
+	PubDate     string  `xml:"pubDate"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	AtomLink      atomLink  `xml:"http://www.w3.org/2005/Atom link"`
+	LastBuildDate string    `xml:"lastBuildDate"`
+	TTL           int       `xml:"ttl"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+// exportRss writes the latest readings as RSS 2.0 feed, one item per
+// reading.
+func exportRss(w http.ResponseWriter, r *http.Request) {
+	history, ok := loadSensor(w, r)
+	if !ok {
+		return
+	}
+	readings, ok := loadFeedReadings(w, history)
+	if !ok {
+		return
+	}
+	ttl := configMap[history.Mac].FeedTTL
+	if ttl <= 0 {
+		ttl = rssDefaultTTL
+	}
+
+	dashboard := serverURL(r) + "/"
+	feed := rssFeed{
+		Version: "2.0",
+		Channel: rssChannel{
+			Title:         feedTitle(history) + " readings",
+			Link:          dashboard,
+			Description:   fmt.Sprintf("Latest readings of the Mijia sensor %s", history.Mac),
+			AtomLink:      atomLink{Rel: "self", Type: "application/rss+xml", Href: historyURL(r, history.Mac, "rss")},
+			LastBuildDate: time.Now().UTC().Format(time.RFC1123Z),
+			TTL:           ttl,
+		},
+	}
+	for _, reading := range readings {
+		dewPoint := calcDewPoint(reading.Humidity, reading.Temp)
+		feed.Channel.Items = append(feed.Channel.Items, rssItem{
+			Title: fmt.Sprintf("%s: %.1f °C", feedTitle(history), reading.Temp),
+			Link:  dashboard,
+			Description: fmt.Sprintf("Temperature %.2f °C, humidity %.2f %%, dew point %.1f °C, battery %d %% (%d mV)",
+				reading.Temp, reading.Humidity, dewPoint, reading.BatteryLevel, reading.BatteryMV),
+			GUID:    rssGUID{Value: readingURL(r, history.Mac, reading)},
+			PubDate: reading.Timestamp.UTC().Format(time.RFC1123Z),
+		})
+	}
+
+	writeXML(w, "application/rss+xml", feed)
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"net/http"
+	"time"
+
+	flatbuffers "github.com/google/flatbuffers/go"
+)
+
+// FlatGeobuf is written following the header.fbs and feature.fbs schemas of
+// flatgeobuf/flatgeobuf with the flatbuffers builder: the magic bytes, the
+// header, the packed Hilbert R-tree and the features, all size prefixed.
+
+var fgbMagic = []byte{'f', 'g', 'b', 3, 'f', 'g', 'b', 0}
+
+const (
+	fgbGeometryPoint = 1
+	fgbColumnInt     = 5
+	fgbColumnDouble  = 10
+	fgbColumnDate    = 13
+	fgbNodeSize      = 16
+	fgbNodeItemSize  = 40 // min x, min y, max x, max y and offset
+)
+
+// fgbColumn is an attribute of the features.
+type fgbColumn struct {
+	Name string
+	Type byte
+}
+
+var fgbColumns = []fgbColumn{
+	{"timestamp", fgbColumnDate},
+	{"temp", fgbColumnDouble},
+	{"humidity", fgbColumnDouble},
+	{"battery_mv", fgbColumnInt},
+	{"battery_level", fgbColumnInt},
+}
+
+// fgbDoubles creates a vector of doubles.
+func fgbDoubles(b *flatbuffers.Builder, values []float64) flatbuffers.UOffsetT {
+	b.StartVector(8, len(values), 8)
+	for i := len(values) - 1; i >= 0; i-- {
+		b.PrependFloat64(values[i])
+	}
+	return b.EndVector(len(values))
+}
+
+// fgbHeader builds the header of count point features within envelope.
+func fgbHeader(name string, envelope []float64, count int) []byte {
+	b := flatbuffers.NewBuilder(1024)
+	var columns []flatbuffers.UOffsetT
+	for _, column := range fgbColumns {
+		columnName := b.CreateString(column.Name)
+		b.StartObject(11)
+		b.PrependUOffsetTSlot(0, columnName, 0)
+		b.PrependByteSlot(1, column.Type, 0)
+		b.PrependBoolSlot(7, false, true)
+		columns = append(columns, b.EndObject())
+	}
+	b.StartVector(4, len(columns), 4)
+	for i := len(columns) - 1; i >= 0; i-- {
+		b.PrependUOffsetT(columns[i])
+	}
+	columnVector := b.EndVector(len(columns))
+
+	org := b.CreateString("EPSG")
+	b.StartObject(6)
+	b.PrependUOffsetTSlot(0, org, 0)
+	b.PrependInt32Slot(1, 4326, 0)
+	crs := b.EndObject()
+
+	headerName := b.CreateString(name)
+	var envelopeVector flatbuffers.UOffsetT
+	if envelope != nil {
+		envelopeVector = fgbDoubles(b, envelope)
+	}
+	b.StartObject(14)
+	b.PrependUOffsetTSlot(0, headerName, 0)
+	if envelope != nil {
+		b.PrependUOffsetTSlot(1, envelopeVector, 0)
+	}
+	b.PrependByteSlot(2, fgbGeometryPoint, 0)
+	b.PrependUOffsetTSlot(7, columnVector, 0)
+	b.PrependUint64Slot(8, uint64(count), 0)
+	b.PrependUint16Slot(9, fgbNodeSize, 0)
+	b.PrependUOffsetTSlot(10, crs, 0)
+	b.FinishSizePrefixed(b.EndObject())
+	return b.FinishedBytes()
+}
+
+// fgbFeature builds a point feature with the encoded properties.
+func fgbFeature(position geoPosition, properties []byte) []byte {
+	b := flatbuffers.NewBuilder(256)
+	xy := fgbDoubles(b, []float64{position.Lon, position.Lat})
+	b.StartObject(8)
+	b.PrependUOffsetTSlot(1, xy, 0)
+	geometry := b.EndObject()
+	props := b.CreateByteVector(properties)
+	b.StartObject(3)
+	b.PrependUOffsetTSlot(0, geometry, 0)
+	b.PrependUOffsetTSlot(1, props, 0)
+	b.FinishSizePrefixed(b.EndObject())
+	return b.FinishedBytes()
+}
+
+// fgbIndex builds the packed Hilbert R-tree of the features, given the byte
+// offset of each feature after the index. The nodes are stored top-down,
+// the offset of an inner node is the index of its first child.
+func fgbIndex(position geoPosition, offsets []uint64) []byte {
+	// nodes per level, bottom-up
+	levels := []int{len(offsets)}
+	total := len(offsets)
+	for n := len(offsets); ; {
+		n = (n + fgbNodeSize - 1) / fgbNodeSize
+		levels = append(levels, n)
+		total += n
+		if n == 1 {
+			break
+		}
+	}
+
+	// all readings share the position of the sensor, so the Hilbert order
+	// is the order of the readings and every node has the same extent
+	type node struct {
+		offset uint64
+	}
+	nodes := make([]node, total)
+	start := total - len(offsets)
+	for i, offset := range offsets {
+		nodes[start+i] = node{offset}
+	}
+	for level := 0; level < len(levels)-1; level++ {
+		end := start + levels[level]
+		parent := start - levels[level+1]
+		for child := start; child < end; child += fgbNodeSize {
+			nodes[parent] = node{uint64(child)}
+			parent++
+		}
+		start -= levels[level+1]
+	}
+
+	var out bytes.Buffer
+	for _, n := range nodes {
+		binary.Write(&out, binary.LittleEndian, []float64{position.Lon, position.Lat, position.Lon, position.Lat})
+		binary.Write(&out, binary.LittleEndian, n.offset)
+	}
+	return out.Bytes()
+}
+
+// exportFlatgeobuf writes the history as FlatGeobuf with a point feature per
+// reading at the position of the sensor and a spatial index, for streaming
+// into QGIS, GDAL or the flatgeobuf JavaScript client.
+func exportFlatgeobuf(w http.ResponseWriter, r *http.Request) {
+	history, position, ok := loadGeoHistory(w, r)
+	if !ok {
+		return
+	}
+
+	var features bytes.Buffer
+	var offsets []uint64
+	for _, reading := range history.Readings {
+		var properties []byte
+		timestamp := reading.Timestamp.UTC().Format(time.RFC3339)
+		properties = binary.LittleEndian.AppendUint16(properties, 0)
+		properties = binary.LittleEndian.AppendUint32(properties, uint32(len(timestamp)))
+		properties = append(properties, timestamp...)
+		properties = binary.LittleEndian.AppendUint16(properties, 1)
+		properties = binary.LittleEndian.AppendUint64(properties, math.Float64bits(reading.Temp))
+		properties = binary.LittleEndian.AppendUint16(properties, 2)
+		properties = binary.LittleEndian.AppendUint64(properties, math.Float64bits(reading.Humidity))
+		properties = binary.LittleEndian.AppendUint16(properties, 3)
+		properties = binary.LittleEndian.AppendUint32(properties, uint32(reading.BatteryMV))
+		properties = binary.LittleEndian.AppendUint16(properties, 4)
+		properties = binary.LittleEndian.AppendUint32(properties, uint32(reading.BatteryLevel))
+
+		offsets = append(offsets, uint64(features.Len()))
+		features.Write(fgbFeature(position, properties))
+	}
+
+	var envelope []float64
+	if len(offsets) > 0 {
+		envelope = []float64{position.Lon, position.Lat, position.Lon, position.Lat}
+	}
+	var out bytes.Buffer
+	out.Write(fgbMagic)
+	out.Write(fgbHeader(feedTitle(history), envelope, len(offsets)))
+	if len(offsets) > 0 {
+		out.Write(fgbIndex(position, offsets))
+	}
+	out.Write(features.Bytes())
+
+	setAttachment(w, "application/vnd.flatgeobuf", exportFilename(history.Mac, "fgb"))
+	w.Write(out.Bytes())
+}
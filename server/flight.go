@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/flight"
+	"github.com/apache/arrow-go/v18/arrow/ipc"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// flightBatchSize is the number of readings per Arrow record batch.
+const flightBatchSize = 10000
+
+// flightSchema is the Arrow schema of the history of a sensor.
+func flightSchema(mac string, loc string) *arrow.Schema {
+	metadata := arrow.NewMetadata([]string{"mac", "loc"}, []string{mac, loc})
+	return arrow.NewSchema([]arrow.Field{
+		{Name: "timestamp", Type: &arrow.TimestampType{Unit: arrow.Second, TimeZone: "UTC"}},
+		{Name: "temp", Type: arrow.PrimitiveTypes.Float64},
+		{Name: "humidity", Type: arrow.PrimitiveTypes.Float64},
+		{Name: "battery_mv", Type: arrow.PrimitiveTypes.Int16},
+		{Name: "battery_level", Type: arrow.PrimitiveTypes.Int8},
+	}, &metadata)
+}
+
+// flightTicket selects the readings of a DoGet. GetFlightInfo hands out
+// tickets for the whole history, clients may add from and to (RFC 3339).
+type flightTicket struct {
+	Mac  string `json:"mac"`
+	From string `json:"from,omitempty"`
+	To   string `json:"to,omitempty"`
+}
+
+// flightServer serves the history of each sensor as a flight with the
+// path descriptor [<mac>].
+type flightServer struct {
+	flight.BaseFlightServer
+	mem memory.Allocator
+}
+
+func (s *flightServer) flightInfo(mac string, config Config) (*flight.FlightInfo, error) {
+	ticket, err := json.Marshal(flightTicket{Mac: mac})
+	if err != nil {
+		return nil, err
+	}
+	var count int64
+	if err := config.Db.QueryRow("SELECT COUNT(*) FROM sensor_data").Scan(&count); err != nil {
+		log.Printf("%v", err)
+		return nil, status.Error(codes.Internal, "data could not be loaded")
+	}
+	return &flight.FlightInfo{
+		Schema:           flight.SerializeSchema(flightSchema(mac, config.Loc), s.mem),
+		FlightDescriptor: &flight.FlightDescriptor{Type: flight.DescriptorPATH, Path: []string{mac}},
+		Endpoint:         []*flight.FlightEndpoint{{Ticket: &flight.Ticket{Ticket: ticket}}},
+		TotalRecords:     count,
+		TotalBytes:       -1,
+	}, nil
+}
+
+// descriptorSensor looks up the sensor of a path descriptor.
+func descriptorSensor(desc *flight.FlightDescriptor) (string, Config, error) {
+	if desc.GetType() != flight.DescriptorPATH || len(desc.GetPath()) != 1 {
+		return "", Config{}, status.Error(codes.InvalidArgument, "expected the path descriptor [<mac>]")
+	}
+	mac := strings.ToLower(desc.GetPath()[0])
+	config, ok := configMap[mac]
+	if !ok {
+		return "", Config{}, status.Error(codes.NotFound, "sensor not found")
+	}
+	return mac, config, nil
+}
+
+func (s *flightServer) ListFlights(criteria *flight.Criteria, stream flight.FlightService_ListFlightsServer) error {
+	macs := make([]string, 0, len(configMap))
+	for mac := range configMap {
+		macs = append(macs, mac)
+	}
+	sort.Strings(macs)
+	for _, mac := range macs {
+		info, err := s.flightInfo(mac, configMap[mac])
+		if err != nil {
+			return err
+		}
+		if err := stream.Send(info); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *flightServer) GetFlightInfo(ctx context.Context, desc *flight.FlightDescriptor) (*flight.FlightInfo, error) {
+	mac, config, err := descriptorSensor(desc)
+	if err != nil {
+		return nil, err
+	}
+	return s.flightInfo(mac, config)
+}
+
+func (s *flightServer) GetSchema(ctx context.Context, desc *flight.FlightDescriptor) (*flight.SchemaResult, error) {
+	mac, config, err := descriptorSensor(desc)
+	if err != nil {
+		return nil, err
+	}
+	return &flight.SchemaResult{Schema: flight.SerializeSchema(flightSchema(mac, config.Loc), s.mem)}, nil
+}
+
+// DoGet streams the readings of the ticket as record batches in the IPC
+// streaming format.
+func (s *flightServer) DoGet(tkt *flight.Ticket, stream flight.FlightService_DoGetServer) error {
+	var ticket flightTicket
+	if err := json.Unmarshal(tkt.GetTicket(), &ticket); err != nil {
+		return status.Error(codes.InvalidArgument, "invalid ticket")
+	}
+	mac := strings.ToLower(ticket.Mac)
+	config, ok := configMap[mac]
+	if !ok {
+		return status.Error(codes.NotFound, "sensor not found")
+	}
+	var from, to time.Time
+	var err error
+	if ticket.From != "" {
+		if from, err = time.Parse(time.RFC3339, ticket.From); err != nil {
+			return status.Error(codes.InvalidArgument, "invalid from, expected RFC3339")
+		}
+	}
+	if ticket.To != "" {
+		if to, err = time.Parse(time.RFC3339, ticket.To); err != nil {
+			return status.Error(codes.InvalidArgument, "invalid to, expected RFC3339")
+		}
+	}
+	readings, err := queryReadings(config.Db, from, to, 0, 1)
+	if err != nil {
+		log.Printf("%v", err)
+		return status.Error(codes.Internal, "data could not be loaded")
+	}
+
+	schema := flightSchema(mac, config.Loc)
+	writer := flight.NewRecordWriter(stream, ipc.WithSchema(schema), ipc.WithAllocator(s.mem))
+	defer writer.Close()
+	builder := array.NewRecordBuilder(s.mem, schema)
+	defer builder.Release()
+	for _, batch := range batchReadings(readings, flightBatchSize) {
+		for _, reading := range batch {
+			builder.Field(0).(*array.TimestampBuilder).Append(arrow.Timestamp(reading.Timestamp.Unix()))
+			builder.Field(1).(*array.Float64Builder).Append(reading.Temp)
+			builder.Field(2).(*array.Float64Builder).Append(reading.Humidity)
+			builder.Field(3).(*array.Int16Builder).Append(reading.BatteryMV)
+			builder.Field(4).(*array.Int8Builder).Append(reading.BatteryLevel)
+		}
+		record := builder.NewRecord()
+		err := writer.Write(record)
+		record.Release()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// serveArrowFlight runs the Arrow Flight server on addr.
+func serveArrowFlight(addr string) {
+	server := flight.NewServerWithMiddleware(nil)
+	if err := server.Init(addr); err != nil {
+		log.Fatalf("Failed to listen for Arrow Flight: %v", err)
+	}
+	server.RegisterFlightService(&flightServer{mem: memory.DefaultAllocator})
+	fmt.Printf("Arrow Flight server is running on %s\n", addr)
+	log.Fatal(server.Serve())
+}
+
+// exportArrowFlight generates a pyarrow.flight client script fetching the
+// history of the sensor from the Arrow Flight server.
+func exportArrowFlight(w http.ResponseWriter, r *http.Request) {
+	history, ok := loadSensor(w, r)
+	if !ok {
+		return
+	}
+	if serverConfig.ArrowFlightAddr == "" {
+		http.Error(w, "arrow_flight_addr is not configured for this server", http.StatusBadRequest)
+		return
+	}
+
+	// the Flight server listens on the host of this server
+	host := r.Host
+	if h, _, err := net.SplitHostPort(r.Host); err == nil {
+		host = h
+	}
+	_, port, err := net.SplitHostPort(serverConfig.ArrowFlightAddr)
+	if err != nil {
+		exportError(w, err)
+		return
+	}
+
+	script, err := renderExportTemplate("arrow_flight_client.py", struct {
+		exportContext
+		FlightURL string
+	}{newExportContext(r, history), "grpc://" + net.JoinHostPort(host, port)})
+	if err != nil {
+		exportError(w, err)
+		return
+	}
+
+	setAttachment(w, "text/x-python", exportFilename(history.Mac, "flight.py"))
+	w.Write(script)
+}
@@ -0,0 +1,447 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/xml"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/encoding/mvt"
+	"github.com/paulmach/orb/geojson"
+	"github.com/paulmach/orb/maptile"
+	"github.com/protomaps/go-pmtiles/pmtiles"
+)
+
+// geoPosition is the configured position of a sensor.
+type geoPosition struct {
+	Lat, Lon, Alt float64
+}
+
+// Geometry returns the GeoJSON Point of the position.
+func (p geoPosition) Geometry() map[string]any {
+	return map[string]any{"type": "Point", "coordinates": []float64{p.Lon, p.Lat}}
+}
+
+// sensorPosition returns the position of the sensor, false if it has no
+// lat and lon configured.
+func sensorPosition(mac string) (geoPosition, bool) {
+	config := configMap[mac]
+	if config.Lat == nil || config.Lon == nil {
+		return geoPosition{}, false
+	}
+	return geoPosition{Lat: *config.Lat, Lon: *config.Lon, Alt: config.Alt}, true
+}
+
+// loadGeoHistory reads the history like loadHistory for the geo exports,
+// which need the position of the sensor. On failure the error is written
+// to w and false is returned.
+func loadGeoHistory(w http.ResponseWriter, r *http.Request) (*SensorHistory, geoPosition, bool) {
+	history, ok := loadHistory(w, r)
+	if !ok {
+		return nil, geoPosition{}, false
+	}
+	position, ok := sensorPosition(history.Mac)
+	if !ok {
+		http.Error(w, "Sensor has no coordinates configured (lat and lon in config.json)", http.StatusBadRequest)
+		return nil, geoPosition{}, false
+	}
+	return history, position, true
+}
+
+// exportGeojson writes the history as GeoJSON FeatureCollection, a Point
+// feature at the position of the sensor per reading.
+func exportGeojson(w http.ResponseWriter, r *http.Request) {
+	history, position, ok := loadGeoHistory(w, r)
+	if !ok {
+		return
+	}
+
+	features := []map[string]any{}
+	for _, reading := range history.Readings {
+		features = append(features, map[string]any{
+			"type":       "Feature",
+			"geometry":   position.Geometry(),
+			"properties": reading,
+		})
+	}
+	writeJSON(w, "application/geo+json", map[string]any{
+		"type":     "FeatureCollection",
+		"name":     feedTitle(history),
+		"features": features,
+	})
+}
+
+// kmzMinReadings is the size of the history from which the KML export is
+// zipped as KMZ.
+const kmzMinReadings = 1000
+
+type kmlTimeStamp struct {
+	When string `xml:"when"`
+}
+
+type kmlPoint struct {
+	Coordinates string `xml:"coordinates"`
+}
+
+type kmlPlacemark struct {
+	Name        string        `xml:"name"`
+	Description string        `xml:"description"`
+	TimeStamp   *kmlTimeStamp `xml:"TimeStamp,omitempty"`
+	Point       kmlPoint      `xml:"Point"`
+}
+
+type kmlFolder struct {
+	Name       string         `xml:"name"`
+	Placemarks []kmlPlacemark `xml:"Placemark"`
+}
+
+type kmlDocument struct {
+	XMLName  xml.Name `xml:"http://www.opengis.net/kml/2.2 kml"`
+	Document struct {
+		Name      string       `xml:"name"`
+		Placemark kmlPlacemark `xml:"Placemark"`
+		Folder    kmlFolder    `xml:"Folder"`
+	} `xml:"Document"`
+}
+
+// exportKml writes the history as KML: a placemark of the sensor and a
+// folder with a time stamped placemark per reading, for the time slider of
+// Google Earth. Histories of kmzMinReadings or more readings are sent as
+// KMZ archive.
+func exportKml(w http.ResponseWriter, r *http.Request) {
+	history, position, ok := loadGeoHistory(w, r)
+	if !ok {
+		return
+	}
+
+	point := kmlPoint{fmt.Sprintf("%s,%s",
+		strconv.FormatFloat(position.Lon, 'f', -1, 64),
+		strconv.FormatFloat(position.Lat, 'f', -1, 64))}
+	var doc kmlDocument
+	doc.Document.Name = feedTitle(history)
+	doc.Document.Placemark = kmlPlacemark{
+		Name:        feedTitle(history),
+		Description: "Xiaomi Mijia sensor " + history.Mac,
+		Point:       point,
+	}
+	doc.Document.Folder.Name = "Readings"
+	for _, reading := range history.Readings {
+		timestamp := reading.Timestamp.UTC().Format(time.RFC3339)
+		doc.Document.Folder.Placemarks = append(doc.Document.Folder.Placemarks, kmlPlacemark{
+			Name:      fmt.Sprintf("%.1f °C", reading.Temp),
+			TimeStamp: &kmlTimeStamp{timestamp},
+			Description: fmt.Sprintf("%s: %.2f °C, %.2f %% humidity, battery %d %%",
+				timestamp, reading.Temp, reading.Humidity, reading.BatteryLevel),
+			Point: point,
+		})
+	}
+
+	data, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		exportError(w, err)
+		return
+	}
+	data = append([]byte(xml.Header), data...)
+
+	if len(history.Readings) < kmzMinReadings {
+		setAttachment(w, "application/vnd.google-earth.kml+xml", exportFilename(history.Mac, "kml"))
+		w.Write(data)
+		return
+	}
+	// the main file of a KMZ is the first one, named doc.kml by convention
+	kmz, err := buildZip([]zipFile{{Name: "doc.kml", Data: data}})
+	if err != nil {
+		exportError(w, err)
+		return
+	}
+	setAttachment(w, "application/vnd.google-earth.kmz", exportFilename(history.Mac, "kmz"))
+	w.Write(kmz)
+}
+
+type gpxExtensions struct {
+	Temp         float64 `xml:"mijia:temp"`
+	Humidity     float64 `xml:"mijia:humidity"`
+	BatteryLevel int8    `xml:"mijia:battery_level"`
+}
+
+type gpxWaypoint struct {
+	Lat        float64       `xml:"lat,attr"`
+	Lon        float64       `xml:"lon,attr"`
+	Time       string        `xml:"time"`
+	Name       string        `xml:"name"`
+	Extensions gpxExtensions `xml:"extensions"`
+}
+
+type gpxDocument struct {
+	XMLName    xml.Name      `xml:"gpx"`
+	Xmlns      string        `xml:"xmlns,attr"`
+	XmlnsMijia string        `xml:"xmlns:mijia,attr"`
+	Version    string        `xml:"version,attr"`
+	Creator    string        `xml:"creator,attr"`
+	Name       string        `xml:"metadata>name"`
+	Waypoints  []gpxWaypoint `xml:"wpt"`
+}
+
+// exportGpx writes the history as GPX 1.1 with a waypoint per reading at
+// the position of the sensor, the measurements in the extensions in the
+// namespace of the RDF exports.
+func exportGpx(w http.ResponseWriter, r *http.Request) {
+	history, position, ok := loadGeoHistory(w, r)
+	if !ok {
+		return
+	}
+
+	doc := gpxDocument{
+		Xmlns:      "http://www.topografix.com/GPX/1/1",
+		XmlnsMijia: rdfSchemaBase,
+		Version:    "1.1",
+		Creator:    "mijia",
+		Name:       feedTitle(history),
+	}
+	for _, reading := range history.Readings {
+		doc.Waypoints = append(doc.Waypoints, gpxWaypoint{
+			Lat:  position.Lat,
+			Lon:  position.Lon,
+			Time: reading.Timestamp.UTC().Format(time.RFC3339),
+			Name: fmt.Sprintf("%.1f °C, %.1f %%", reading.Temp, reading.Humidity),
+			Extensions: gpxExtensions{
+				Temp:         reading.Temp,
+				Humidity:     reading.Humidity,
+				BatteryLevel: reading.BatteryLevel,
+			},
+		})
+	}
+
+	setAttachment(w, "application/gpx+xml", exportFilename(history.Mac, "gpx"))
+	writeXML(w, "application/gpx+xml", doc)
+}
+
+// geobufPrecision is the number of decimals of the coordinates, the default
+// of Geobuf.
+const geobufPrecision = 6
+
+// geobufCoordinate encodes a coordinate as zigzag encoded sint64.
+func geobufCoordinate(v float64) uint64 {
+	n := int64(math.Round(v * math.Pow10(geobufPrecision)))
+	return uint64(n<<1) ^ uint64(n>>63)
+}
+
+// buildGeobuf encodes the readings as Geobuf FeatureCollection of points at
+// the position. The messages of geobuf.proto are written with protoMessage
+// like the other protocol buffers exports instead of go.geobuf and its
+// protobuf runtime.
+func buildGeobuf(position geoPosition, readings []SensorReading) []byte {
+	// Data.Geometry: the required type POINT and the coordinates
+	var geometry protoMessage
+	geometry.Uint64(1, 0)
+	geometry.Bytes(3, binary.AppendUvarint(binary.AppendUvarint(nil,
+		geobufCoordinate(position.Lon)), geobufCoordinate(position.Lat)))
+
+	var data, collection protoMessage
+	keys := []string{"timestamp", "temp", "humidity", "battery_mv", "battery_level"}
+	for _, key := range keys {
+		data.String(1, key)
+	}
+	for _, reading := range readings {
+		var timestamp, temp, humidity, batteryMV, batteryLevel protoMessage
+		timestamp.String(1, reading.Timestamp.UTC().Format(time.RFC3339))
+		temp.Double(2, reading.Temp)
+		humidity.Double(2, reading.Humidity)
+		batteryMV.Uint64(3, uint64(reading.BatteryMV))
+		batteryLevel.Uint64(3, uint64(reading.BatteryLevel))
+
+		// Data.Feature: the values and the pairs of key and value indexes
+		var feature protoMessage
+		feature.Message(1, &geometry)
+		var properties []byte
+		for i, value := range []*protoMessage{&timestamp, &temp, &humidity, &batteryMV, &batteryLevel} {
+			feature.Message(13, value)
+			properties = binary.AppendUvarint(binary.AppendUvarint(properties, uint64(i)), uint64(i))
+		}
+		feature.Bytes(14, properties)
+		collection.Message(1, &feature)
+	}
+	data.Message(4, &collection)
+	return data.Encoded()
+}
+
+// exportGeobuf writes the GeoJSON export encoded as Geobuf, the protocol
+// buffers schema of mapbox/geobuf.
+func exportGeobuf(w http.ResponseWriter, r *http.Request) {
+	history, position, ok := loadGeoHistory(w, r)
+	if !ok {
+		return
+	}
+
+	setAttachment(w, "application/x-protobuf", exportFilename(history.Mac, "pbf"))
+	w.Write(buildGeobuf(position, history.Readings))
+}
+
+// pmtilesMaxZoom is the deepest zoom of the PMTiles export, street level.
+const pmtilesMaxZoom = 14
+
+// exportPmtiles writes the history as PMTiles archive of vector tiles for
+// MapLibre GL JS: for every zoom up to pmtilesMaxZoom the tile at the
+// position of the sensor with a point feature per reading in the layer
+// "readings".
+func exportPmtiles(w http.ResponseWriter, r *http.Request) {
+	history, position, ok := loadGeoHistory(w, r)
+	if !ok {
+		return
+	}
+
+	point := orb.Point{position.Lon, position.Lat}
+	var tileData []byte
+	var entries []pmtiles.EntryV3
+	for zoom := maptile.Zoom(0); zoom <= pmtilesMaxZoom && len(history.Readings) > 0; zoom++ {
+		features := geojson.NewFeatureCollection()
+		for _, reading := range history.Readings {
+			feature := geojson.NewFeature(point)
+			feature.Properties["timestamp"] = reading.Timestamp.UTC().Format(time.RFC3339)
+			feature.Properties["temp"] = reading.Temp
+			feature.Properties["humidity"] = reading.Humidity
+			features.Append(feature)
+		}
+		tile := maptile.At(point, zoom)
+		layers := mvt.NewLayers(map[string]*geojson.FeatureCollection{"readings": features})
+		layers.ProjectToTile(tile)
+		data, err := mvt.MarshalGzipped(layers)
+		if err != nil {
+			exportError(w, err)
+			return
+		}
+		entries = append(entries, pmtiles.EntryV3{
+			TileID:    pmtiles.ZxyToID(uint8(zoom), tile.X, tile.Y),
+			Offset:    uint64(len(tileData)),
+			Length:    uint32(len(data)),
+			RunLength: 1,
+		})
+		tileData = append(tileData, data...)
+	}
+
+	metadata, err := pmtiles.SerializeMetadata(map[string]any{
+		"name":        sensorName(history.Mac),
+		"description": "Readings of the Xiaomi Mijia sensor " + history.Mac + " in " + feedTitle(history),
+		"vector_layers": []map[string]any{{
+			"id":      "readings",
+			"minzoom": 0,
+			"maxzoom": pmtilesMaxZoom,
+			"fields":  map[string]string{"timestamp": "String", "temp": "Number", "humidity": "Number"},
+		}},
+	}, pmtiles.Gzip)
+	if err != nil {
+		exportError(w, err)
+		return
+	}
+	root := pmtiles.SerializeEntries(entries, pmtiles.Gzip)
+
+	lon, lat := int32(position.Lon*1e7), int32(position.Lat*1e7)
+	header := pmtiles.HeaderV3{
+		RootOffset:          pmtiles.HeaderV3LenBytes,
+		RootLength:          uint64(len(root)),
+		MetadataOffset:      pmtiles.HeaderV3LenBytes + uint64(len(root)),
+		MetadataLength:      uint64(len(metadata)),
+		TileDataOffset:      pmtiles.HeaderV3LenBytes + uint64(len(root)+len(metadata)),
+		TileDataLength:      uint64(len(tileData)),
+		AddressedTilesCount: uint64(len(entries)),
+		TileEntriesCount:    uint64(len(entries)),
+		TileContentsCount:   uint64(len(entries)),
+		Clustered:           true,
+		InternalCompression: pmtiles.Gzip,
+		TileCompression:     pmtiles.Gzip,
+		TileType:            pmtiles.Mvt,
+		MinZoom:             0,
+		MaxZoom:             pmtilesMaxZoom,
+		MinLonE7:            lon,
+		MinLatE7:            lat,
+		MaxLonE7:            lon,
+		MaxLatE7:            lat,
+		CenterZoom:          pmtilesMaxZoom,
+		CenterLonE7:         lon,
+		CenterLatE7:         lat,
+	}
+	header.LeafDirectoryOffset = header.TileDataOffset
+
+	setAttachment(w, "application/vnd.pmtiles", exportFilename(history.Mac, "pmtiles"))
+	w.Write(pmtiles.SerializeHeader(header))
+	w.Write(root)
+	w.Write(metadata)
+	w.Write(tileData)
+}
+
+// The CZML points are colored from blue at czmlColdTemp to red at
+// czmlHotTemp.
+const (
+	czmlColdTemp = 10.0
+	czmlHotTemp  = 30.0
+)
+
+// czmlColor interpolates the color of a temperature as rgba.
+func czmlColor(temp float64) []int {
+	t := min(max((temp-czmlColdTemp)/(czmlHotTemp-czmlColdTemp), 0), 1)
+	return []int{int(math.Round(255 * t)), 0, int(math.Round(255 * (1 - t))), 255}
+}
+
+// exportCzml writes the history as CZML for Cesium: a point packet per
+// reading at the position of the sensor, available until the next reading
+// (the latest until now), labeled and colored by the temperature.
+func exportCzml(w http.ResponseWriter, r *http.Request) {
+	history, position, ok := loadGeoHistory(w, r)
+	if !ok {
+		return
+	}
+
+	document := map[string]any{
+		"id":      "document",
+		"name":    feedTitle(history),
+		"version": "1.0",
+	}
+	packets := []map[string]any{document}
+	now := time.Now().UTC()
+	for i, reading := range history.Readings {
+		start := reading.Timestamp.UTC()
+		end := now
+		if i+1 < len(history.Readings) {
+			end = history.Readings[i+1].Timestamp.UTC()
+		}
+		if end.Before(start) {
+			end = start
+		}
+		packets = append(packets, map[string]any{
+			"id":           readingIRI(history.Mac, reading),
+			"name":         start.Format(time.RFC3339),
+			"availability": start.Format(time.RFC3339) + "/" + end.Format(time.RFC3339),
+			"description":  fmt.Sprintf("%.2f °C, %.2f %% humidity, battery %d %%", reading.Temp, reading.Humidity, reading.BatteryLevel),
+			"position":     map[string]any{"cartographicDegrees": []float64{position.Lon, position.Lat, position.Alt}},
+			"point": map[string]any{
+				"color":     map[string]any{"rgba": czmlColor(reading.Temp)},
+				"pixelSize": 12,
+			},
+			"label": map[string]any{
+				"text":        fmt.Sprintf("%.1f °C", reading.Temp),
+				"font":        "14pt sans-serif",
+				"pixelOffset": map[string]any{"cartesian2": []int{0, -24}},
+			},
+		})
+	}
+	if n := len(history.Readings); n > 0 {
+		first := history.Readings[0].Timestamp.UTC()
+		last := history.Readings[n-1].Timestamp.UTC()
+		if last.Before(now) {
+			last = now
+		}
+		interval := first.Format(time.RFC3339) + "/" + last.Format(time.RFC3339)
+		document["clock"] = map[string]any{
+			"interval":    interval,
+			"currentTime": first.Format(time.RFC3339),
+			"multiplier":  3600,
+		}
+	}
+
+	setAttachment(w, "application/json", exportFilename(history.Mac, "czml"))
+	writeJSON(w, "application/json", packets)
+}
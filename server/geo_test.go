@@ -0,0 +1,146 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// geobufSchema is geobuf.proto of mapbox/geobuf as descriptor, without the
+// custom properties and ids the export does not use.
+const geobufSchema = `
+name: "geobuf.proto"
+package: "geobuf"
+syntax: "proto2"
+message_type {
+  name: "Data"
+  field { name: "keys" number: 1 label: LABEL_REPEATED type: TYPE_STRING }
+  field { name: "dimensions" number: 2 label: LABEL_OPTIONAL type: TYPE_UINT32 default_value: "2" }
+  field { name: "precision" number: 3 label: LABEL_OPTIONAL type: TYPE_UINT32 default_value: "6" }
+  field { name: "feature_collection" number: 4 label: LABEL_OPTIONAL type: TYPE_MESSAGE type_name: ".geobuf.Data.FeatureCollection" oneof_index: 0 }
+  field { name: "feature" number: 5 label: LABEL_OPTIONAL type: TYPE_MESSAGE type_name: ".geobuf.Data.Feature" oneof_index: 0 }
+  field { name: "geometry" number: 6 label: LABEL_OPTIONAL type: TYPE_MESSAGE type_name: ".geobuf.Data.Geometry" oneof_index: 0 }
+  oneof_decl { name: "data_type" }
+  nested_type {
+    name: "Feature"
+    field { name: "geometry" number: 1 label: LABEL_REQUIRED type: TYPE_MESSAGE type_name: ".geobuf.Data.Geometry" }
+    field { name: "values" number: 13 label: LABEL_REPEATED type: TYPE_MESSAGE type_name: ".geobuf.Data.Value" }
+    field { name: "properties" number: 14 label: LABEL_REPEATED type: TYPE_UINT32 options { packed: true } }
+  }
+  nested_type {
+    name: "Geometry"
+    field { name: "type" number: 1 label: LABEL_REQUIRED type: TYPE_ENUM type_name: ".geobuf.Data.Geometry.Type" }
+    field { name: "lengths" number: 2 label: LABEL_REPEATED type: TYPE_UINT32 options { packed: true } }
+    field { name: "coords" number: 3 label: LABEL_REPEATED type: TYPE_SINT64 options { packed: true } }
+    field { name: "geometries" number: 4 label: LABEL_REPEATED type: TYPE_MESSAGE type_name: ".geobuf.Data.Geometry" }
+    field { name: "values" number: 13 label: LABEL_REPEATED type: TYPE_MESSAGE type_name: ".geobuf.Data.Value" }
+    enum_type {
+      name: "Type"
+      value { name: "POINT" number: 0 }
+      value { name: "MULTIPOINT" number: 1 }
+      value { name: "LINESTRING" number: 2 }
+      value { name: "MULTILINESTRING" number: 3 }
+      value { name: "POLYGON" number: 4 }
+      value { name: "MULTIPOLYGON" number: 5 }
+      value { name: "GEOMETRYCOLLECTION" number: 6 }
+    }
+  }
+  nested_type {
+    name: "FeatureCollection"
+    field { name: "features" number: 1 label: LABEL_REPEATED type: TYPE_MESSAGE type_name: ".geobuf.Data.Feature" }
+    field { name: "values" number: 13 label: LABEL_REPEATED type: TYPE_MESSAGE type_name: ".geobuf.Data.Value" }
+  }
+  nested_type {
+    name: "Value"
+    field { name: "string_value" number: 1 label: LABEL_OPTIONAL type: TYPE_STRING oneof_index: 0 }
+    field { name: "double_value" number: 2 label: LABEL_OPTIONAL type: TYPE_DOUBLE oneof_index: 0 }
+    field { name: "pos_int_value" number: 3 label: LABEL_OPTIONAL type: TYPE_UINT64 oneof_index: 0 }
+    field { name: "neg_int_value" number: 4 label: LABEL_OPTIONAL type: TYPE_UINT64 oneof_index: 0 }
+    field { name: "bool_value" number: 5 label: LABEL_OPTIONAL type: TYPE_BOOL oneof_index: 0 }
+    field { name: "json_value" number: 6 label: LABEL_OPTIONAL type: TYPE_STRING oneof_index: 0 }
+    oneof_decl { name: "value_type" }
+  }
+}
+`
+
+func TestBuildGeobufDecodes(t *testing.T) {
+	var schema descriptorpb.FileDescriptorProto
+	if err := prototext.Unmarshal([]byte(geobufSchema), &schema); err != nil {
+		t.Fatal(err)
+	}
+	file, err := protodesc.NewFile(&schema, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dataType := file.Messages().ByName("Data")
+
+	position := geoPosition{Lat: 48.1372, Lon: 11.5756}
+	readings := []SensorReading{
+		{Timestamp: time.Date(2026, 10, 10, 0, 0, 0, 0, time.UTC), Temp: 21.5, Humidity: 45.25, BatteryMV: 2900, BatteryLevel: 80},
+		{Timestamp: time.Date(2026, 10, 10, 0, 15, 0, 0, time.UTC), Temp: -3.75, Humidity: 50, BatteryMV: 2850, BatteryLevel: 79},
+	}
+
+	// required fields are checked while unmarshaling
+	data := dynamicpb.NewMessage(dataType)
+	if err := proto.Unmarshal(buildGeobuf(position, readings), data); err != nil {
+		t.Fatalf("decoding: %v", err)
+	}
+
+	field := func(m protoreflect.Message, name protoreflect.Name) protoreflect.Value {
+		return m.Get(m.Descriptor().Fields().ByName(name))
+	}
+	keys := field(data, "keys").List()
+	precision := math.Pow10(int(field(data, "precision").Uint()))
+	features := field(field(data, "feature_collection").Message(), "features").List()
+	if features.Len() != len(readings) {
+		t.Fatalf("got %d features, want %d", features.Len(), len(readings))
+	}
+	for i, reading := range readings {
+		feature := features.Get(i).Message()
+		geometry := field(feature, "geometry").Message()
+		if !geometry.Has(geometry.Descriptor().Fields().ByName("type")) {
+			t.Errorf("feature %d: geometry type not written", i)
+		}
+		if typ := field(geometry, "type").Enum(); typ != 0 {
+			t.Errorf("feature %d: got geometry type %d, want POINT", i, typ)
+		}
+		coords := field(geometry, "coords").List()
+		if coords.Len() != 2 {
+			t.Fatalf("feature %d: got %d coordinates, want 2", i, coords.Len())
+		}
+		if lon, lat := float64(coords.Get(0).Int())/precision, float64(coords.Get(1).Int())/precision; lon != position.Lon || lat != position.Lat {
+			t.Errorf("feature %d: got position %v, %v, want %v, %v", i, lat, lon, position.Lat, position.Lon)
+		}
+
+		values := field(feature, "values").List()
+		properties := field(feature, "properties").List()
+		got := map[string]any{}
+		for j := 0; j+1 < properties.Len(); j += 2 {
+			key := keys.Get(int(properties.Get(j).Uint())).String()
+			value := values.Get(int(properties.Get(j + 1).Uint())).Message()
+			value.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+				got[key] = v.Interface()
+				return true
+			})
+		}
+		want := map[string]any{
+			"timestamp":     reading.Timestamp.Format(time.RFC3339),
+			"temp":          reading.Temp,
+			"humidity":      reading.Humidity,
+			"battery_mv":    uint64(reading.BatteryMV),
+			"battery_level": uint64(reading.BatteryLevel),
+		}
+		for key, value := range want {
+			if got[key] != value {
+				t.Errorf("feature %d: got %s %v, want %v", i, key, got[key], value)
+			}
+		}
+	}
+}
@@ -0,0 +1,538 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// graphqlSchema is the SDL of the POST /graphql endpoint.
+const graphqlSchema = `"""
+A reading of a Mijia sensor, temp in °C and humidity in %.
+"""
+type SensorReading {
+  "RFC 3339 timestamp (UTC)"
+  timestamp: String!
+  temp: Float!
+  humidity: Float!
+  battery_mv: Int!
+  battery_level: Int!
+}
+
+type Query {
+  "The latest reading of the sensor."
+  sensorLatest(mac: String!): SensorReading
+  "The readings of the sensor, optionally limited by RFC 3339 timestamps."
+  sensorHistory(mac: String!, from: String, to: String): [SensorReading!]!
+}
+
+schema {
+  query: Query
+}
+`
+
+// graphqlSchemaHandler serves the GraphQL schema in SDL.
+func graphqlSchemaHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte(graphqlSchema))
+}
+
+// exportGraphql writes the history as the response of the sensorHistory
+// query selecting all fields.
+func exportGraphql(w http.ResponseWriter, r *http.Request) {
+	history, ok := loadHistory(w, r)
+	if !ok {
+		return
+	}
+	readings := history.Readings
+	if readings == nil {
+		readings = []SensorReading{}
+	}
+
+	setAttachment(w, "application/graphql-response+json", exportFilename(history.Mac, "graphql.json"))
+	writeJSON(w, "application/graphql-response+json", map[string]any{
+		"data": map[string]any{"sensorHistory": readings},
+	})
+}
+
+// graphqlField is a field of a parsed selection set.
+type graphqlField struct {
+	Alias     string
+	Name      string
+	Arguments map[string]graphqlValue
+	Selection []graphqlField
+}
+
+// graphqlValue is an argument value, either a literal or a variable.
+type graphqlValue struct {
+	Variable string
+	Literal  any
+}
+
+// graphqlOperation is a parsed query operation.
+type graphqlOperation struct {
+	Name      string
+	Defaults  map[string]any
+	Selection []graphqlField
+}
+
+// graphqlParser is a minimal parser for GraphQL query documents: query
+// operations with variables, arguments, aliases and nested selections.
+// Fragments, directives, mutations and subscriptions are not supported.
+// graphqlMaxDepth limits the nesting of selection sets and list types, far
+// beyond the depth of the schema, so that the recursive parser cannot
+// exhaust the stack.
+const graphqlMaxDepth = 32
+
+type graphqlParser struct {
+	src   string
+	pos   int
+	depth int
+}
+
+// nest enters a nested selection set or type, leave with p.depth--.
+func (p *graphqlParser) nest() error {
+	if p.depth++; p.depth > graphqlMaxDepth {
+		return fmt.Errorf("query is nested deeper than %d levels", graphqlMaxDepth)
+	}
+	return nil
+}
+
+type graphqlError struct {
+	Message string `json:"message"`
+	Path    []any  `json:"path,omitempty"`
+}
+
+func (p *graphqlParser) skip() {
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		if c == '#' {
+			for p.pos < len(p.src) && p.src[p.pos] != '\n' {
+				p.pos++
+			}
+		} else if c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ',' {
+			p.pos++
+		} else {
+			return
+		}
+	}
+}
+
+func (p *graphqlParser) errorf(format string, args ...any) error {
+	return fmt.Errorf("syntax error at offset %d: %s", p.pos, fmt.Sprintf(format, args...))
+}
+
+// peek returns the next punctuator or the first byte of the next token.
+func (p *graphqlParser) peek() byte {
+	p.skip()
+	if p.pos >= len(p.src) {
+		return 0
+	}
+	return p.src[p.pos]
+}
+
+func (p *graphqlParser) expect(c byte) error {
+	if p.peek() != c {
+		return p.errorf("expected %q", c)
+	}
+	p.pos++
+	return nil
+}
+
+func (p *graphqlParser) name() (string, error) {
+	p.skip()
+	start := p.pos
+	for p.pos < len(p.src) {
+		c := rune(p.src[p.pos])
+		if c != '_' && !unicode.IsLetter(c) && !(p.pos > start && unicode.IsDigit(c)) {
+			break
+		}
+		p.pos++
+	}
+	if start == p.pos {
+		return "", p.errorf("expected name")
+	}
+	return p.src[start:p.pos], nil
+}
+
+func (p *graphqlParser) document() ([]graphqlOperation, error) {
+	var operations []graphqlOperation
+	for p.peek() != 0 {
+		operation := graphqlOperation{Defaults: map[string]any{}}
+		if p.peek() != '{' {
+			keyword, err := p.name()
+			if err != nil {
+				return nil, err
+			}
+			if keyword != "query" {
+				return nil, fmt.Errorf("%s is not supported, only queries", keyword)
+			}
+			if c := p.peek(); c != '(' && c != '{' {
+				if operation.Name, err = p.name(); err != nil {
+					return nil, err
+				}
+			}
+			if p.peek() == '(' {
+				if err := p.variables(operation.Defaults); err != nil {
+					return nil, err
+				}
+			}
+		}
+		selection, err := p.selectionSet()
+		if err != nil {
+			return nil, err
+		}
+		operation.Selection = selection
+		operations = append(operations, operation)
+	}
+	if len(operations) == 0 {
+		return nil, fmt.Errorf("no operation in document")
+	}
+	return operations, nil
+}
+
+// variables parses the variable definitions, types are not checked.
+func (p *graphqlParser) variables(defaults map[string]any) error {
+	p.pos++
+	for p.peek() != ')' {
+		if err := p.expect('$'); err != nil {
+			return err
+		}
+		name, err := p.name()
+		if err != nil {
+			return err
+		}
+		if err := p.expect(':'); err != nil {
+			return err
+		}
+		if err := p.typeRef(); err != nil {
+			return err
+		}
+		if p.peek() == '=' {
+			p.pos++
+			value, err := p.value()
+			if err != nil {
+				return err
+			}
+			if value.Variable != "" {
+				return p.errorf("variable as default value")
+			}
+			defaults[name] = value.Literal
+		}
+	}
+	p.pos++
+	return nil
+}
+
+func (p *graphqlParser) typeRef() error {
+	if p.peek() == '[' {
+		p.pos++
+		if err := p.nest(); err != nil {
+			return err
+		}
+		defer func() { p.depth-- }()
+		if err := p.typeRef(); err != nil {
+			return err
+		}
+		if err := p.expect(']'); err != nil {
+			return err
+		}
+	} else if _, err := p.name(); err != nil {
+		return err
+	}
+	if p.peek() == '!' {
+		p.pos++
+	}
+	return nil
+}
+
+func (p *graphqlParser) selectionSet() ([]graphqlField, error) {
+	if err := p.expect('{'); err != nil {
+		return nil, err
+	}
+	if err := p.nest(); err != nil {
+		return nil, err
+	}
+	defer func() { p.depth-- }()
+	var fields []graphqlField
+	for p.peek() != '}' {
+		if p.peek() == '.' {
+			return nil, fmt.Errorf("fragments are not supported")
+		}
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		field := graphqlField{Alias: name, Name: name}
+		if p.peek() == ':' {
+			p.pos++
+			if field.Name, err = p.name(); err != nil {
+				return nil, err
+			}
+		}
+		if p.peek() == '(' {
+			p.pos++
+			field.Arguments = map[string]graphqlValue{}
+			for p.peek() != ')' {
+				arg, err := p.name()
+				if err != nil {
+					return nil, err
+				}
+				if err := p.expect(':'); err != nil {
+					return nil, err
+				}
+				if field.Arguments[arg], err = p.value(); err != nil {
+					return nil, err
+				}
+			}
+			p.pos++
+		}
+		if p.peek() == '@' {
+			return nil, fmt.Errorf("directives are not supported")
+		}
+		if p.peek() == '{' {
+			if field.Selection, err = p.selectionSet(); err != nil {
+				return nil, err
+			}
+		}
+		fields = append(fields, field)
+	}
+	p.pos++
+	return fields, nil
+}
+
+// value parses a scalar value or a variable, lists and input objects are
+// not needed by the schema.
+func (p *graphqlParser) value() (graphqlValue, error) {
+	switch c := p.peek(); {
+	case c == '$':
+		p.pos++
+		name, err := p.name()
+		return graphqlValue{Variable: name}, err
+	case c == '"':
+		start := p.pos
+		p.pos++
+		for p.pos < len(p.src) && p.src[p.pos] != '"' {
+			if p.src[p.pos] == '\\' {
+				p.pos++
+			}
+			p.pos++
+		}
+		if p.pos >= len(p.src) {
+			return graphqlValue{}, p.errorf("unterminated string")
+		}
+		p.pos++
+		var s string
+		if err := json.Unmarshal([]byte(p.src[start:p.pos]), &s); err != nil {
+			return graphqlValue{}, p.errorf("invalid string")
+		}
+		return graphqlValue{Literal: s}, nil
+	case c == '-' || (c >= '0' && c <= '9'):
+		start := p.pos
+		p.pos++
+		for p.pos < len(p.src) && strings.IndexByte("0123456789.eE+-", p.src[p.pos]) >= 0 {
+			p.pos++
+		}
+		n, err := strconv.ParseFloat(p.src[start:p.pos], 64)
+		if err != nil {
+			return graphqlValue{}, p.errorf("invalid number")
+		}
+		return graphqlValue{Literal: n}, nil
+	default:
+		name, err := p.name()
+		if err != nil {
+			return graphqlValue{}, err
+		}
+		switch name {
+		case "true":
+			return graphqlValue{Literal: true}, nil
+		case "false":
+			return graphqlValue{Literal: false}, nil
+		case "null":
+			return graphqlValue{Literal: nil}, nil
+		}
+		return graphqlValue{Literal: name}, nil
+	}
+}
+
+// graphqlArgument resolves a string argument, "" if it is not given.
+func graphqlArgument(field graphqlField, name string, variables map[string]any) (string, error) {
+	value, ok := field.Arguments[name]
+	if !ok {
+		return "", nil
+	}
+	v := value.Literal
+	if value.Variable != "" {
+		v = variables[value.Variable]
+	}
+	if v == nil {
+		return "", nil
+	}
+	s, ok := v.(string)
+	if !ok {
+		return "", fmt.Errorf("argument %s of %s must be a String", name, field.Name)
+	}
+	return s, nil
+}
+
+// graphqlTime resolves an optional RFC 3339 timestamp argument.
+func graphqlTime(field graphqlField, name string, variables map[string]any) (time.Time, error) {
+	value, err := graphqlArgument(field, name, variables)
+	if err != nil || value == "" {
+		return time.Time{}, err
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("argument %s of %s must be an RFC 3339 timestamp", name, field.Name)
+	}
+	return t, nil
+}
+
+// graphqlReading selects the requested fields of a reading.
+func graphqlReading(reading SensorReading, selection []graphqlField) (orderedObject, error) {
+	var object orderedObject
+	for _, field := range selection {
+		switch field.Name {
+		case "__typename":
+			object.set(field.Alias, "SensorReading")
+		case "timestamp":
+			object.set(field.Alias, reading.Timestamp.UTC().Format(time.RFC3339))
+		case "temp":
+			object.set(field.Alias, reading.Temp)
+		case "humidity":
+			object.set(field.Alias, reading.Humidity)
+		case "battery_mv":
+			object.set(field.Alias, reading.BatteryMV)
+		case "battery_level":
+			object.set(field.Alias, reading.BatteryLevel)
+		default:
+			return nil, fmt.Errorf("cannot query field %s on type SensorReading", field.Name)
+		}
+	}
+	return object, nil
+}
+
+// graphqlResolve resolves a field of the Query type.
+func graphqlResolve(field graphqlField, variables map[string]any) (any, error) {
+	if field.Name == "__typename" {
+		return "Query", nil
+	}
+	if field.Name != "sensorLatest" && field.Name != "sensorHistory" {
+		return nil, fmt.Errorf("cannot query field %s on type Query", field.Name)
+	}
+	if len(field.Selection) == 0 {
+		return nil, fmt.Errorf("field %s of type SensorReading must have a selection of subfields", field.Name)
+	}
+	mac, err := graphqlArgument(field, "mac", variables)
+	if err != nil {
+		return nil, err
+	}
+	if mac == "" {
+		return nil, fmt.Errorf("argument mac of %s is required", field.Name)
+	}
+	config, ok := configMap[strings.ToLower(mac)]
+	if !ok {
+		return nil, fmt.Errorf("sensor %s not found", mac)
+	}
+
+	if field.Name == "sensorLatest" {
+		var reading SensorReading
+		err := config.Db.QueryRow(`
+			SELECT temp, humidity, battery_mv, battery_level, timestamp
+			FROM sensor_data
+			ORDER BY timestamp DESC
+			LIMIT 1
+		`).Scan(&reading.Temp, &reading.Humidity, &reading.BatteryMV, &reading.BatteryLevel, &reading.Timestamp)
+		if err == sql.ErrNoRows {
+			return nil, nil
+		} else if err != nil {
+			return nil, err
+		}
+		reading.Temp /= 100
+		reading.Humidity /= 100
+		return graphqlReading(reading, field.Selection)
+	}
+
+	from, err := graphqlTime(field, "from", variables)
+	if err != nil {
+		return nil, err
+	}
+	to, err := graphqlTime(field, "to", variables)
+	if err != nil {
+		return nil, err
+	}
+	readings, err := queryReadings(config.Db, from, to, 0, 1)
+	if err != nil {
+		return nil, err
+	}
+	list := []orderedObject{}
+	for _, reading := range readings {
+		object, err := graphqlReading(reading, field.Selection)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, object)
+	}
+	return list, nil
+}
+
+// graphqlHandler executes a query of POST /graphql against the schema of
+// GET /graphql/schema.
+func graphqlHandler(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Query         string         `json:"query"`
+		OperationName string         `json:"operationName"`
+		Variables     map[string]any `json:"variables"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&request); err != nil {
+		http.Error(w, "Invalid GraphQL request body", http.StatusBadRequest)
+		return
+	}
+	reply := func(response map[string]any) {
+		writeJSON(w, "application/graphql-response+json", response)
+	}
+
+	parser := graphqlParser{src: request.Query}
+	operations, err := parser.document()
+	if err != nil {
+		reply(map[string]any{"errors": []graphqlError{{Message: err.Error()}}})
+		return
+	}
+	operation := operations[0]
+	if request.OperationName != "" || len(operations) > 1 {
+		found := false
+		for _, o := range operations {
+			if o.Name == request.OperationName {
+				operation, found = o, true
+			}
+		}
+		if !found {
+			reply(map[string]any{"errors": []graphqlError{{Message: "unknown operation " + strconv.Quote(request.OperationName)}}})
+			return
+		}
+	}
+
+	variables := operation.Defaults
+	for name, value := range request.Variables {
+		variables[name] = value
+	}
+	var data orderedObject
+	var errors []graphqlError
+	for _, field := range operation.Selection {
+		value, err := graphqlResolve(field, variables)
+		if err != nil {
+			errors = append(errors, graphqlError{Message: err.Error(), Path: []any{field.Alias}})
+		}
+		data.set(field.Alias, value)
+	}
+	response := map[string]any{"data": data}
+	if errors != nil {
+		response["errors"] = errors
+	}
+	reply(response)
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// sensorServiceProto is the protobuf definition of the gRPC SensorService.
+// The service is implemented without generated code, messages are encoded
+// with protoMessage.
+const sensorServiceProto = sensorReadingProto + `
+// from and to are optional RFC 3339 timestamps, like the query parameters
+// of the history API.
+message HistoryRequest {
+  string mac = 1;
+  string from = 2;
+  string to = 3;
+}
+
+service SensorService {
+  rpc StreamHistory(HistoryRequest) returns (stream SensorReading);
+}
+`
+
+// grpcCodec passes the raw protobuf messages between the gRPC server and
+// the handlers: requests are received as []byte, responses are sent as
+// protoMessage.
+type grpcCodec struct{}
+
+func (grpcCodec) Marshal(v any) ([]byte, error) {
+	m, ok := v.(*protoMessage)
+	if !ok {
+		return nil, fmt.Errorf("cannot marshal %T", v)
+	}
+	return m.Encoded(), nil
+}
+
+func (grpcCodec) Unmarshal(data []byte, v any) error {
+	b, ok := v.(*[]byte)
+	if !ok {
+		return fmt.Errorf("cannot unmarshal into %T", v)
+	}
+	*b = append((*b)[:0], data...)
+	return nil
+}
+
+func (grpcCodec) Name() string {
+	return "proto"
+}
+
+// sensorReadingMessage encodes a reading as SensorReading message.
+func sensorReadingMessage(reading SensorReading) *protoMessage {
+	var timestamp protoMessage
+	timestamp.Int64(1, reading.Timestamp.Unix())
+
+	var m protoMessage
+	m.Message(1, &timestamp)
+	m.Double(2, reading.Temp)
+	m.Double(3, reading.Humidity)
+	m.Int64(4, int64(reading.BatteryMV))
+	m.Int64(5, int64(reading.BatteryLevel))
+	return &m
+}
+
+// streamHistory implements the StreamHistory RPC, sending the readings of
+// the requested range in chronological order.
+func streamHistory(_ any, stream grpc.ServerStream) error {
+	var data []byte
+	if err := stream.RecvMsg(&data); err != nil {
+		return err
+	}
+	fields, err := protoStrings(data)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	mac := strings.ToLower(fields[1])
+	config, ok := configMap[mac]
+	if !ok {
+		return status.Error(codes.NotFound, "sensor not found")
+	}
+	var from, to time.Time
+	if fields[2] != "" {
+		if from, err = time.Parse(time.RFC3339, fields[2]); err != nil {
+			return status.Error(codes.InvalidArgument, "invalid from, expected RFC3339")
+		}
+	}
+	if fields[3] != "" {
+		if to, err = time.Parse(time.RFC3339, fields[3]); err != nil {
+			return status.Error(codes.InvalidArgument, "invalid to, expected RFC3339")
+		}
+	}
+
+	readings, err := queryReadings(config.Db, from, to, 0, 1)
+	if err != nil {
+		log.Printf("%v", err)
+		return status.Error(codes.Internal, "data could not be loaded")
+	}
+	for _, reading := range readings {
+		if err := stream.SendMsg(sensorReadingMessage(reading)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var sensorServiceDesc = grpc.ServiceDesc{
+	ServiceName: "mijia.SensorService",
+	HandlerType: (*any)(nil),
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamHistory",
+			Handler:       streamHistory,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "sensor_service.proto",
+}
+
+// serveGrpc runs the gRPC SensorService on addr.
+func serveGrpc(addr string) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		log.Fatalf("Failed to listen for gRPC: %v", err)
+	}
+	server := grpc.NewServer(grpc.ForceServerCodec(grpcCodec{}))
+	server.RegisterService(&sensorServiceDesc, struct{}{})
+	fmt.Printf("gRPC SensorService is running on %s\n", addr)
+	log.Fatal(server.Serve(listener))
+}
+
+// exportGrpcStream is the HTTP mapping of StreamHistory in the format of
+// the gRPC-Gateway: one {"result": <SensorReading>} JSON object per line,
+// flushed as the readings are written, with the field names of the proto
+// file.
+func exportGrpcStream(w http.ResponseWriter, r *http.Request) {
+	history, ok := loadHistory(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	flusher, _ := w.(http.Flusher)
+	encoder := json.NewEncoder(w)
+	for i, reading := range history.Readings {
+		if err := encoder.Encode(map[string]any{"result": map[string]any{
+			"timestamp":     reading.Timestamp.UTC().Format(time.RFC3339),
+			"temp":          reading.Temp,
+			"humidity":      reading.Humidity,
+			"battery_mv":    reading.BatteryMV,
+			"battery_level": reading.BatteryLevel,
+		}}); err != nil {
+			log.Printf("%v", err)
+			return
+		}
+		if flusher != nil && i%100 == 99 {
+			flusher.Flush()
+		}
+	}
+}
+
+// grpcProtoHandler serves the proto file of the SensorService for client
+// code generation.
+func grpcProtoHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte(sensorServiceProto))
+}
@@ -0,0 +1,337 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"math/bits"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/deiu/rdf2go"
+)
+
+// HDT (rdfhdt.org) is written without libhdt: a Four Section Dictionary
+// with Plain Front Coding sections and BitmapTriples in SPO order, the
+// layout rdf2hdt produces by default.
+
+const (
+	hdtTypeGlobal     = 1
+	hdtTypeHeader     = 2
+	hdtTypeDictionary = 3
+	hdtTypeTriples    = 4
+
+	hdtSectionPFC   = 2
+	hdtSequenceLog  = 1
+	hdtBitmapPlain  = 1
+	hdtPFCBlockSize = 16
+	hdtMapping2     = 2 // subject and object IDs both continue after the shared terms
+
+	hdtVocabulary = "http://purl.org/HDT/hdt#"
+)
+
+var hdtCRC32 = crc32.MakeTable(crc32.Castagnoli)
+
+// hdtCRC8 is the CRC-8-CCITT (polynomial 0x07) of the section preambles.
+func hdtCRC8(data []byte) byte {
+	var crc byte
+	for _, b := range data {
+		crc ^= b
+		for range 8 {
+			if crc&0x80 != 0 {
+				crc = crc<<1 ^ 0x07
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+// hdtCRC16 is the CRC-16-ANSI (reflected polynomial 0xA001) of the control
+// information.
+func hdtCRC16(data []byte) uint16 {
+	var crc uint16
+	for _, b := range data {
+		crc ^= uint16(b)
+		for range 8 {
+			if crc&1 != 0 {
+				crc = crc>>1 ^ 0xA001
+			} else {
+				crc >>= 1
+			}
+		}
+	}
+	return crc
+}
+
+// hdtVByte appends v in the variable length encoding of HDT: 7 bits per
+// byte, least significant first, the high bit marks the last byte.
+func hdtVByte(b []byte, v uint64) []byte {
+	for v > 127 {
+		b = append(b, byte(v&127))
+		v >>= 7
+	}
+	return append(b, byte(v|0x80))
+}
+
+// hdtControlInfo writes the control information preceding each part.
+func hdtControlInfo(out *bytes.Buffer, typ byte, format string, properties [][2]string) {
+	b := []byte("$HDT")
+	b = append(b, typ)
+	b = append(b, format...)
+	b = append(b, 0)
+	for _, property := range properties {
+		b = append(b, property[0]+"="+property[1]+";"...)
+	}
+	b = append(b, 0)
+	out.Write(b)
+	binary.Write(out, binary.LittleEndian, hdtCRC16(b))
+}
+
+// hdtPackBits packs the values of width bits each, least significant bit
+// first, as the little endian words of HDT cut after the last used byte.
+func hdtPackBits(width int, values []uint64) []byte {
+	data := make([]byte, (width*len(values)+7)/8)
+	for i, v := range values {
+		for bit := range width {
+			if v>>bit&1 != 0 {
+				pos := i*width + bit
+				data[pos/8] |= 1 << (pos % 8)
+			}
+		}
+	}
+	return data
+}
+
+// hdtLogSequence writes a log sequence of values of the minimal width.
+func hdtLogSequence(out *bytes.Buffer, values []uint64) {
+	width := 0
+	for _, v := range values {
+		width = max(width, bits.Len64(v))
+	}
+	preamble := []byte{hdtSequenceLog, byte(width)}
+	preamble = hdtVByte(preamble, uint64(len(values)))
+	out.Write(preamble)
+	out.WriteByte(hdtCRC8(preamble))
+	data := hdtPackBits(width, values)
+	out.Write(data)
+	binary.Write(out, binary.LittleEndian, crc32.Checksum(data, hdtCRC32))
+}
+
+// hdtBitmap writes a plain bitmap.
+func hdtBitmap(out *bytes.Buffer, bitmap []bool) {
+	preamble := hdtVByte([]byte{hdtBitmapPlain}, uint64(len(bitmap)))
+	out.Write(preamble)
+	out.WriteByte(hdtCRC8(preamble))
+	values := make([]uint64, len(bitmap))
+	for i, set := range bitmap {
+		if set {
+			values[i] = 1
+		}
+	}
+	data := hdtPackBits(1, values)
+	out.Write(data)
+	binary.Write(out, binary.LittleEndian, crc32.Checksum(data, hdtCRC32))
+}
+
+// hdtPFCSection writes sorted strings as Plain Front Coding dictionary
+// section: blocks starting with a full string, followed by strings
+// encoded as length of the common prefix with the previous string and
+// the remaining suffix.
+func hdtPFCSection(out *bytes.Buffer, strs []string) {
+	var text []byte
+	var blocks []uint64
+	for i, s := range strs {
+		if i%hdtPFCBlockSize == 0 {
+			blocks = append(blocks, uint64(len(text)))
+			text = append(text, s...)
+		} else {
+			prev := strs[i-1]
+			prefix := 0
+			for prefix < len(prev) && prefix < len(s) && prev[prefix] == s[prefix] {
+				prefix++
+			}
+			text = hdtVByte(text, uint64(prefix))
+			text = append(text, s[prefix:]...)
+		}
+		text = append(text, 0)
+	}
+	blocks = append(blocks, uint64(len(text)))
+
+	preamble := []byte{hdtSectionPFC}
+	preamble = hdtVByte(preamble, uint64(len(strs)))
+	preamble = hdtVByte(preamble, uint64(len(text)))
+	preamble = hdtVByte(preamble, hdtPFCBlockSize)
+	out.Write(preamble)
+	out.WriteByte(hdtCRC8(preamble))
+	hdtLogSequence(out, blocks)
+	out.Write(text)
+	binary.Write(out, binary.LittleEndian, crc32.Checksum(text, hdtCRC32))
+}
+
+// hdtTerm is the dictionary string of a term: IRIs without brackets,
+// literals quoted with their language or datatype.
+func hdtTerm(term rdf2go.Term) string {
+	switch term := term.(type) {
+	case *rdf2go.Literal:
+		s := `"` + term.Value + `"`
+		if term.Language != "" {
+			s += "@" + term.Language
+		} else if term.Datatype != nil {
+			s += "^^<" + term.Datatype.RawValue() + ">"
+		}
+		return s
+	case *rdf2go.BlankNode:
+		return term.String()
+	}
+	return term.RawValue()
+}
+
+// buildHdt encodes the triples as HDT file describing the dataset baseURI.
+func buildHdt(baseURI string, triples []*rdf2go.Triple) []byte {
+	type spo [3]string
+	unique := map[spo]bool{}
+	subjects, predicates, objects := map[string]bool{}, map[string]bool{}, map[string]bool{}
+	for _, triple := range triples {
+		t := spo{hdtTerm(triple.Subject), hdtTerm(triple.Predicate), hdtTerm(triple.Object)}
+		unique[t] = true
+		subjects[t[0]], predicates[t[1]], objects[t[2]] = true, true, true
+	}
+
+	var shared, subjectOnly, objectOnly, predicateList []string
+	for s := range subjects {
+		if objects[s] {
+			shared = append(shared, s)
+		} else {
+			subjectOnly = append(subjectOnly, s)
+		}
+	}
+	for o := range objects {
+		if !subjects[o] {
+			objectOnly = append(objectOnly, o)
+		}
+	}
+	for p := range predicates {
+		predicateList = append(predicateList, p)
+	}
+	for _, section := range [][]string{shared, subjectOnly, objectOnly, predicateList} {
+		sort.Strings(section)
+	}
+
+	// shared IDs come first, then the subject or object section
+	subjectID, objectID, predicateID := map[string]uint64{}, map[string]uint64{}, map[string]uint64{}
+	for i, s := range shared {
+		subjectID[s], objectID[s] = uint64(i+1), uint64(i+1)
+	}
+	for i, s := range subjectOnly {
+		subjectID[s] = uint64(len(shared) + i + 1)
+	}
+	for i, o := range objectOnly {
+		objectID[o] = uint64(len(shared) + i + 1)
+	}
+	for i, p := range predicateList {
+		predicateID[p] = uint64(i + 1)
+	}
+
+	ids := make([][3]uint64, 0, len(unique))
+	for t := range unique {
+		ids = append(ids, [3]uint64{subjectID[t[0]], predicateID[t[1]], objectID[t[2]]})
+	}
+	slices.SortFunc(ids, func(a, b [3]uint64) int {
+		return cmp.Or(cmp.Compare(a[0], b[0]), cmp.Compare(a[1], b[1]), cmp.Compare(a[2], b[2]))
+	})
+
+	// BitmapTriples: the predicates of each subject in Y and the objects of
+	// each subject and predicate in Z, the bitmaps mark the last entries
+	var seqY, seqZ []uint64
+	var bitmapY, bitmapZ []bool
+	for i, t := range ids {
+		if i == 0 || t[0] != ids[i-1][0] || t[1] != ids[i-1][1] {
+			seqY = append(seqY, t[1])
+			bitmapY = append(bitmapY, false)
+		}
+		seqZ = append(seqZ, t[2])
+		bitmapZ = append(bitmapZ, false)
+		last := i == len(ids)-1
+		if last || t[0] != ids[i+1][0] {
+			bitmapY[len(bitmapY)-1] = true
+		}
+		if last || t[0] != ids[i+1][0] || t[1] != ids[i+1][1] {
+			bitmapZ[len(bitmapZ)-1] = true
+		}
+	}
+
+	sizeStrings := 0
+	for _, section := range [][]string{shared, subjectOnly, objectOnly, predicateList} {
+		for _, s := range section {
+			sizeStrings += len(s)
+		}
+	}
+	elements := len(shared) + len(subjectOnly) + len(objectOnly) + len(predicateList)
+
+	var header strings.Builder
+	base := "<" + baseURI + ">"
+	statement := func(s, p, o string) {
+		fmt.Fprintf(&header, "%s %s %s .\n", s, p, o)
+	}
+	count := func(n int) string { return fmt.Sprintf("%q", fmt.Sprint(n)) }
+	statement(base, "<"+rdfNamespace+"type>", "<"+hdtVocabulary+"Dataset>")
+	statement(base, "<"+rdfNamespace+"type>", "<http://rdfs.org/ns/void#Dataset>")
+	statement(base, "<http://rdfs.org/ns/void#triples>", count(len(ids)))
+	statement(base, "<http://rdfs.org/ns/void#properties>", count(len(predicateList)))
+	statement(base, "<http://rdfs.org/ns/void#distinctSubjects>", count(len(shared)+len(subjectOnly)))
+	statement(base, "<http://rdfs.org/ns/void#distinctObjects>", count(len(shared)+len(objectOnly)))
+	statement(base, "<"+hdtVocabulary+"formatInformation>", "_:format")
+	statement("_:format", "<"+hdtVocabulary+"dictionary>", "_:dictionary")
+	statement("_:format", "<"+hdtVocabulary+"triples>", "_:triples")
+	statement("_:dictionary", "<http://purl.org/dc/terms/format>", "<"+hdtVocabulary+"dictionaryFour>")
+	statement("_:dictionary", "<"+hdtVocabulary+"dictionarynumSharedSubjectObject>", count(len(shared)))
+	statement("_:dictionary", "<"+hdtVocabulary+"dictionarymapping>", count(hdtMapping2))
+	statement("_:dictionary", "<"+hdtVocabulary+"dictionarysizeStrings>", count(sizeStrings))
+	statement("_:dictionary", "<"+hdtVocabulary+"dictionaryBlockSize>", count(hdtPFCBlockSize))
+	statement("_:triples", "<http://purl.org/dc/terms/format>", "<"+hdtVocabulary+"triplesBitmap>")
+	statement("_:triples", "<"+hdtVocabulary+"triplesnumTriples>", count(len(ids)))
+	statement("_:triples", "<"+hdtVocabulary+"triplesOrder>", `"SPO"`)
+
+	var out bytes.Buffer
+	hdtControlInfo(&out, hdtTypeGlobal, "<"+hdtVocabulary+"HDTv1>", [][2]string{{"BaseUri", baseURI}})
+	hdtControlInfo(&out, hdtTypeHeader, "ntriples", [][2]string{{"length", fmt.Sprint(header.Len())}})
+	out.WriteString(header.String())
+	hdtControlInfo(&out, hdtTypeDictionary, "<"+hdtVocabulary+"dictionaryFour>", [][2]string{
+		{"elements", fmt.Sprint(elements)},
+		{"mapping", fmt.Sprint(hdtMapping2)},
+		{"sizeStrings", fmt.Sprint(sizeStrings)},
+	})
+	hdtPFCSection(&out, shared)
+	hdtPFCSection(&out, subjectOnly)
+	hdtPFCSection(&out, predicateList)
+	hdtPFCSection(&out, objectOnly)
+	// order 1 is SPO
+	hdtControlInfo(&out, hdtTypeTriples, "<"+hdtVocabulary+"triplesBitmap>", [][2]string{{"order", "1"}})
+	hdtBitmap(&out, bitmapY)
+	hdtBitmap(&out, bitmapZ)
+	hdtLogSequence(&out, seqY)
+	hdtLogSequence(&out, seqZ)
+	return out.Bytes()
+}
+
+// exportHdt writes the RDF graph of the history as HDT file, queryable
+// with hdtSearch without loading it into a triple store.
+func exportHdt(w http.ResponseWriter, r *http.Request) {
+	history, ok := loadHistory(w, r)
+	if !ok {
+		return
+	}
+
+	triples := sensorTriples(history.Mac, history.Loc)
+	for _, reading := range history.Readings {
+		triples = append(triples, readingTriples(history.Mac, reading)...)
+	}
+	setAttachment(w, "application/vnd.hdt", exportFilename(history.Mac, "hdt"))
+	w.Write(buildHdt(sensorIRI(history.Mac), triples))
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// hdtReader decodes the parts of an HDT file written by buildHdt, checking
+// the CRCs on the way.
+type hdtReader struct {
+	t    *testing.T
+	data []byte
+	pos  int
+}
+
+func (r *hdtReader) next(n int) []byte {
+	r.t.Helper()
+	if r.pos+n > len(r.data) {
+		r.t.Fatalf("unexpected end of file at %d reading %d bytes", r.pos, n)
+	}
+	b := r.data[r.pos : r.pos+n]
+	r.pos += n
+	return b
+}
+
+func (r *hdtReader) vbyte() uint64 {
+	var v uint64
+	for shift := 0; ; shift += 7 {
+		b := r.next(1)[0]
+		v |= uint64(b&127) << shift
+		if b&0x80 != 0 {
+			return v
+		}
+	}
+}
+
+func (r *hdtReader) cstring() string {
+	end := bytes.IndexByte(r.data[r.pos:], 0)
+	if end < 0 {
+		r.t.Fatalf("unterminated string at %d", r.pos)
+	}
+	s := string(r.next(end))
+	r.next(1)
+	return s
+}
+
+func (r *hdtReader) checkCRC8(start int) {
+	r.t.Helper()
+	if want := hdtCRC8(r.data[start:r.pos]); r.next(1)[0] != want {
+		r.t.Fatalf("CRC8 mismatch of the preamble at %d", start)
+	}
+}
+
+func (r *hdtReader) checkCRC32(data []byte) {
+	r.t.Helper()
+	if binary.LittleEndian.Uint32(r.next(4)) != crc32.Checksum(data, hdtCRC32) {
+		r.t.Fatalf("CRC32 mismatch at %d", r.pos)
+	}
+}
+
+func (r *hdtReader) controlInfo(typ byte) (string, map[string]string) {
+	r.t.Helper()
+	start := r.pos
+	if magic := string(r.next(4)); magic != "$HDT" {
+		r.t.Fatalf("got magic %q, want $HDT", magic)
+	}
+	if got := r.next(1)[0]; got != typ {
+		r.t.Fatalf("got control information of type %d, want %d", got, typ)
+	}
+	format := r.cstring()
+	properties := map[string]string{}
+	for _, property := range bytes.Split([]byte(r.cstring()), []byte(";")) {
+		if key, value, ok := bytes.Cut(property, []byte("=")); ok {
+			properties[string(key)] = string(value)
+		}
+	}
+	if binary.LittleEndian.Uint16(r.next(2)) != hdtCRC16(r.data[start:r.pos-2]) {
+		r.t.Fatalf("CRC16 mismatch of the control information at %d", start)
+	}
+	return format, properties
+}
+
+func (r *hdtReader) unpack(width int, n int) []uint64 {
+	data := r.next((width*n + 7) / 8)
+	values := make([]uint64, n)
+	for i := range values {
+		for bit := range width {
+			pos := i*width + bit
+			if data[pos/8]>>(pos%8)&1 != 0 {
+				values[i] |= 1 << bit
+			}
+		}
+	}
+	r.checkCRC32(data)
+	return values
+}
+
+func (r *hdtReader) logSequence() []uint64 {
+	start := r.pos
+	if typ := r.next(1)[0]; typ != hdtSequenceLog {
+		r.t.Fatalf("got sequence type %d, want %d", typ, hdtSequenceLog)
+	}
+	width := int(r.next(1)[0])
+	n := int(r.vbyte())
+	r.checkCRC8(start)
+	return r.unpack(width, n)
+}
+
+func (r *hdtReader) bitmap() []uint64 {
+	start := r.pos
+	if typ := r.next(1)[0]; typ != hdtBitmapPlain {
+		r.t.Fatalf("got bitmap type %d, want %d", typ, hdtBitmapPlain)
+	}
+	n := int(r.vbyte())
+	r.checkCRC8(start)
+	return r.unpack(1, n)
+}
+
+func (r *hdtReader) pfcSection() []string {
+	start := r.pos
+	if typ := r.next(1)[0]; typ != hdtSectionPFC {
+		r.t.Fatalf("got section type %d, want %d", typ, hdtSectionPFC)
+	}
+	n := int(r.vbyte())
+	textLength := int(r.vbyte())
+	blockSize := int(r.vbyte())
+	r.checkCRC8(start)
+	blocks := r.logSequence()
+	text := r.next(textLength)
+	r.checkCRC32(text)
+
+	section := &hdtReader{t: r.t, data: text}
+	var strs []string
+	for i := range n {
+		if i%blockSize == 0 {
+			if uint64(section.pos) != blocks[i/blockSize] {
+				r.t.Fatalf("block %d starts at %d, want %d", i/blockSize, section.pos, blocks[i/blockSize])
+			}
+			strs = append(strs, section.cstring())
+			continue
+		}
+		prefix := section.vbyte()
+		strs = append(strs, strs[i-1][:prefix]+section.cstring())
+	}
+	return strs
+}
+
+func TestBuildHdtRoundTrip(t *testing.T) {
+	mac := "a4:c1:38:44:55:66"
+	triples := sensorTriples(mac, "Bath")
+	for i := range 20 {
+		triples = append(triples, readingTriples(mac, SensorReading{
+			Timestamp:    time.Date(2026, 10, 10, 0, 15*i, 0, 0, time.UTC),
+			Temp:         20 + float64(i)/10,
+			Humidity:     45,
+			BatteryMV:    2900,
+			BatteryLevel: 80,
+		})...)
+	}
+	want := map[[3]string]bool{}
+	for _, triple := range triples {
+		want[[3]string{hdtTerm(triple.Subject), hdtTerm(triple.Predicate), hdtTerm(triple.Object)}] = true
+	}
+
+	r := &hdtReader{t: t, data: buildHdt(sensorIRI(mac), triples)}
+	r.controlInfo(hdtTypeGlobal)
+	_, header := r.controlInfo(hdtTypeHeader)
+	length, err := strconv.Atoi(header["length"])
+	if err != nil {
+		t.Fatalf("invalid header length %q", header["length"])
+	}
+	r.next(length)
+
+	_, dictionary := r.controlInfo(hdtTypeDictionary)
+	if dictionary["mapping"] != "2" {
+		t.Errorf("got dictionary mapping %q, want 2", dictionary["mapping"])
+	}
+	shared := r.pfcSection()
+	subjects := r.pfcSection()
+	predicates := r.pfcSection()
+	objects := r.pfcSection()
+
+	_, triplesInfo := r.controlInfo(hdtTypeTriples)
+	if triplesInfo["order"] != "1" {
+		t.Errorf("got triples order %q, want 1 (SPO)", triplesInfo["order"])
+	}
+	bitmapY, bitmapZ := r.bitmap(), r.bitmap()
+	seqY, seqZ := r.logSequence(), r.logSequence()
+	if r.pos != len(r.data) {
+		t.Errorf("%d trailing bytes", len(r.data)-r.pos)
+	}
+
+	// MAPPING2: subject-only and object-only IDs both follow the shared IDs
+	term := func(id uint64, section []string) string {
+		t.Helper()
+		if id >= 1 && id <= uint64(len(shared)) {
+			return shared[id-1]
+		}
+		if id > uint64(len(shared)) && id <= uint64(len(shared)+len(section)) {
+			return section[id-uint64(len(shared))-1]
+		}
+		t.Fatalf("ID %d out of range", id)
+		return ""
+	}
+	got := map[[3]string]bool{}
+	subject, z := uint64(1), 0
+	for y, predicate := range seqY {
+		for {
+			got[[3]string{term(subject, subjects), predicates[predicate-1], term(seqZ[z], objects)}] = true
+			z++
+			if bitmapZ[z-1] == 1 {
+				break
+			}
+		}
+		if bitmapY[y] == 1 {
+			subject++
+		}
+	}
+	if z != len(seqZ) {
+		t.Errorf("decoded %d of %d objects", z, len(seqZ))
+	}
+
+	if len(got) != len(want) {
+		t.Errorf("decoded %d triples, want %d", len(got), len(want))
+	}
+	for triple := range want {
+		if !got[triple] {
+			t.Errorf("missing triple %q", triple)
+		}
+	}
+}
@@ -0,0 +1,583 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"syscall"
+	texttemplate "text/template"
+	"time"
+)
+
+// SensorReading is a single row of the sensor_data table, already scaled
+// to °C and %.
+type SensorReading struct {
+	Timestamp    time.Time `json:"timestamp"`
+	Temp         float64   `json:"temp"`
+	Humidity     float64   `json:"humidity"`
+	BatteryMV    int16     `json:"battery_mv"`
+	BatteryLevel int8      `json:"battery_level"`
+}
+
+// SensorHistory holds the readings of one sensor for the requested range.
+type SensorHistory struct {
+	Mac      string
+	Loc      string
+	Readings []SensorReading
+}
+
+// the logger stores timestamps with sqlite's CURRENT_TIMESTAMP (UTC)
+const sqliteTimeFormat = "2006-01-02 15:04:05"
+
+// parseTimeParam parses an optional RFC3339 query parameter.
+func parseTimeParam(r *http.Request, name string) (time.Time, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid %s parameter, expected RFC3339", name)
+	}
+	return t, nil
+}
+
+// parsePageParams parses the optional page_size and page (starting at 1)
+// query parameters. A page size of 0 means no pagination.
+func parsePageParams(r *http.Request) (int, int, error) {
+	pageSize, page := 0, 1
+	var err error
+	if value := r.URL.Query().Get("page_size"); value != "" {
+		if pageSize, err = strconv.Atoi(value); err != nil || pageSize < 1 {
+			return 0, 0, fmt.Errorf("invalid page_size parameter")
+		}
+	}
+	if value := r.URL.Query().Get("page"); value != "" {
+		if page, err = strconv.Atoi(value); err != nil || page < 1 {
+			return 0, 0, fmt.Errorf("invalid page parameter")
+		}
+	}
+	return pageSize, page, nil
+}
+
+// loadSensor looks up the sensor given by the {mac} path value without
+// reading any data, for exports that only describe the history.
+// On failure the error is written to w and false is returned.
+func loadSensor(w http.ResponseWriter, r *http.Request) (*SensorHistory, bool) {
+	mac := strings.ToLower(r.PathValue("mac"))
+	config, ok := configMap[mac]
+	if !ok {
+		http.Error(w, "Sensor not found", http.StatusNotFound)
+		return nil, false
+	}
+	return &SensorHistory{Mac: mac, Loc: config.Loc}, true
+}
+
+// loadHistory reads the readings of the sensor given by the {mac} path
+// value, optionally limited by the from and to query parameters and
+// paginated by page_size and page.
+// On failure the error is written to w and false is returned.
+func loadHistory(w http.ResponseWriter, r *http.Request) (*SensorHistory, bool) {
+	history, ok := loadSensor(w, r)
+	if !ok {
+		return nil, false
+	}
+	config := configMap[history.Mac]
+
+	from, err := parseTimeParam(r, "from")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+	to, err := parseTimeParam(r, "to")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+	pageSize, page, err := parsePageParams(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+
+	history.Readings, err = queryReadings(config.Db, from, to, pageSize, page)
+	if err != nil {
+		log.Printf("%v", err)
+		http.Error(w, "Data could not be loaded", http.StatusInternalServerError)
+		return nil, false
+	}
+
+	return history, true
+}
+
+// readingsFilter returns the WHERE clause and its arguments selecting the
+// readings between from and to (both optional).
+func readingsFilter(from, to time.Time) (string, []any) {
+	where := "WHERE 1=1"
+	var args []any
+	if !from.IsZero() {
+		where += " AND timestamp >= ?"
+		args = append(args, from.UTC().Format(sqliteTimeFormat))
+	}
+	if !to.IsZero() {
+		where += " AND timestamp <= ?"
+		args = append(args, to.UTC().Format(sqliteTimeFormat))
+	}
+	return where, args
+}
+
+// queryReadings reads the readings between from and to (both optional)
+// from the logger database, paginated if pageSize is not 0.
+func queryReadings(db *sql.DB, from, to time.Time, pageSize, page int) ([]SensorReading, error) {
+	where, args := readingsFilter(from, to)
+	query := `
+		SELECT temp, humidity, battery_mv, battery_level, timestamp
+		FROM sensor_data
+		` + where + " ORDER BY timestamp ASC"
+	if pageSize > 0 {
+		query += " LIMIT ? OFFSET ?"
+		args = append(args, pageSize, (page-1)*pageSize)
+	}
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var readings []SensorReading
+	for rows.Next() {
+		var reading SensorReading
+		if err := rows.Scan(
+			&reading.Temp,
+			&reading.Humidity,
+			&reading.BatteryMV,
+			&reading.BatteryLevel,
+			&reading.Timestamp,
+		); err != nil {
+			return nil, err
+		}
+		reading.Temp /= 100
+		reading.Humidity /= 100
+		readings = append(readings, reading)
+	}
+	return readings, rows.Err()
+
+}
+
+// serverURL returns the scheme and host the request was made to, so
+// generated files can point back to this server.
+func serverURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%s://%s", scheme, r.Host)
+}
+
+// historyURL returns the absolute URL of a history resource of the sensor,
+// e.g. historyURL(r, mac, "") for the JSON API.
+func historyURL(r *http.Request, mac string, export string) string {
+	url := fmt.Sprintf("%s/api/sensors/%s/history", serverURL(r), mac)
+	if export != "" {
+		url += "/export." + export
+	}
+	return url
+}
+
+// readingURL is the permanent URL of a single reading: the history API
+// limited to the timestamp of the reading.
+func readingURL(r *http.Request, mac string, reading SensorReading) string {
+	timestamp := reading.Timestamp.UTC().Format(time.RFC3339)
+	return fmt.Sprintf("%s?from=%s&to=%s", historyURL(r, mac, ""), timestamp, timestamp)
+}
+
+// sensorResource describes a sensor and links to its history.
+func sensorResource(w http.ResponseWriter, r *http.Request) {
+	history, ok := loadSensor(w, r)
+	if !ok {
+		return
+	}
+	config := configMap[history.Mac]
+	writeJSON(w, "application/json", map[string]any{
+		"mac":     history.Mac,
+		"loc":     config.Loc,
+		"group":   config.Group,
+		"history": historyURL(r, history.Mac, ""),
+	})
+}
+
+// sensorName turns the MAC into an identifier like mijia_a4c138000000,
+// usable as file, table or topic name.
+func sensorName(mac string) string {
+	return "mijia_" + strings.ReplaceAll(mac, ":", "")
+}
+
+// exportFilename builds a download filename for the sensor like
+// mijia_a4c138000000.zip.
+func exportFilename(mac string, ext string) string {
+	return sensorName(mac) + "." + ext
+}
+
+func setAttachment(w http.ResponseWriter, contentType string, filename string) {
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+}
+
+type zipFile struct {
+	Name string
+	Data []byte
+}
+
+// buildZip packs files into a zip archive in memory.
+func buildZip(files []zipFile) ([]byte, error) {
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	for _, file := range files {
+		f, err := archive.Create(file.Name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := f.Write(file.Data); err != nil {
+			return nil, err
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// writeZip sends files as a single zip archive.
+func writeZip(w http.ResponseWriter, filename string, files []zipFile) {
+	data, err := buildZip(files)
+	if err != nil {
+		exportError(w, err)
+		return
+	}
+	setAttachment(w, "application/zip", filename)
+	w.Write(data)
+}
+
+func writeJSON(w http.ResponseWriter, contentType string, v any) {
+	w.Header().Set("Content-Type", contentType)
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(v); err != nil {
+		log.Printf("%v", err)
+	}
+}
+
+// orderedObject is a JSON object keeping the order of its keys, like the
+// selection of a GraphQL query or the properties of an OData entity.
+type orderedObject []struct {
+	Key   string
+	Value any
+}
+
+func (o orderedObject) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, field := range o {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, _ := json.Marshal(field.Key)
+		value, err := json.Marshal(field.Value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+func (o *orderedObject) set(key string, value any) {
+	*o = append(*o, struct {
+		Key   string
+		Value any
+	}{key, value})
+}
+
+// exportFuncs are available in all export templates.
+var exportFuncs = texttemplate.FuncMap{
+	// double quoted string literal, valid in Python, JavaScript and JSON
+	"quote": strconv.Quote,
+	// single quoted SQL string literal
+	"sqlquote": sqlQuote,
+	// single quoted POSIX shell word
+	"shellquote": func(s string) string {
+		return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+	},
+	"batch": batchReadings,
+	// value in hundredths as stored by the logger
+	"centi": func(v float64) int {
+		return int(math.Round(v * 100))
+	},
+	"seq": func(from int, to int) []int {
+		var s []int
+		for i := from; i <= to; i++ {
+			s = append(s, i)
+		}
+		return s
+	},
+}
+
+// batchReadings splits readings into chunks of at most size readings.
+func batchReadings(readings []SensorReading, size int) [][]SensorReading {
+	var batches [][]SensorReading
+	for len(readings) > size {
+		batches = append(batches, readings[:size])
+		readings = readings[size:]
+	}
+	if len(readings) > 0 {
+		batches = append(batches, readings)
+	}
+	return batches
+}
+
+func sqlQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// parseExportTemplate parses templates/export/<name> as text template.
+// The templates defined in the include files can be used by name, e.g.
+// the DDL of postgresql.sql for other PostgreSQL compatible databases.
+func parseExportTemplate(name string, includes ...string) (*texttemplate.Template, error) {
+	files := []string{"templates/export/" + name}
+	for _, include := range includes {
+		files = append(files, "templates/export/"+include)
+	}
+	return texttemplate.New(name).Funcs(exportFuncs).ParseFiles(files...)
+}
+
+// executeExportTemplate executes a parsed export template, for templates
+// rendered repeatedly like per batch.
+func executeExportTemplate(tmpl *texttemplate.Template, data any) ([]byte, error) {
+	var out strings.Builder
+	if err := tmpl.Execute(&out, data); err != nil {
+		return nil, err
+	}
+	return []byte(out.String()), nil
+}
+
+// renderExportTemplate parses and executes templates/export/<name>, see
+// parseExportTemplate for the includes.
+func renderExportTemplate(name string, data any, includes ...string) ([]byte, error) {
+	tmpl, err := parseExportTemplate(name, includes...)
+	if err != nil {
+		return nil, err
+	}
+	return executeExportTemplate(tmpl, data)
+}
+
+// renderExportFiles renders each template into a file for writeZip,
+// templates maps the template name to the file name in the archive.
+func renderExportFiles(data any, templates [][2]string) ([]zipFile, error) {
+	var files []zipFile
+	for _, t := range templates {
+		content, err := renderExportTemplate(t[0], data)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, zipFile{Name: t[1], Data: content})
+	}
+	return files, nil
+}
+
+// exportError logs err and reports a failed export to the client.
+func exportError(w http.ResponseWriter, err error) {
+	log.Printf("%v", err)
+	http.Error(w, "Error rendering export", http.StatusInternalServerError)
+}
+
+// exportContext is passed to the export templates.
+type exportContext struct {
+	*SensorHistory
+	Name       string
+	ServerURL  string
+	HistoryURL string
+	CSVURL     string
+}
+
+func newExportContext(r *http.Request, history *SensorHistory) exportContext {
+	return exportContext{
+		SensorHistory: history,
+		Name:          sensorName(history.Mac),
+		ServerURL:     serverURL(r),
+		HistoryURL:    historyURL(r, history.Mac, ""),
+		CSVURL:        historyURL(r, history.Mac, "csv"),
+	}
+}
+
+// sensorReadingSchema is the JSON Schema of a SensorReading as returned by
+// the JSON history API.
+func sensorReadingSchema() map[string]any {
+	return map[string]any{
+		"$schema":              "http://json-schema.org/draft-07/schema#",
+		"title":                "SensorReading",
+		"type":                 "object",
+		"additionalProperties": false,
+		"required":             []string{"timestamp", "temp", "humidity", "battery_mv", "battery_level"},
+		"properties": map[string]any{
+			"timestamp": map[string]any{
+				"type":        "string",
+				"format":      "date-time",
+				"description": "Time of the reading in UTC",
+			},
+			"temp": map[string]any{
+				"type":        "number",
+				"description": "Temperature in °C",
+			},
+			"humidity": map[string]any{
+				"type":        "number",
+				"description": "Relative humidity in %",
+			},
+			"battery_mv": map[string]any{
+				"type":        "integer",
+				"description": "Battery voltage in mV",
+			},
+			"battery_level": map[string]any{
+				"type":        "integer",
+				"description": "Battery level in %",
+			},
+		},
+	}
+}
+
+// sensorHistory is the JSON history API the generated exports build on.
+func sensorHistory(w http.ResponseWriter, r *http.Request) {
+	history, ok := loadHistory(w, r)
+	if !ok {
+		return
+	}
+	readings := history.Readings
+	if readings == nil {
+		readings = []SensorReading{}
+	}
+	websubLinks(w, r, history.Mac)
+	writeJSON(w, "application/json", readings)
+}
+
+// exportCSV writes the history as CSV, the base for most file imports.
+func exportCSV(w http.ResponseWriter, r *http.Request) {
+	history, ok := loadHistory(w, r)
+	if !ok {
+		return
+	}
+
+	setAttachment(w, "text/csv", exportFilename(history.Mac, "csv"))
+	if err := writeHistoryCSV(w, history); err != nil {
+		log.Printf("%v", err)
+	}
+}
+
+// writeHistoryCSV writes the readings in the format of the CSV export.
+func writeHistoryCSV(w io.Writer, history *SensorHistory) error {
+	out := csv.NewWriter(w)
+	out.Write([]string{"timestamp", "temp", "humidity", "battery_mv", "battery_level"})
+	for _, reading := range history.Readings {
+		out.Write([]string{
+			reading.Timestamp.Format(time.RFC3339),
+			strconv.FormatFloat(reading.Temp, 'f', -1, 64),
+			strconv.FormatFloat(reading.Humidity, 'f', -1, 64),
+			strconv.Itoa(int(reading.BatteryMV)),
+			strconv.Itoa(int(reading.BatteryLevel)),
+		})
+	}
+	out.Flush()
+	return out.Error()
+}
+
+// exportJSONL writes the readings of the JSON history API as JSON lines,
+// for loaders streaming one reading at a time.
+func exportJSONL(w http.ResponseWriter, r *http.Request) {
+	history, ok := loadHistory(w, r)
+	if !ok {
+		return
+	}
+
+	setAttachment(w, "application/x-ndjson", exportFilename(history.Mac, "jsonl"))
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	for _, reading := range history.Readings {
+		if err := encoder.Encode(reading); err != nil {
+			log.Printf("%v", err)
+			return
+		}
+	}
+}
+
+var pushClient = &http.Client{Timeout: 60 * time.Second}
+
+// publicClient returns a client that only connects to public addresses,
+// for URLs chosen by the requests like JSON-LD frames and WebSub callbacks.
+// The address is checked on connect, after the DNS lookup and on redirects.
+func publicClient(timeout time.Duration) *http.Client {
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext: (&net.Dialer{
+				Timeout: timeout,
+				Control: func(network, address string, c syscall.RawConn) error {
+					host, _, err := net.SplitHostPort(address)
+					if err != nil {
+						return err
+					}
+					if ip := net.ParseIP(host); ip == nil || !publicIP(ip) {
+						return fmt.Errorf("address %s is not allowed", host)
+					}
+					return nil
+				},
+			}).DialContext,
+			TLSHandshakeTimeout:   timeout,
+			ResponseHeaderTimeout: timeout,
+		},
+	}
+}
+
+// publicIP reports whether ip is a globally routable unicast address.
+func publicIP(ip net.IP) bool {
+	return ip.IsGlobalUnicast() && !ip.IsPrivate() && !ip.IsLoopback() &&
+		!ip.IsLinkLocalUnicast() && !ip.IsUnspecified()
+}
+
+// pushRequest sends req to a push target of an export. A non 2xx status is
+// returned as error, otherwise the JSON response is decoded into result
+// unless it is nil.
+func pushRequest(req *http.Request, result any) error {
+	resp, err := pushClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%s returned %s: %s", req.URL.Host, resp.Status, strings.TrimSpace(string(body)))
+	}
+	if result == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
+
+// pushError reports a failed push to the client.
+func pushError(w http.ResponseWriter, err error) {
+	log.Printf("%v", err)
+	http.Error(w, fmt.Sprintf("Push failed: %v", err), http.StatusBadGateway)
+}
@@ -0,0 +1,425 @@
+package main
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// hypermediaPageSize is the page size of the hypermedia exports if the
+// page_size parameter is not given.
+const hypermediaPageSize = 100
+
+// historyPage is a page of the history for the hypermedia exports, which
+// link to the neighbouring pages.
+type historyPage struct {
+	*SensorHistory
+	r        *http.Request
+	Total    int
+	PageSize int
+	Page     int
+}
+
+// countReadings counts the readings between from and to (both optional).
+func countReadings(db *sql.DB, from, to time.Time) (int, error) {
+	where, args := readingsFilter(from, to)
+	var count int
+	err := db.QueryRow("SELECT COUNT(*) FROM sensor_data "+where, args...).Scan(&count)
+	return count, err
+}
+
+// loadHistoryPage reads a page of the history like loadHistory, always
+// paginated, and counts the readings of all pages.
+// On failure the error is written to w and false is returned.
+func loadHistoryPage(w http.ResponseWriter, r *http.Request) (*historyPage, bool) {
+	history, ok := loadSensor(w, r)
+	if !ok {
+		return nil, false
+	}
+	config := configMap[history.Mac]
+
+	from, err := parseTimeParam(r, "from")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+	to, err := parseTimeParam(r, "to")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+	pageSize, page, err := parsePageParams(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+	if pageSize == 0 {
+		pageSize = hypermediaPageSize
+	}
+
+	total, err := countReadings(config.Db, from, to)
+	if err == nil {
+		history.Readings, err = queryReadings(config.Db, from, to, pageSize, page)
+	}
+	if err != nil {
+		log.Printf("%v", err)
+		http.Error(w, "Data could not be loaded", http.StatusInternalServerError)
+		return nil, false
+	}
+
+	return &historyPage{SensorHistory: history, r: r, Total: total, PageSize: pageSize, Page: page}, true
+}
+
+// LastPage is the number of the last page, 1 for an empty history.
+func (p *historyPage) LastPage() int {
+	return max(1, (p.Total+p.PageSize-1)/p.PageSize)
+}
+
+// URL returns the URL of a page of the export, keeping the other query
+// parameters of the request.
+func (p *historyPage) URL(export string, page int) string {
+	query := p.r.URL.Query()
+	query.Set("page_size", strconv.Itoa(p.PageSize))
+	query.Set("page", strconv.Itoa(page))
+	return historyURL(p.r, p.Mac, export) + "?" + query.Encode()
+}
+
+// NextURL returns the URL of the next page, or "" on the last page.
+func (p *historyPage) NextURL(export string) string {
+	if p.Page >= p.LastPage() {
+		return ""
+	}
+	return p.URL(export, p.Page+1)
+}
+
+// PrevURL returns the URL of the previous page, or "" on the first page.
+func (p *historyPage) PrevURL(export string) string {
+	if p.Page <= 1 {
+		return ""
+	}
+	return p.URL(export, min(p.Page-1, p.LastPage()))
+}
+
+// nullableURL maps a missing link to null instead of an empty string.
+func nullableURL(url string) any {
+	if url == "" {
+		return nil
+	}
+	return url
+}
+
+// exportJsonapi writes a page of the history as JSON:API document, the
+// readings are resources related to the included sensor resource.
+func exportJsonapi(w http.ResponseWriter, r *http.Request) {
+	page, ok := loadHistoryPage(w, r)
+	if !ok {
+		return
+	}
+
+	sensor := map[string]any{"type": "sensor", "id": page.Mac}
+	data := []any{}
+	for _, reading := range page.Readings {
+		timestamp := reading.Timestamp.UTC().Format(time.RFC3339)
+		data = append(data, map[string]any{
+			"type": "sensor-reading",
+			"id":   page.Mac + "-" + timestamp,
+			"attributes": map[string]any{
+				"timestamp":     timestamp,
+				"temp":          reading.Temp,
+				"humidity":      reading.Humidity,
+				"battery_mv":    reading.BatteryMV,
+				"battery_level": reading.BatteryLevel,
+			},
+			"relationships": map[string]any{
+				"sensor": map[string]any{"data": sensor},
+			},
+		})
+	}
+	config := configMap[page.Mac]
+
+	writeJSON(w, "application/vnd.api+json", map[string]any{
+		"jsonapi": map[string]any{"version": "1.1"},
+		"data":    data,
+		"included": []any{map[string]any{
+			"type": "sensor",
+			"id":   page.Mac,
+			"attributes": map[string]any{
+				"loc":   config.Loc,
+				"group": config.Group,
+			},
+		}},
+		"links": map[string]any{
+			"self":  page.URL("jsonapi", page.Page),
+			"first": page.URL("jsonapi", 1),
+			"last":  page.URL("jsonapi", page.LastPage()),
+			"prev":  nullableURL(page.PrevURL("jsonapi")),
+			"next":  nullableURL(page.NextURL("jsonapi")),
+		},
+		"meta": map[string]any{
+			"total_count": page.Total,
+			"page_size":   page.PageSize,
+			"page":        page.Page,
+		},
+	})
+}
+
+// halLinks builds HAL links from relation and URL pairs, skipping missing
+// links.
+func halLinks(links ...string) map[string]any {
+	result := map[string]any{}
+	for i := 0; i+1 < len(links); i += 2 {
+		if links[i+1] != "" {
+			result[links[i]] = map[string]string{"href": links[i+1]}
+		}
+	}
+	return result
+}
+
+// exportHal writes a page of the history as HAL document with the readings
+// embedded.
+func exportHal(w http.ResponseWriter, r *http.Request) {
+	page, ok := loadHistoryPage(w, r)
+	if !ok {
+		return
+	}
+
+	readings := []any{}
+	for _, reading := range page.Readings {
+		readings = append(readings, map[string]any{
+			"_links":        halLinks("self", readingURL(r, page.Mac, reading)),
+			"timestamp":     reading.Timestamp.UTC().Format(time.RFC3339),
+			"temp":          reading.Temp,
+			"humidity":      reading.Humidity,
+			"battery_mv":    reading.BatteryMV,
+			"battery_level": reading.BatteryLevel,
+		})
+	}
+
+	writeJSON(w, "application/hal+json", map[string]any{
+		"_embedded": map[string]any{"readings": readings},
+		"_links": halLinks(
+			"self", page.URL("hal", page.Page),
+			"first", page.URL("hal", 1),
+			"last", page.URL("hal", page.LastPage()),
+			"prev", page.PrevURL("hal"),
+			"next", page.NextURL("hal"),
+			"sensor", serverURL(r)+"/api/sensors/"+page.Mac,
+		),
+		"total_count": page.Total,
+		"page_size":   page.PageSize,
+		"page":        page.Page,
+	})
+}
+
+// sirenLinks builds Siren links from relation and URL pairs, skipping
+// missing links.
+func sirenLinks(links ...string) []any {
+	result := []any{}
+	for i := 0; i+1 < len(links); i += 2 {
+		if links[i+1] != "" {
+			result = append(result, map[string]any{"rel": []string{links[i]}, "href": links[i+1]})
+		}
+	}
+	return result
+}
+
+// exportSiren writes a page of the history as Siren entity with the
+// readings as sub-entities and an action filtering the history by date.
+func exportSiren(w http.ResponseWriter, r *http.Request) {
+	page, ok := loadHistoryPage(w, r)
+	if !ok {
+		return
+	}
+
+	entities := []any{}
+	for _, reading := range page.Readings {
+		entities = append(entities, map[string]any{
+			"class": []string{"sensor-reading"},
+			"rel":   []string{"item"},
+			"properties": map[string]any{
+				"timestamp":     reading.Timestamp.UTC().Format(time.RFC3339),
+				"temp":          reading.Temp,
+				"humidity":      reading.Humidity,
+				"battery_mv":    reading.BatteryMV,
+				"battery_level": reading.BatteryLevel,
+			},
+			"links": sirenLinks("self", readingURL(r, page.Mac, reading)),
+		})
+	}
+
+	writeJSON(w, "application/vnd.siren+json", map[string]any{
+		"class": []string{"sensor-history"},
+		"properties": map[string]any{
+			"mac":         page.Mac,
+			"loc":         page.Loc,
+			"total_count": page.Total,
+			"page_size":   page.PageSize,
+			"page":        page.Page,
+		},
+		"entities": entities,
+		"actions": []any{map[string]any{
+			"name":   "filter-by-date",
+			"title":  "Filter the readings by date",
+			"method": "GET",
+			"href":   historyURL(r, page.Mac, "siren"),
+			"type":   "application/x-www-form-urlencoded",
+			"fields": []any{
+				map[string]any{"name": "from", "type": "text", "title": "From (RFC 3339)"},
+				map[string]any{"name": "to", "type": "text", "title": "To (RFC 3339)"},
+				map[string]any{"name": "page_size", "type": "number", "value": page.PageSize},
+			},
+		}},
+		"links": sirenLinks(
+			"self", page.URL("siren", page.Page),
+			"first", page.URL("siren", 1),
+			"last", page.URL("siren", page.LastPage()),
+			"prev", page.PrevURL("siren"),
+			"next", page.NextURL("siren"),
+			"up", serverURL(r)+"/api/sensors/"+page.Mac,
+		),
+	})
+}
+
+// exportCollectionJSON writes a page of the history as Collection+JSON
+// document. It has no template, the history is read only.
+func exportCollectionJSON(w http.ResponseWriter, r *http.Request) {
+	page, ok := loadHistoryPage(w, r)
+	if !ok {
+		return
+	}
+
+	items := []any{}
+	for _, reading := range page.Readings {
+		items = append(items, map[string]any{
+			"href": readingURL(r, page.Mac, reading),
+			"data": []any{
+				map[string]any{"name": "timestamp", "value": reading.Timestamp.UTC().Format(time.RFC3339)},
+				map[string]any{"name": "temp", "value": reading.Temp},
+				map[string]any{"name": "humidity", "value": reading.Humidity},
+				map[string]any{"name": "battery_mv", "value": reading.BatteryMV},
+				map[string]any{"name": "battery_level", "value": reading.BatteryLevel},
+			},
+		})
+	}
+	links := []any{}
+	for _, link := range [][2]string{
+		{"first", page.URL("collection-json", 1)},
+		{"last", page.URL("collection-json", page.LastPage())},
+		{"prev", page.PrevURL("collection-json")},
+		{"next", page.NextURL("collection-json")},
+		{"sensor", serverURL(r) + "/api/sensors/" + page.Mac},
+	} {
+		if link[1] != "" {
+			links = append(links, map[string]string{"rel": link[0], "href": link[1]})
+		}
+	}
+	writeJSON(w, "application/vnd.collection+json", map[string]any{
+		"collection": map[string]any{
+			"version": "1.0",
+			"href":    historyURL(r, page.Mac, "collection-json"),
+			"links":   links,
+			"items":   items,
+			"queries": []any{map[string]any{
+				"rel":    "search",
+				"href":   historyURL(r, page.Mac, "collection-json"),
+				"prompt": "Filter the readings by date",
+				"data": []any{
+					map[string]string{"name": "from", "value": "", "prompt": "From (RFC 3339)"},
+					map[string]string{"name": "to", "value": "", "prompt": "To (RFC 3339)"},
+					map[string]any{"name": "page_size", "value": page.PageSize},
+				},
+			}},
+		},
+	})
+}
+
+// schemaPropertyValues describes the measurements of a reading as
+// schema.org PropertyValue nodes with UN/CEFACT unit codes.
+func schemaPropertyValues(reading SensorReading) []any {
+	property := func(name string, value any, unitCode string, unitText string) map[string]any {
+		return map[string]any{
+			"@type":           "schema:PropertyValue",
+			"schema:name":     name,
+			"schema:value":    value,
+			"schema:unitCode": unitCode,
+			"schema:unitText": unitText,
+		}
+	}
+	return []any{
+		property("temperature", reading.Temp, "CEL", "°C"),
+		property("humidity", reading.Humidity, "P1", "%"),
+		property("battery_mv", reading.BatteryMV, "2Z", "mV"),
+		property("battery_level", reading.BatteryLevel, "P1", "%"),
+	}
+}
+
+// exportHydra writes a page of the history as Hydra collection in JSON-LD,
+// the readings are schema.org observations of the sensor.
+func exportHydra(w http.ResponseWriter, r *http.Request) {
+	page, ok := loadHistoryPage(w, r)
+	if !ok {
+		return
+	}
+
+	sensor := serverURL(r) + "/api/sensors/" + page.Mac
+	members := []any{}
+	for _, reading := range page.Readings {
+		members = append(members, map[string]any{
+			"@id":   readingURL(r, page.Mac, reading),
+			"@type": "schema:Observation",
+			"schema:observationDate": map[string]string{
+				"@value": reading.Timestamp.UTC().Format(time.RFC3339),
+				"@type":  "schema:DateTime",
+			},
+			"schema:observationAbout": map[string]string{"@id": sensor},
+			"schema:variableMeasured": schemaPropertyValues(reading),
+		})
+	}
+	view := map[string]any{
+		"@id":         page.URL("hydra", page.Page),
+		"@type":       "hydra:PartialCollectionView",
+		"hydra:first": map[string]string{"@id": page.URL("hydra", 1)},
+		"hydra:last":  map[string]string{"@id": page.URL("hydra", page.LastPage())},
+	}
+	if prev := page.PrevURL("hydra"); prev != "" {
+		view["hydra:previous"] = map[string]string{"@id": prev}
+	}
+	if next := page.NextURL("hydra"); next != "" {
+		view["hydra:next"] = map[string]string{"@id": next}
+	}
+	mappings := []any{}
+	for _, mapping := range [][2]string{
+		{"from", "schema:startDate"},
+		{"to", "schema:endDate"},
+		{"page_size", "hydra:limit"},
+		{"page", "hydra:pageIndex"},
+	} {
+		mappings = append(mappings, map[string]any{
+			"@type":          "hydra:IriTemplateMapping",
+			"hydra:variable": mapping[0],
+			"hydra:property": map[string]string{"@id": mapping[1]},
+			"hydra:required": false,
+		})
+	}
+
+	writeJSON(w, "application/ld+json", map[string]any{
+		"@context": []any{
+			"http://www.w3.org/ns/hydra/context.jsonld",
+			map[string]string{"schema": "https://schema.org/"},
+		},
+		"@id":              historyURL(r, page.Mac, "hydra"),
+		"@type":            "hydra:Collection",
+		"hydra:title":      feedTitle(page.SensorHistory) + " readings",
+		"hydra:totalItems": page.Total,
+		"hydra:member":     members,
+		"hydra:view":       view,
+		"hydra:search": map[string]any{
+			"@type":                        "hydra:IriTemplate",
+			"hydra:template":               historyURL(r, page.Mac, "hydra") + "{?from,to,page_size,page}",
+			"hydra:variableRepresentation": map[string]string{"@id": "hydra:BasicRepresentation"},
+			"hydra:mapping":                mappings,
+		},
+	})
+}
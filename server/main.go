@@ -3,6 +3,7 @@ package main
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"html/template"
 	"io"
@@ -33,16 +34,65 @@ type SensorData struct {
 
 type Config struct {
 	Loc string `json:"loc"`
-	Db  *sql.DB
+	// optional name of the group of sensors, e.g. the floor
+	Group string `json:"group"`
+	// optional position of the sensor in degrees (WGS 84), enables the
+	// geo exports, and altitude in meters
+	Lat *float64 `json:"lat"`
+	Lon *float64 `json:"lon"`
+	Alt float64  `json:"alt"`
+
+	// push targets of the history exports
+	CouchdbURL       string `json:"couchdb_url"`
+	CouchdbUser      string `json:"couchdb_user"`
+	CouchdbPassword  string `json:"couchdb_password"`
+	RedisURL         string `json:"redis_url"`
+	M3CoordinatorURL string `json:"m3_coordinator_url"`
+	OpentsdbAddr     string `json:"opentsdb_addr"`
+	RemoteWriteURL   string `json:"remote_write_url"`
+	CortexTenantID   string `json:"cortex_tenant_id"`
+	VictoriaLogsURL  string `json:"victoria_logs_url"`
+	DynamodbRegion   string `json:"dynamodb_region"`
+	NatsURL          string `json:"nats_url"`
+	RabbitmqURL      string `json:"rabbitmq_url"`
+	PulsarURL        string `json:"pulsar_url"`
+	ZeromqEndpoint   string `json:"zeromq_endpoint"`
+
+	// expected refresh interval of the feeds in minutes
+	FeedTTL int `json:"feed_ttl"`
+
+	Db *sql.DB
 }
 
 type ConfigMap map[string]Config
 
 var configMap ConfigMap
 
+// ServerConfig holds the settings of the server itself, read from the
+// optional server_config.json next to config.json.
+type ServerConfig struct {
+	// listen address of the gRPC SensorService, e.g. ":9090"
+	GrpcAddr string `json:"grpc_addr"`
+	// listen address of the Arrow Flight server, e.g. ":8815"
+	ArrowFlightAddr string `json:"arrow_flight_addr"`
+	// contact point of the dataset descriptions, e.g. "Jane Doe" and
+	// "jane@example.com"
+	ContactName  string `json:"contact_name"`
+	ContactEmail string `json:"contact_email"`
+	// license of the datasets as Open Definition or SPDX identifier,
+	// defaults to ODC-PDDL-1.0
+	License string `json:"license"`
+}
+
+var serverConfig ServerConfig
+
 func renderHomePage(w http.ResponseWriter, r *http.Request) {
 	tmpl := template.Must(template.ParseFiles("templates/index.html"))
-	if err := tmpl.Execute(w, nil); err != nil {
+	data := struct {
+		// schema.org Dataset markup of the sensors for search engines
+		Datasets []map[string]any
+	}{schemaOrgDatasets(r)}
+	if err := tmpl.Execute(w, data); err != nil {
 		http.Error(w, "Error rendering template", http.StatusInternalServerError)
 	}
 }
@@ -192,11 +242,26 @@ func loadConfig() ConfigMap {
 	return config
 }
 
+func loadServerConfig() ServerConfig {
+	var config ServerConfig
+	data, err := os.ReadFile("../server_config.json")
+	if errors.Is(err, os.ErrNotExist) {
+		return config
+	} else if err != nil {
+		log.Fatalf("Failed to read server config file: %v", err)
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		log.Fatalf("Failed to parse server config: %v", err)
+	}
+	return config
+}
+
 func main() {
 	// expect to run from mijia-root directory
 	// var err error
 
 	configMap = loadConfig()
+	serverConfig = loadServerConfig()
 
 	for mac, individualConfig := range configMap {
 		// Connect to SQLite database
@@ -209,15 +274,149 @@ func main() {
 		individualConfig.Db = db
 		configMap[mac] = individualConfig
 	}
-	fmt.Printf("%v", configMap)
+	// only the sensors, the configs hold passwords and URLs with credentials
+	for mac, individualConfig := range configMap {
+		log.Printf("Sensor %s: %s", mac, individualConfig.Loc)
+	}
 
 	// Handle routes
 	http.HandleFunc("/", renderHomePage)
 	http.HandleFunc("/load_data", loadSensorData) // HTMX endpoint
 
+	// History API and exports
+	http.HandleFunc("GET /api/sensors/{mac}", sensorResource)
+	http.HandleFunc("GET /api/sensors/{mac}/history", sensorHistory)
+	http.HandleFunc("GET /api/sensors/{mac}/history/export.csv", exportCSV)
+	http.HandleFunc("GET /api/sensors/{mac}/history/export.jsonl", exportJSONL)
+	http.HandleFunc("GET /api/sensors/{mac}/history/export.mode", exportMode)
+	http.HandleFunc("GET /api/sensors/{mac}/history/export.dbt", exportDbt)
+	http.HandleFunc("GET /api/sensors/{mac}/history/export.airbyte", exportAirbyte)
+	http.HandleFunc("GET /api/sensors/{mac}/history/export.fivetran", exportFivetran)
+	http.HandleFunc("GET /api/sensors/{mac}/history/export.stitch", exportStitch)
+	http.HandleFunc("GET /api/sensors/{mac}/history/export.nifi", exportNifi)
+	http.HandleFunc("GET /api/sensors/{mac}/history/export.kafka-schema-registry", exportKafkaSchemaRegistry)
+	http.HandleFunc("GET /api/sensors/{mac}/history/export.aws-glue", exportAwsGlue)
+	http.HandleFunc("GET /api/sensors/{mac}/history/export.databricks", exportDatabricks)
+	http.HandleFunc("GET /api/sensors/{mac}/history/export.snowflake", exportSnowflake)
+	http.HandleFunc("GET /api/sensors/{mac}/history/export.bigquery", exportBigquery)
+	http.HandleFunc("GET /api/sensors/{mac}/history/export.redshift", exportRedshift)
+	http.HandleFunc("GET /api/sensors/{mac}/history/export.clickhouse", exportClickhouse)
+	http.HandleFunc("GET /api/sensors/{mac}/history/export.duckdb", exportDuckdb)
+	http.HandleFunc("GET /api/sensors/{mac}/history/export.sqlite-import", exportSqliteImport)
+	http.HandleFunc("GET /api/sensors/{mac}/history/export.mysql", exportMysql)
+	http.HandleFunc("GET /api/sensors/{mac}/history/export.postgresql", exportPostgresql)
+	http.HandleFunc("GET /api/sensors/{mac}/history/export.mongodb", exportMongodb)
+	http.HandleFunc("GET /api/sensors/{mac}/history/export.couchdb", exportCouchdb)
+	http.HandleFunc("GET /api/sensors/{mac}/history/export.redis", exportRedis)
+	http.HandleFunc("GET /api/sensors/{mac}/history/export.cassandra", exportCassandra)
+	http.HandleFunc("GET /api/sensors/{mac}/history/export.scylla", exportScylla)
+	http.HandleFunc("GET /api/sensors/{mac}/history/export.timescaledb", exportTimescaledb)
+	http.HandleFunc("GET /api/sensors/{mac}/history/export.questdb", exportQuestdb)
+	http.HandleFunc("GET /api/sensors/{mac}/history/export.tdengine", exportTdengine)
+	http.HandleFunc("GET /api/sensors/{mac}/history/export.iotdb", exportIotdb)
+	http.HandleFunc("GET /api/sensors/{mac}/history/export.influxdb3", exportInfluxdb3)
+	http.HandleFunc("GET /api/sensors/{mac}/history/export.m3db", exportM3db)
+	http.HandleFunc("GET /api/sensors/{mac}/history/export.opentsdb-telnet", exportOpentsdbTelnet)
+	http.HandleFunc("GET /api/sensors/{mac}/history/export.kdb", exportKdb)
+	http.HandleFunc("GET /api/sensors/{mac}/history/export.prometheus-remote-write", exportPrometheusRemoteWrite)
+	http.HandleFunc("GET /api/sensors/{mac}/history/export.thanos", exportThanos)
+	http.HandleFunc("GET /api/sensors/{mac}/history/export.mimir", exportMimir)
+	http.HandleFunc("GET /api/sensors/{mac}/history/export.cortex", exportCortex)
+	http.HandleFunc("GET /api/sensors/{mac}/history/export.victoria-logs", exportVictoriaLogs)
+	http.HandleFunc("GET /api/sensors/{mac}/history/export.loki-logql", exportLokiLogql)
+	http.HandleFunc("GET /api/sensors/{mac}/history/export.datastream", exportDatastream)
+	http.HandleFunc("GET /api/sensors/{mac}/history/export.debezium", exportDebezium)
+	http.HandleFunc("GET /api/sensors/{mac}/history/export.flink-cdc", exportFlinkCdc)
+	http.HandleFunc("GET /api/sensors/{mac}/history/export.materialize", exportMaterialize)
+	http.HandleFunc("GET /api/sensors/{mac}/history/export.risingwave", exportRisingwave)
+	http.HandleFunc("GET /api/sensors/{mac}/history/export.pinot", exportPinot)
+	http.HandleFunc("GET /api/sensors/{mac}/history/export.druid", exportDruid)
+	http.HandleFunc("GET /api/sensors/{mac}/history/export.rockset", exportRockset)
+	http.HandleFunc("GET /api/sensors/{mac}/history/export.cratedb", exportCratedb)
+	http.HandleFunc("GET /api/sensors/{mac}/history/export.singlestore", exportSinglestore)
+	http.HandleFunc("GET /api/sensors/{mac}/history/export.exasol", exportExasol)
+	http.HandleFunc("GET /api/sensors/{mac}/history/export.vertica", exportVertica)
+	http.HandleFunc("GET /api/sensors/{mac}/history/export.teradata", exportTeradata)
+	http.HandleFunc("GET /api/sensors/{mac}/history/export.oracle", exportOracle)
+	http.HandleFunc("GET /api/sensors/{mac}/history/export.db2", exportDb2)
+	http.HandleFunc("GET /api/sensors/{mac}/history/export.sybase", exportSybase)
+	http.HandleFunc("GET /api/sensors/{mac}/history/export.monetdb", exportMonetdb)
+	http.HandleFunc("GET /api/sensors/{mac}/history/export.dolt", exportDolt)
+	http.HandleFunc("GET /api/sensors/{mac}/history/export.neon", exportNeon)
+	http.HandleFunc("GET /api/sensors/{mac}/history/export.planetscale", exportPlanetscale)
+	http.HandleFunc("GET /api/sensors/{mac}/history/export.cockroachdb", exportCockroachdb)
+	http.HandleFunc("GET /api/sensors/{mac}/history/export.tidb", exportTidb)
+	http.HandleFunc("GET /api/sensors/{mac}/history/export.yugabyte", exportYugabyte)
+	http.HandleFunc("GET /api/sensors/{mac}/history/export.spanner", exportSpanner)
+	http.HandleFunc("GET /api/sensors/{mac}/history/export.alloydb", exportAlloydb)
+	http.HandleFunc("GET /api/sensors/{mac}/history/export.aurora", exportAurora)
+	http.HandleFunc("GET /api/sensors/{mac}/history/export.dynamodb", exportDynamodb)
+	http.HandleFunc("GET /api/sensors/{mac}/history/export.firestore", exportFirestore)
+	http.HandleFunc("GET /api/sensors/{mac}/history/export.cosmos", exportCosmos)
+	http.HandleFunc("GET /api/sensors/{mac}/history/export.fauna", exportFauna)
+	http.HandleFunc("GET /api/sensors/{mac}/history/export.supabase", exportSupabase)
+	http.HandleFunc("GET /api/sensors/{mac}/history/export.hasura", exportHasura)
+	http.HandleFunc("GET /api/sensors/{mac}/history/export.graphql", exportGraphql)
+	http.HandleFunc("GET /api/sensors/{mac}/history/export.grpc-stream", exportGrpcStream)
+	http.HandleFunc("GET /api/sensor_service.proto", grpcProtoHandler)
+	http.HandleFunc("GET /api/sensors/{mac}/history/export.arrow-flight", exportArrowFlight)
+	http.HandleFunc("GET /api/sensors/{mac}/history/export.websocket-stream", exportWebsocketStream)
+	http.HandleFunc("GET /api/sensors/{mac}/history/export.sse-stream", exportSseStream)
+	http.HandleFunc("GET /api/sensors/{mac}/history/export.nats", exportNats)
+	http.HandleFunc("GET /api/sensors/{mac}/history/export.rabbitmq", exportRabbitmq)
+	http.HandleFunc("GET /api/sensors/{mac}/history/export.pulsar", exportPulsar)
+	http.HandleFunc("GET /api/sensors/{mac}/history/export.zeromq", exportZeromq)
+	http.HandleFunc("GET /api/sensors/{mac}/history/export.websub", exportWebsub)
+	http.HandleFunc("GET /api/sensors/{mac}/history/export.atom", exportAtom)
+	http.HandleFunc("GET /api/sensors/{mac}/history/export.rss", exportRss)
+	http.HandleFunc("GET /api/sensors/{mac}/history/export.jsonapi", exportJsonapi)
+	http.HandleFunc("GET /api/sensors/{mac}/history/export.hal", exportHal)
+	http.HandleFunc("GET /api/sensors/{mac}/history/export.siren", exportSiren)
+	http.HandleFunc("GET /api/sensors/{mac}/history/export.collection-json", exportCollectionJSON)
+	http.HandleFunc("GET /api/sensors/{mac}/history/export.hydra", exportHydra)
+	http.HandleFunc("GET /api/sensors/{mac}/history/export.odata", exportOdata)
+	http.HandleFunc("GET /api/sensors/{mac}/odata/{$}", odataServiceDocument)
+	http.HandleFunc("GET /api/sensors/{mac}/odata/$metadata", odataMetadataHandler)
+	http.HandleFunc("GET /api/sensors/{mac}/odata/Readings", exportOdata)
+	http.HandleFunc("GET /api/sensors/{mac}/history/export.sparql", exportSparql)
+	http.HandleFunc("GET /sparql", sparqlHandler)
+	http.HandleFunc("POST /sparql", sparqlHandler)
+	http.HandleFunc("GET /api/sensors/{mac}/history/export.jsonld", exportJsonld)
+	http.HandleFunc("GET /api/context.json", jsonldContextHandler)
+	http.HandleFunc("GET /api/sensors/{mac}/history/export.trig", exportTrig)
+	http.HandleFunc("GET /api/sensors/{mac}/history/export.n-quads", exportNquads)
+	http.HandleFunc("GET /api/sensors/{mac}/history/export.hdt", exportHdt)
+	http.HandleFunc("GET /api/sensors/{mac}/history/export.owlrdf", exportOwlrdf)
+	http.HandleFunc("GET /api/sensors/{mac}/history/export.shacl", exportShacl)
+	http.HandleFunc("GET /api/sensors/{mac}/history/export.framing", exportFraming)
+	http.HandleFunc("GET /api/sensors/{mac}/history/export.dcat", exportDcat)
+	http.HandleFunc("GET /api/sensors/{mac}/history/export.schema-org", exportSchemaOrg)
+	http.HandleFunc("GET /api/sensors/{mac}/history/export.frictionless", exportFrictionless)
+	http.HandleFunc("GET /api/sensors/{mac}/history/export.croissant", exportCroissant)
+	http.HandleFunc("GET /api/sensors/{mac}/history/export.stac", exportStac)
+	http.HandleFunc("GET /api/sensors/{mac}/history/export.geojson", exportGeojson)
+	http.HandleFunc("GET /api/sensors/{mac}/history/export.kml", exportKml)
+	http.HandleFunc("GET /api/sensors/{mac}/history/export.gpx", exportGpx)
+	http.HandleFunc("GET /api/sensors/{mac}/history/export.shapefile", exportShapefile)
+	http.HandleFunc("GET /api/sensors/{mac}/history/export.geobuf", exportGeobuf)
+	http.HandleFunc("GET /api/sensors/{mac}/history/export.flatgeobuf", exportFlatgeobuf)
+	http.HandleFunc("GET /api/sensors/{mac}/history/export.pmtiles", exportPmtiles)
+	http.HandleFunc("GET /api/sensors/{mac}/history/export.czml", exportCzml)
+	http.HandleFunc("POST /hub", websubHandler)
+	http.HandleFunc("GET /graphql/schema", graphqlSchemaHandler)
+	http.HandleFunc("POST /graphql", graphqlHandler)
+
 	// Serve static files
 	http.Handle("/static/", http.StripPrefix("/static/", http.FileServer(http.Dir("static"))))
 
+	go hub.watch()
+	if serverConfig.GrpcAddr != "" {
+		go serveGrpc(serverConfig.GrpcAddr)
+	}
+	if serverConfig.ArrowFlightAddr != "" {
+		go serveArrowFlight(serverConfig.ArrowFlightAddr)
+	}
+
 	// Start the server
 	fmt.Println("Server is running on http://localhost:8080")
 	log.Fatal(http.ListenAndServe(":8080", nil))
@@ -0,0 +1,536 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// odataPageSize is the maximum number of readings per response, clients
+// follow @odata.nextLink for the rest.
+const odataPageSize = 1000
+
+// odataMetadata is the CSDL of the OData service of a sensor. The readings
+// are the single entity set, keyed by their timestamp.
+const odataMetadata = `<?xml version="1.0" encoding="utf-8"?>
+<edmx:Edmx Version="4.0" xmlns:edmx="http://docs.oasis-open.org/odata/ns/edmx">
+  <edmx:DataServices>
+    <Schema Namespace="mijia" xmlns="http://docs.oasis-open.org/odata/ns/edm">
+      <EntityType Name="Reading">
+        <Key>
+          <PropertyRef Name="timestamp"/>
+        </Key>
+        <Property Name="timestamp" Type="Edm.DateTimeOffset" Nullable="false"/>
+        <Property Name="temp" Type="Edm.Double" Nullable="false"/>
+        <Property Name="humidity" Type="Edm.Double" Nullable="false"/>
+        <Property Name="battery_mv" Type="Edm.Int16" Nullable="false"/>
+        <Property Name="battery_level" Type="Edm.SByte" Nullable="false"/>
+      </EntityType>
+      <EntityContainer Name="Container">
+        <EntitySet Name="Readings" EntityType="mijia.Reading"/>
+      </EntityContainer>
+    </Schema>
+  </edmx:DataServices>
+</edmx:Edmx>
+`
+
+// odataProperties are the properties of a Reading with the type
+// annotation required in full metadata, "" if the JSON type suffices.
+var odataProperties = [][2]string{
+	{"timestamp", "#DateTimeOffset"},
+	{"temp", ""},
+	{"humidity", ""},
+	{"battery_mv", "#Int16"},
+	{"battery_level", "#SByte"},
+}
+
+// odataValue returns a property of a reading as value of the filter
+// expressions: timestamps as time.Time, numbers as float64.
+func odataValue(reading SensorReading, property string) any {
+	switch property {
+	case "timestamp":
+		return reading.Timestamp.UTC()
+	case "temp":
+		return reading.Temp
+	case "humidity":
+		return reading.Humidity
+	case "battery_mv":
+		return float64(reading.BatteryMV)
+	case "battery_level":
+		return float64(reading.BatteryLevel)
+	}
+	return nil
+}
+
+func isOdataProperty(name string) bool {
+	return slices.ContainsFunc(odataProperties, func(p [2]string) bool { return p[0] == name })
+}
+
+// odataServiceRoot is the URL of the OData service of the sensor.
+func odataServiceRoot(r *http.Request, mac string) string {
+	return fmt.Sprintf("%s/api/sensors/%s/odata/", serverURL(r), mac)
+}
+
+// odataExpr is a compiled $filter expression.
+type odataExpr func(reading SensorReading) any
+
+// odataParser parses the supported subset of the $filter syntax: the
+// comparison operators, and, or, not and parentheses on the properties
+// and literals (numbers, DateTimeOffset and Date, strings, true, false,
+// null). Functions and arithmetic are not supported.
+type odataParser struct {
+	tokens []string
+	pos    int
+}
+
+func tokenizeOdataFilter(filter string) ([]string, error) {
+	var tokens []string
+	for i := 0; i < len(filter); {
+		switch c := filter[i]; {
+		case c == ' ' || c == '\t':
+			i++
+		case c == '(' || c == ')':
+			tokens = append(tokens, string(c))
+			i++
+		case c == '\'':
+			// string literal, quotes are escaped by doubling
+			j := i + 1
+			for ; j < len(filter); j++ {
+				if filter[j] == '\'' {
+					if j+1 < len(filter) && filter[j+1] == '\'' {
+						j++
+						continue
+					}
+					break
+				}
+			}
+			if j >= len(filter) {
+				return nil, fmt.Errorf("unterminated string literal")
+			}
+			tokens = append(tokens, filter[i:j+1])
+			i = j + 1
+		default:
+			j := i
+			for j < len(filter) && !strings.ContainsRune(" \t()'", rune(filter[j])) {
+				j++
+			}
+			tokens = append(tokens, filter[i:j])
+			i = j
+		}
+	}
+	return tokens, nil
+}
+
+func parseOdataFilter(filter string) (odataExpr, error) {
+	tokens, err := tokenizeOdataFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+	p := &odataParser{tokens: tokens}
+	expr, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %q", p.tokens[p.pos])
+	}
+	return expr, nil
+}
+
+func (p *odataParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *odataParser) parseOr() (odataExpr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "or" {
+		p.pos++
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(reading SensorReading) any {
+			return l(reading) == true || right(reading) == true
+		}
+	}
+	return left, nil
+}
+
+func (p *odataParser) parseAnd() (odataExpr, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "and" {
+		p.pos++
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(reading SensorReading) any {
+			return l(reading) == true && right(reading) == true
+		}
+	}
+	return left, nil
+}
+
+func (p *odataParser) parseNot() (odataExpr, error) {
+	if p.peek() == "not" {
+		p.pos++
+		operand, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return func(reading SensorReading) any {
+			return operand(reading) != true
+		}, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *odataParser) parseComparison() (odataExpr, error) {
+	left, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	op := p.peek()
+	var matches func(c int) bool
+	switch op {
+	case "eq":
+		matches = func(c int) bool { return c == 0 }
+	case "ne":
+		matches = func(c int) bool { return c != 0 }
+	case "gt":
+		matches = func(c int) bool { return c > 0 }
+	case "ge":
+		matches = func(c int) bool { return c >= 0 }
+	case "lt":
+		matches = func(c int) bool { return c < 0 }
+	case "le":
+		matches = func(c int) bool { return c <= 0 }
+	default:
+		return left, nil
+	}
+	p.pos++
+	right, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	return func(reading SensorReading) any {
+		c, ok := compareOdataValues(left(reading), right(reading))
+		if !ok {
+			// values of different types are never equal
+			return op == "ne"
+		}
+		return matches(c)
+	}, nil
+}
+
+func (p *odataParser) parsePrimary() (odataExpr, error) {
+	token := p.peek()
+	if token == "" {
+		return nil, fmt.Errorf("unexpected end of $filter")
+	}
+	p.pos++
+	if token == "(" {
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ")" {
+			return nil, fmt.Errorf("missing )")
+		}
+		p.pos++
+		return expr, nil
+	}
+	if isOdataProperty(token) {
+		return func(reading SensorReading) any {
+			return odataValue(reading, token)
+		}, nil
+	}
+	value, err := parseOdataLiteral(token)
+	if err != nil {
+		return nil, err
+	}
+	return func(SensorReading) any { return value }, nil
+}
+
+func parseOdataLiteral(token string) (any, error) {
+	switch token {
+	case "null":
+		return nil, nil
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	}
+	if strings.HasPrefix(token, "'") {
+		return strings.ReplaceAll(token[1:len(token)-1], "''", "'"), nil
+	}
+	if t, err := time.Parse(time.RFC3339, token); err == nil {
+		return t.UTC(), nil
+	}
+	if t, err := time.Parse(time.DateOnly, token); err == nil {
+		return t, nil
+	}
+	// numbers may carry the type suffix of OData v2 clients, e.g. 25.5m
+	number := strings.TrimRight(token, "dDfFmMlL")
+	if v, err := strconv.ParseFloat(number, 64); err == nil && number != "" {
+		return v, nil
+	}
+	return nil, fmt.Errorf("unknown property or literal %q", token)
+}
+
+// compareOdataValues compares two values of the same type, ok is false for
+// values of different types.
+func compareOdataValues(a, b any) (int, bool) {
+	switch a := a.(type) {
+	case float64:
+		if b, ok := b.(float64); ok {
+			return cmp.Compare(a, b), true
+		}
+	case time.Time:
+		if b, ok := b.(time.Time); ok {
+			return a.Compare(b), true
+		}
+	case string:
+		if b, ok := b.(string); ok {
+			return strings.Compare(a, b), true
+		}
+	case bool:
+		if b, ok := b.(bool); ok && a == b {
+			return 0, true
+		}
+	case nil:
+		if b == nil {
+			return 0, true
+		}
+	}
+	return 0, false
+}
+
+// odataOrder is a compiled $orderby, comparing two readings.
+type odataOrder func(a, b SensorReading) int
+
+func parseOdataOrderBy(orderBy string) (odataOrder, error) {
+	type key struct {
+		property string
+		desc     bool
+	}
+	var keys []key
+	for _, item := range strings.Split(orderBy, ",") {
+		fields := strings.Fields(item)
+		if len(fields) == 0 || len(fields) > 2 || !isOdataProperty(fields[0]) {
+			return nil, fmt.Errorf("invalid $orderby item %q", strings.TrimSpace(item))
+		}
+		k := key{property: fields[0]}
+		if len(fields) == 2 {
+			switch fields[1] {
+			case "asc":
+			case "desc":
+				k.desc = true
+			default:
+				return nil, fmt.Errorf("invalid $orderby direction %q", fields[1])
+			}
+		}
+		keys = append(keys, k)
+	}
+	return func(a, b SensorReading) int {
+		for _, k := range keys {
+			c, _ := compareOdataValues(odataValue(a, k.property), odataValue(b, k.property))
+			if k.desc {
+				c = -c
+			}
+			if c != 0 {
+				return c
+			}
+		}
+		return 0
+	}, nil
+}
+
+func parseOdataSelect(sel string) ([]string, error) {
+	var properties []string
+	if sel == "" || sel == "*" {
+		for _, p := range odataProperties {
+			properties = append(properties, p[0])
+		}
+		return properties, nil
+	}
+	for _, property := range strings.Split(sel, ",") {
+		property = strings.TrimSpace(property)
+		if !isOdataProperty(property) {
+			return nil, fmt.Errorf("unknown $select property %q", property)
+		}
+		properties = append(properties, property)
+	}
+	return properties, nil
+}
+
+// odataError writes an error in the OData JSON format.
+func odataError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("OData-Version", "4.0")
+	w.WriteHeader(status)
+	writeJSON(w, "application/json", map[string]any{
+		"error": map[string]any{"code": http.StatusText(status), "message": message},
+	})
+}
+
+// exportOdata serves the history as the Readings entity set in the OData
+// v4 JSON format with full metadata, supporting the system query options
+// $filter, $orderby, $top, $skip and $select. Slices of more than
+// odataPageSize readings are paged with @odata.nextLink.
+func exportOdata(w http.ResponseWriter, r *http.Request) {
+	history, ok := loadSensor(w, r)
+	if !ok {
+		return
+	}
+	query := r.URL.Query()
+
+	filter := odataExpr(func(SensorReading) any { return true })
+	var err error
+	if value := query.Get("$filter"); value != "" {
+		if filter, err = parseOdataFilter(value); err != nil {
+			odataError(w, http.StatusBadRequest, "invalid $filter: "+err.Error())
+			return
+		}
+	}
+	var order odataOrder
+	if value := query.Get("$orderby"); value != "" {
+		if order, err = parseOdataOrderBy(value); err != nil {
+			odataError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	properties, err := parseOdataSelect(query.Get("$select"))
+	if err != nil {
+		odataError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	top, skip := -1, 0
+	if value := query.Get("$top"); value != "" {
+		if top, err = strconv.Atoi(value); err != nil || top < 0 {
+			odataError(w, http.StatusBadRequest, "invalid $top")
+			return
+		}
+	}
+	if value := query.Get("$skip"); value != "" {
+		if skip, err = strconv.Atoi(value); err != nil || skip < 0 {
+			odataError(w, http.StatusBadRequest, "invalid $skip")
+			return
+		}
+	}
+
+	all, err := queryReadings(configMap[history.Mac].Db, time.Time{}, time.Time{}, 0, 1)
+	if err != nil {
+		odataError(w, http.StatusInternalServerError, "Data could not be loaded")
+		return
+	}
+	var readings []SensorReading
+	for _, reading := range all {
+		if filter(reading) == true {
+			readings = append(readings, reading)
+		}
+	}
+	if order != nil {
+		slices.SortStableFunc(readings, order)
+	}
+	count := len(readings)
+	readings = readings[min(skip, len(readings)):]
+	if top >= 0 && top < len(readings) {
+		readings = readings[:top]
+	}
+
+	root := odataServiceRoot(r, history.Mac)
+	context := root + "$metadata#Readings"
+	if query.Get("$select") != "" {
+		context = root + "$metadata#Readings(" + strings.Join(properties, ",") + ")"
+	}
+	response := orderedObject{}
+	response.set("@odata.context", context)
+	response.set("@odata.count", count)
+
+	var nextLink string
+	if len(readings) > odataPageSize {
+		readings = readings[:odataPageSize]
+		next := r.URL.Query()
+		next.Set("$skip", strconv.Itoa(skip+odataPageSize))
+		if top >= 0 {
+			next.Set("$top", strconv.Itoa(top-odataPageSize))
+		}
+		nextLink = serverURL(r) + r.URL.Path + "?" + next.Encode()
+	}
+
+	value := []any{}
+	for _, reading := range readings {
+		var entity orderedObject
+		entity.set("@odata.type", "#mijia.Reading")
+		entity.set("@odata.id", readingURL(r, history.Mac, reading))
+		timestamp := reading.Timestamp.UTC().Format(time.RFC3339)
+		for _, property := range odataProperties {
+			if !slices.Contains(properties, property[0]) {
+				continue
+			}
+			if property[1] != "" {
+				entity.set(property[0]+"@odata.type", property[1])
+			}
+			switch property[0] {
+			case "timestamp":
+				entity.set("timestamp", timestamp)
+			case "temp":
+				entity.set("temp", reading.Temp)
+			case "humidity":
+				entity.set("humidity", reading.Humidity)
+			case "battery_mv":
+				entity.set("battery_mv", reading.BatteryMV)
+			case "battery_level":
+				entity.set("battery_level", reading.BatteryLevel)
+			}
+		}
+		value = append(value, entity)
+	}
+	response.set("value", value)
+	if nextLink != "" {
+		response.set("@odata.nextLink", nextLink)
+	}
+
+	w.Header().Set("OData-Version", "4.0")
+	writeJSON(w, "application/json;odata.metadata=full;odata.streaming=true;IEEE754Compatible=false", response)
+}
+
+// odataServiceDocument lists the entity sets of the OData service of a
+// sensor, the entry point of OData clients like Excel and Power BI.
+func odataServiceDocument(w http.ResponseWriter, r *http.Request) {
+	history, ok := loadSensor(w, r)
+	if !ok {
+		return
+	}
+	root := odataServiceRoot(r, history.Mac)
+	var document orderedObject
+	document.set("@odata.context", root+"$metadata")
+	document.set("value", []any{map[string]string{"name": "Readings", "kind": "EntitySet", "url": "Readings"}})
+	w.Header().Set("OData-Version", "4.0")
+	writeJSON(w, "application/json;odata.metadata=minimal", document)
+}
+
+// odataMetadataHandler serves the CSDL of the OData service.
+func odataMetadataHandler(w http.ResponseWriter, r *http.Request) {
+	if _, ok := loadSensor(w, r); !ok {
+		return
+	}
+	w.Header().Set("OData-Version", "4.0")
+	w.Header().Set("Content-Type", "application/xml")
+	w.Write([]byte(odataMetadata))
+}
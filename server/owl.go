@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/xml"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	owlNamespace  = "http://www.w3.org/2002/07/owl#"
+	rdfsNamespace = "http://www.w3.org/2000/01/rdf-schema#"
+)
+
+// The element names carry their prefixes, encoding/xml would declare the
+// namespace again on every element otherwise.
+
+type owlResource struct {
+	Resource string `xml:"rdf:resource,attr"`
+}
+
+type owlLiteral struct {
+	Datatype string `xml:"rdf:datatype,attr"`
+	Value    string `xml:",chardata"`
+}
+
+type owlClass struct {
+	About   string `xml:"rdf:about,attr"`
+	Label   string `xml:"rdfs:label"`
+	Comment string `xml:"rdfs:comment"`
+}
+
+type owlProperty struct {
+	About  string      `xml:"rdf:about,attr"`
+	Label  string      `xml:"rdfs:label"`
+	Domain owlResource `xml:"rdfs:domain"`
+	Range  owlResource `xml:"rdfs:range"`
+}
+
+type owlRoom struct {
+	About string      `xml:"rdf:about,attr"`
+	Type  owlResource `xml:"rdf:type"`
+	Label string      `xml:"rdfs:label"`
+}
+
+type owlReading struct {
+	About        string      `xml:"rdf:about,attr"`
+	Type         owlResource `xml:"rdf:type"`
+	Timestamp    owlLiteral  `xml:"mijia:timestamp"`
+	Temperature  owlLiteral  `xml:"mijia:hasTemperature"`
+	Humidity     owlLiteral  `xml:"mijia:hasHumidity"`
+	BatteryLevel owlLiteral  `xml:"mijia:hasBatteryLevel"`
+	LocatedIn    owlResource `xml:"mijia:locatedIn"`
+}
+
+type owlOntology struct {
+	About   string `xml:"rdf:about,attr"`
+	Label   string `xml:"rdfs:label"`
+	Comment string `xml:"rdfs:comment"`
+}
+
+type owlDocument struct {
+	XMLName            xml.Name      `xml:"rdf:RDF"`
+	XmlnsRdf           string        `xml:"xmlns:rdf,attr"`
+	XmlnsRdfs          string        `xml:"xmlns:rdfs,attr"`
+	XmlnsOwl           string        `xml:"xmlns:owl,attr"`
+	XmlnsXsd           string        `xml:"xmlns:xsd,attr"`
+	XmlnsMijia         string        `xml:"xmlns:mijia,attr"`
+	Ontology           owlOntology   `xml:"owl:Ontology"`
+	Classes            []owlClass    `xml:"owl:Class"`
+	ObjectProperties   []owlProperty `xml:"owl:ObjectProperty"`
+	DatatypeProperties []owlProperty `xml:"owl:DatatypeProperty"`
+	Rooms              []owlRoom     `xml:"mijia:Room"`
+	Readings           []owlReading  `xml:"mijia:SensorReading"`
+}
+
+// owlOntologyDocument returns the sensor ontology without individuals.
+func owlOntologyDocument() owlDocument {
+	datatype := func(name string, label string, xsdType string) owlProperty {
+		return owlProperty{
+			About:  rdfSchemaBase + name,
+			Label:  label,
+			Domain: owlResource{rdfSchemaBase + "SensorReading"},
+			Range:  owlResource{xsdNamespace + xsdType},
+		}
+	}
+	return owlDocument{
+		XmlnsRdf:   rdfNamespace,
+		XmlnsRdfs:  rdfsNamespace,
+		XmlnsOwl:   owlNamespace,
+		XmlnsXsd:   xsdNamespace,
+		XmlnsMijia: rdfSchemaBase,
+		Ontology: owlOntology{
+			About:   rdfSchemaBase,
+			Label:   "Mijia sensor ontology",
+			Comment: "Readings of Xiaomi Mijia temperature and humidity sensors and the rooms they are located in.",
+		},
+		Classes: []owlClass{
+			{About: rdfSchemaBase + "SensorReading", Label: "Sensor reading", Comment: "A single reading of a sensor."},
+			{About: rdfSchemaBase + "Room", Label: "Room", Comment: "The room a sensor is located in."},
+		},
+		ObjectProperties: []owlProperty{{
+			About:  rdfSchemaBase + "locatedIn",
+			Label:  "located in",
+			Domain: owlResource{rdfSchemaBase + "SensorReading"},
+			Range:  owlResource{rdfSchemaBase + "Room"},
+		}},
+		DatatypeProperties: []owlProperty{
+			datatype("timestamp", "timestamp", "dateTime"),
+			datatype("hasTemperature", "has temperature (°C)", "double"),
+			datatype("hasHumidity", "has humidity (%)", "double"),
+			datatype("hasBatteryLevel", "has battery level (%)", "integer"),
+		},
+	}
+}
+
+// exportOwlrdf writes the history as OWL ontology in RDF/XML with the room
+// of the sensor and its readings as individuals, to be opened in Protégé or
+// loaded into Jena for reasoning.
+func exportOwlrdf(w http.ResponseWriter, r *http.Request) {
+	history, ok := loadHistory(w, r)
+	if !ok {
+		return
+	}
+
+	individual := owlResource{owlNamespace + "NamedIndividual"}
+	room := sensorIRI(history.Mac) + "/room"
+	doc := owlOntologyDocument()
+	doc.Rooms = []owlRoom{{About: room, Type: individual, Label: feedTitle(history)}}
+	for _, reading := range history.Readings {
+		doc.Readings = append(doc.Readings, owlReading{
+			About:        readingIRI(history.Mac, reading),
+			Type:         individual,
+			Timestamp:    owlLiteral{xsdNamespace + "dateTime", reading.Timestamp.UTC().Format(time.RFC3339)},
+			Temperature:  owlLiteral{xsdNamespace + "double", strconv.FormatFloat(reading.Temp, 'f', -1, 64)},
+			Humidity:     owlLiteral{xsdNamespace + "double", strconv.FormatFloat(reading.Humidity, 'f', -1, 64)},
+			BatteryLevel: owlLiteral{xsdNamespace + "integer", strconv.Itoa(int(reading.BatteryLevel))},
+			LocatedIn:    owlResource{room},
+		})
+	}
+
+	setAttachment(w, "application/rdf+xml", exportFilename(history.Mac, "owl"))
+	writeXML(w, "application/rdf+xml", doc)
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+// protoMessage is a minimal protocol buffers encoder, enough to produce
+// the few messages the exports need without generated code.
+type protoMessage struct {
+	buf []byte
+}
+
+const (
+	protoVarint  = 0
+	protoFixed64 = 1
+	protoBytes   = 2
+	protoFixed32 = 5
+)
+
+func (m *protoMessage) tag(field int, wireType int) {
+	m.buf = binary.AppendUvarint(m.buf, uint64(field)<<3|uint64(wireType))
+}
+
+func (m *protoMessage) Uint64(field int, v uint64) {
+	m.tag(field, protoVarint)
+	m.buf = binary.AppendUvarint(m.buf, v)
+}
+
+func (m *protoMessage) Int64(field int, v int64) {
+	m.Uint64(field, uint64(v))
+}
+
+func (m *protoMessage) Double(field int, v float64) {
+	m.tag(field, protoFixed64)
+	m.buf = binary.LittleEndian.AppendUint64(m.buf, math.Float64bits(v))
+}
+
+func (m *protoMessage) Bytes(field int, b []byte) {
+	m.tag(field, protoBytes)
+	m.buf = binary.AppendUvarint(m.buf, uint64(len(b)))
+	m.buf = append(m.buf, b...)
+}
+
+func (m *protoMessage) String(field int, s string) {
+	m.Bytes(field, []byte(s))
+}
+
+func (m *protoMessage) Message(field int, sub *protoMessage) {
+	m.Bytes(field, sub.buf)
+}
+
+func (m *protoMessage) Encoded() []byte {
+	return m.buf
+}
+
+// protoStrings decodes the length delimited fields of a message, which is
+// all the request messages of the gRPC service contain. Other fields are
+// skipped.
+func protoStrings(b []byte) (map[int]string, error) {
+	fields := map[int]string{}
+	for len(b) > 0 {
+		tag, n := binary.Uvarint(b)
+		if n <= 0 {
+			return nil, errors.New("invalid protobuf tag")
+		}
+		b = b[n:]
+		field := int(tag >> 3)
+		switch tag & 7 {
+		case protoVarint:
+			if _, n = binary.Uvarint(b); n <= 0 {
+				return nil, errors.New("invalid protobuf varint")
+			}
+			b = b[n:]
+		case protoFixed64:
+			if len(b) < 8 {
+				return nil, errors.New("truncated protobuf message")
+			}
+			b = b[8:]
+		case protoBytes:
+			length, n := binary.Uvarint(b)
+			if n <= 0 || uint64(len(b)-n) < length {
+				return nil, errors.New("truncated protobuf message")
+			}
+			fields[field] = string(b[n : n+int(length)])
+			b = b[n+int(length):]
+		case protoFixed32:
+			if len(b) < 4 {
+				return nil, errors.New("truncated protobuf message")
+			}
+			b = b[4:]
+		default:
+			return nil, errors.New("unsupported protobuf wire type")
+		}
+	}
+	return fields, nil
+}
@@ -0,0 +1,497 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/deiu/rdf2go"
+	"github.com/piprate/json-gold/ld"
+)
+
+// The RDF exports describe the sensors and readings with IRIs below
+// rdfSensorBase and the terms of the vocabulary below rdfSchemaBase.
+const (
+	rdfSensorBase = "http://sensors/"
+	rdfSchemaBase = "http://schemas/"
+	rdfNamespace  = "http://www.w3.org/1999/02/22-rdf-syntax-ns#"
+	xsdNamespace  = "http://www.w3.org/2001/XMLSchema#"
+)
+
+// rdfPrefixes are the prefixes of the RDF serializations.
+var rdfPrefixes = [][2]string{
+	{"rdf", rdfNamespace},
+	{"xsd", xsdNamespace},
+	{"mijia", rdfSchemaBase},
+}
+
+// sensorIRI is the IRI of a sensor, e.g. <http://sensors/a4:c1:38:00:00:00>.
+func sensorIRI(mac string) string {
+	return rdfSensorBase + mac
+}
+
+// readingIRI is the IRI of a reading of the sensor, named by its time.
+func readingIRI(mac string, reading SensorReading) string {
+	return sensorIRI(mac) + "/" + reading.Timestamp.UTC().Format(time.RFC3339)
+}
+
+func schemaTerm(name string) rdf2go.Term {
+	return rdf2go.NewResource(rdfSchemaBase + name)
+}
+
+func xsdLiteral(value string, datatype string) rdf2go.Term {
+	return rdf2go.NewLiteralWithDatatype(value, rdf2go.NewResource(xsdNamespace+datatype))
+}
+
+func doubleLiteral(v float64) rdf2go.Term {
+	return xsdLiteral(strconv.FormatFloat(v, 'f', -1, 64), "double")
+}
+
+func integerLiteral(v int64) rdf2go.Term {
+	return xsdLiteral(strconv.FormatInt(v, 10), "integer")
+}
+
+// sensorTriples returns the triples describing the sensor.
+func sensorTriples(mac string, loc string) []*rdf2go.Triple {
+	sensor := rdf2go.NewResource(sensorIRI(mac))
+	return []*rdf2go.Triple{
+		rdf2go.NewTriple(sensor, rdf2go.NewResource(rdfNamespace+"type"), schemaTerm("Sensor")),
+		rdf2go.NewTriple(sensor, schemaTerm("mac"), rdf2go.NewLiteral(mac)),
+		rdf2go.NewTriple(sensor, schemaTerm("location"), rdf2go.NewLiteral(loc)),
+	}
+}
+
+// readingTriples returns the triples of a reading of the sensor.
+func readingTriples(mac string, reading SensorReading) []*rdf2go.Triple {
+	subject := rdf2go.NewResource(readingIRI(mac, reading))
+	return []*rdf2go.Triple{
+		rdf2go.NewTriple(subject, rdf2go.NewResource(rdfNamespace+"type"), schemaTerm("SensorReading")),
+		rdf2go.NewTriple(subject, schemaTerm("sensor"), rdf2go.NewResource(sensorIRI(mac))),
+		rdf2go.NewTriple(subject, schemaTerm("timestamp"), xsdLiteral(reading.Timestamp.UTC().Format(time.RFC3339), "dateTime")),
+		rdf2go.NewTriple(subject, schemaTerm("temperature"), doubleLiteral(reading.Temp)),
+		rdf2go.NewTriple(subject, schemaTerm("humidity"), doubleLiteral(reading.Humidity)),
+		rdf2go.NewTriple(subject, schemaTerm("batteryMv"), integerLiteral(int64(reading.BatteryMV))),
+		rdf2go.NewTriple(subject, schemaTerm("batteryLevel"), integerLiteral(int64(reading.BatteryLevel))),
+	}
+}
+
+// historyGraph builds the RDF graph of the sensor and its readings.
+func historyGraph(history *SensorHistory) *rdf2go.Graph {
+	graph := rdf2go.NewGraph(sensorIRI(history.Mac))
+	for _, prefix := range rdfPrefixes {
+		graph.AddPrefix(prefix[0], prefix[1])
+	}
+	for _, triple := range sensorTriples(history.Mac, history.Loc) {
+		graph.Add(triple)
+	}
+	for _, reading := range history.Readings {
+		for _, triple := range readingTriples(history.Mac, reading) {
+			graph.Add(triple)
+		}
+	}
+	return graph
+}
+
+// exportSparql writes the history as RDF in Turtle, ready to be loaded
+// into a SPARQL endpoint.
+func exportSparql(w http.ResponseWriter, r *http.Request) {
+	history, ok := loadHistory(w, r)
+	if !ok {
+		return
+	}
+
+	var out bytes.Buffer
+	if err := historyGraph(history).Serialize(&out, "text/turtle"); err != nil {
+		exportError(w, err)
+		return
+	}
+	setAttachment(w, "text/turtle", exportFilename(history.Mac, "ttl"))
+	w.Write(out.Bytes())
+}
+
+// jsonldContext is the JSON-LD context of the jsonld export, served at
+// /api/context.json. The terms map to schema.org where it has an
+// equivalent and to the vocabulary of the Turtle export otherwise.
+func jsonldContext() map[string]any {
+	return map[string]any{
+		"@context": map[string]any{
+			"schema":        "https://schema.org/",
+			"xsd":           xsdNamespace,
+			"mijia":         rdfSchemaBase,
+			"Sensor":        "mijia:Sensor",
+			"SensorReading": "mijia:SensorReading",
+			"Observation":   "schema:Observation",
+			"mac":           "schema:identifier",
+			"loc":           "schema:location",
+			"sensor":        map[string]string{"@id": "schema:observationAbout", "@type": "@id"},
+			"timestamp":     map[string]string{"@id": "schema:observationDate", "@type": "xsd:dateTime"},
+			"temp":          map[string]string{"@id": "mijia:temperature", "@type": "xsd:double"},
+			"humidity":      map[string]string{"@id": "mijia:humidity", "@type": "xsd:double"},
+			"battery_mv":    map[string]string{"@id": "mijia:batteryMv", "@type": "xsd:integer"},
+			"battery_level": map[string]string{"@id": "mijia:batteryLevel", "@type": "xsd:integer"},
+		},
+	}
+}
+
+func jsonldContextHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	writeJSON(w, "application/ld+json", jsonldContext())
+}
+
+// historyJsonld builds the JSON-LD graph of the sensor and its readings,
+// referencing the context served by this server.
+func historyJsonld(r *http.Request, history *SensorHistory) map[string]any {
+	graph := []any{map[string]any{
+		"@id":   sensorIRI(history.Mac),
+		"@type": "Sensor",
+		"mac":   history.Mac,
+		"loc":   history.Loc,
+	}}
+	for _, reading := range history.Readings {
+		graph = append(graph, map[string]any{
+			"@id":           readingIRI(history.Mac, reading),
+			"@type":         []string{"SensorReading", "Observation"},
+			"sensor":        sensorIRI(history.Mac),
+			"timestamp":     reading.Timestamp.UTC().Format(time.RFC3339),
+			"temp":          reading.Temp,
+			"humidity":      reading.Humidity,
+			"battery_mv":    reading.BatteryMV,
+			"battery_level": reading.BatteryLevel,
+		})
+	}
+
+	return map[string]any{
+		"@context": serverURL(r) + "/api/context.json",
+		"@graph":   graph,
+	}
+}
+
+// exportJsonld writes the history as JSON-LD graph of the sensor and its
+// readings.
+func exportJsonld(w http.ResponseWriter, r *http.Request) {
+	history, ok := loadHistory(w, r)
+	if !ok {
+		return
+	}
+
+	writeJSON(w, "application/ld+json", historyJsonld(r, history))
+}
+
+// jsonldDocument converts v to the generic maps and slices json-gold
+// processes by a round trip through JSON.
+func jsonldDocument(v any) (any, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var doc any
+	err = json.Unmarshal(data, &doc)
+	return doc, err
+}
+
+// Remote JSON-LD documents, frames and the contexts they reference, are
+// loaded with jsonldClient and limited to jsonldMaxDocumentSize bytes.
+const (
+	jsonldMaxDocumentSize = 1 << 20
+	jsonldLoadTimeout     = 10 * time.Second
+)
+
+// jsonldClient only connects to public addresses, the frame URL is chosen by
+// the client and must not reach the server's own or the local network.
+var jsonldClient = publicClient(jsonldLoadTimeout)
+
+// jsonldLoader resolves the context of the server from memory and loads any
+// other document over http or https with jsonldClient. Unlike the default
+// loader of json-gold it never opens local files.
+type jsonldLoader struct {
+	contextURL string
+	context    any
+}
+
+func (l jsonldLoader) LoadDocument(u string) (*ld.RemoteDocument, error) {
+	if u == l.contextURL {
+		return &ld.RemoteDocument{DocumentURL: u, Document: l.context}, nil
+	}
+	parsed, err := url.Parse(u)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return nil, ld.NewJsonLdError(ld.LoadingDocumentFailed, fmt.Sprintf("only http and https URLs are allowed: %q", u))
+	}
+
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, ld.NewJsonLdError(ld.LoadingDocumentFailed, err)
+	}
+	req.Header.Set("Accept", "application/ld+json, application/json")
+	resp, err := jsonldClient.Do(req)
+	if err != nil {
+		return nil, ld.NewJsonLdError(ld.LoadingDocumentFailed, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, ld.NewJsonLdError(ld.LoadingDocumentFailed, fmt.Sprintf("%s: %s", u, resp.Status))
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, jsonldMaxDocumentSize+1))
+	if err != nil {
+		return nil, ld.NewJsonLdError(ld.LoadingDocumentFailed, err)
+	}
+	if len(body) > jsonldMaxDocumentSize {
+		return nil, ld.NewJsonLdError(ld.LoadingDocumentFailed, fmt.Sprintf("%s is larger than %d bytes", u, jsonldMaxDocumentSize))
+	}
+	doc, err := ld.DocumentFromReader(bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	return &ld.RemoteDocument{DocumentURL: resp.Request.URL.String(), Document: doc}, nil
+}
+
+// exportFraming writes the JSON-LD export reshaped by a JSON-LD frame. The
+// default frame selects the readings as flat objects referencing the sensor,
+// ?frame= loads another frame from a public http(s) URL with jsonldLoader.
+// The @graph is sorted by timestamp.
+func exportFraming(w http.ResponseWriter, r *http.Request) {
+	history, ok := loadHistory(w, r)
+	if !ok {
+		return
+	}
+
+	// the context is resolved locally instead of requesting it from ourselves
+	contextURL := serverURL(r) + "/api/context.json"
+	context, err := jsonldDocument(jsonldContext())
+	if err != nil {
+		exportError(w, err)
+		return
+	}
+	loader := jsonldLoader{contextURL: contextURL, context: context}
+
+	frame := map[string]any{
+		"@context": contextURL,
+		"@type":    "SensorReading",
+		"sensor":   map[string]any{"@embed": ld.EmbedNever},
+	}
+	if frameURL := r.URL.Query().Get("frame"); frameURL != "" {
+		doc, err := loader.LoadDocument(frameURL)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error loading frame: %v", err), http.StatusBadRequest)
+			return
+		}
+		if frame, ok = doc.Document.(map[string]any); !ok {
+			http.Error(w, "Frame must be a JSON object", http.StatusBadRequest)
+			return
+		}
+	}
+
+	input, err := jsonldDocument(historyJsonld(r, history))
+	if err != nil {
+		exportError(w, err)
+		return
+	}
+	options := ld.NewJsonLdOptions("")
+	options.DocumentLoader = loader
+	options.ProcessingMode = ld.JsonLd_1_1
+	framed, err := ld.NewJsonLdProcessor().Frame(input, frame, options)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error framing: %v", err), http.StatusBadRequest)
+		return
+	}
+	// keep the context as referenced by the frame instead of inlined
+	if context, ok := frame["@context"]; ok {
+		framed["@context"] = context
+	}
+
+	if graph, ok := framed["@graph"].([]any); ok {
+		timestamp := func(node any) string {
+			object, _ := node.(map[string]any)
+			s, _ := object["timestamp"].(string)
+			return s
+		}
+		sort.SliceStable(graph, func(i, j int) bool {
+			return timestamp(graph[i]) < timestamp(graph[j])
+		})
+	}
+	writeJSON(w, "application/ld+json", framed)
+}
+
+// turtleStatements serializes the graph as Turtle without the prefix
+// declarations, for documents declaring rdfPrefixes once.
+func turtleStatements(graph *rdf2go.Graph) (string, error) {
+	var out strings.Builder
+	if err := graph.Serialize(&out, "text/turtle"); err != nil {
+		return "", err
+	}
+	var lines []string
+	for _, line := range strings.Split(out.String(), "\n") {
+		if line != "" && !strings.HasPrefix(line, "@prefix ") {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// exportTrig writes the history as TriG dataset: the sensor in the default
+// graph and the readings of each day (UTC) in the named graph
+// <http://sensors/<mac>/<YYYY-MM-DD>>.
+func exportTrig(w http.ResponseWriter, r *http.Request) {
+	history, ok := loadHistory(w, r)
+	if !ok {
+		return
+	}
+
+	var out strings.Builder
+	for _, prefix := range rdfPrefixes {
+		fmt.Fprintf(&out, "@prefix %s: <%s> .\n", prefix[0], prefix[1])
+	}
+	sensor, err := turtleStatements(historyGraph(&SensorHistory{Mac: history.Mac, Loc: history.Loc}))
+	if err != nil {
+		exportError(w, err)
+		return
+	}
+	fmt.Fprintf(&out, "\n%s\n", sensor)
+
+	readings := history.Readings
+	for len(readings) > 0 {
+		day := readings[0].Timestamp.UTC().Format(time.DateOnly)
+		n := 1
+		for n < len(readings) && readings[n].Timestamp.UTC().Format(time.DateOnly) == day {
+			n++
+		}
+		graph := rdf2go.NewGraph(sensorIRI(history.Mac) + "/" + day)
+		for _, prefix := range rdfPrefixes {
+			graph.AddPrefix(prefix[0], prefix[1])
+		}
+		for _, reading := range readings[:n] {
+			for _, triple := range readingTriples(history.Mac, reading) {
+				graph.Add(triple)
+			}
+		}
+		statements, err := turtleStatements(graph)
+		if err != nil {
+			exportError(w, err)
+			return
+		}
+		fmt.Fprintf(&out, "\n<%s> {\n  %s\n}\n", graph.URI(), strings.ReplaceAll(statements, "\n", "\n  "))
+		readings = readings[n:]
+	}
+
+	setAttachment(w, "application/trig", exportFilename(history.Mac, "trig"))
+	w.Write([]byte(out.String()))
+}
+
+// exportNquads writes the history as N-Quads, one statement per line in
+// the graph <http://sensors/<mac>/graph>, for bulk loaders like riot.
+func exportNquads(w http.ResponseWriter, r *http.Request) {
+	history, ok := loadHistory(w, r)
+	if !ok {
+		return
+	}
+
+	graph := "<" + sensorIRI(history.Mac) + "/graph>"
+	out := bufio.NewWriter(w)
+	write := func(triple *rdf2go.Triple) {
+		fmt.Fprintf(out, "%s %s %s %s .\n", triple.Subject, triple.Predicate, triple.Object, graph)
+	}
+	setAttachment(w, "application/n-quads", exportFilename(history.Mac, "nq"))
+	for _, triple := range sensorTriples(history.Mac, history.Loc) {
+		write(triple)
+	}
+	for _, reading := range history.Readings {
+		for _, triple := range readingTriples(history.Mac, reading) {
+			write(triple)
+		}
+	}
+	if err := out.Flush(); err != nil {
+		log.Printf("%v", err)
+	}
+}
+
+// shaclShapes is the SHACL shapes graph of the RDF exports in Turtle, %s
+// being the sensor IRI. The measurements are xsd:double as in the exports,
+// bounded by the operating range of the sensors.
+const shaclShapes = `
+mijia:SensorShape
+  a sh:NodeShape ;
+  sh:targetClass mijia:Sensor ;
+  sh:property [
+    sh:path mijia:mac ;
+    sh:datatype xsd:string ;
+    sh:pattern "^([0-9a-f]{2}:){5}[0-9a-f]{2}$" ;
+    sh:minCount 1 ;
+    sh:maxCount 1 ;
+  ] ;
+  sh:property [
+    sh:path mijia:location ;
+    sh:datatype xsd:string ;
+    sh:maxCount 1 ;
+  ] .
+
+mijia:SensorReadingShape
+  a sh:NodeShape ;
+  sh:targetClass mijia:SensorReading ;
+  sh:property [
+    sh:path mijia:sensor ;
+    sh:hasValue <%s> ;
+    sh:minCount 1 ;
+    sh:maxCount 1 ;
+  ] ;
+  sh:property [
+    sh:path mijia:timestamp ;
+    sh:datatype xsd:dateTime ;
+    sh:minCount 1 ;
+    sh:maxCount 1 ;
+  ] ;
+  sh:property [
+    sh:path mijia:temperature ;
+    sh:datatype xsd:double ;
+    sh:minInclusive -40 ;
+    sh:maxInclusive 85 ;
+    sh:minCount 1 ;
+    sh:maxCount 1 ;
+  ] ;
+  sh:property [
+    sh:path mijia:humidity ;
+    sh:datatype xsd:double ;
+    sh:minInclusive 0 ;
+    sh:maxInclusive 100 ;
+    sh:minCount 1 ;
+    sh:maxCount 1 ;
+  ] ;
+  sh:property [
+    sh:path mijia:batteryMv ;
+    sh:datatype xsd:integer ;
+    sh:minInclusive 0 ;
+    sh:maxCount 1 ;
+  ] ;
+  sh:property [
+    sh:path mijia:batteryLevel ;
+    sh:datatype xsd:integer ;
+    sh:minInclusive 0 ;
+    sh:maxInclusive 100 ;
+    sh:maxCount 1 ;
+  ] .
+`
+
+// exportShacl writes the SHACL shapes the RDF exports of the sensor conform
+// to, for validating them with a SHACL validator like pySHACL.
+func exportShacl(w http.ResponseWriter, r *http.Request) {
+	sensor, ok := loadSensor(w, r)
+	if !ok {
+		return
+	}
+
+	var out strings.Builder
+	for _, prefix := range rdfPrefixes {
+		fmt.Fprintf(&out, "@prefix %s: <%s> .\n", prefix[0], prefix[1])
+	}
+	out.WriteString("@prefix sh: <http://www.w3.org/ns/shacl#> .\n")
+	fmt.Fprintf(&out, shaclShapes, sensorIRI(sensor.Mac))
+	setAttachment(w, "text/turtle", sensorName(sensor.Mac)+"_shapes.ttl")
+	w.Write([]byte(out.String()))
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+)
+
+// The Shapefile is written following the ESRI Shapefile Technical
+// Description: the header and record headers of .shp and .shx are partly
+// big endian, lengths and offsets count 16 bit words.
+
+const (
+	shapeTypePoint    = 1
+	shapeHeaderWords  = 50
+	shapePointWords   = 10 // shape type and x, y
+	shapeRecordHeader = 4
+
+	// dBASE III with field names of up to 10 characters
+	dbfVersion = 0x03
+)
+
+// shapefilePrj is the WGS 84 projection of the positions from the config.
+const shapefilePrj = `GEOGCS["GCS_WGS_1984",DATUM["D_WGS_1984",SPHEROID["WGS_1984",6378137.0,298.257223563]],PRIMEM["Greenwich",0.0],UNIT["Degree",0.0174532925199433]]`
+
+// shapeHeader writes the file header shared by .shp and .shx.
+func shapeHeader(out *bytes.Buffer, words int, bbox [4]float64) {
+	binary.Write(out, binary.BigEndian, []int32{9994, 0, 0, 0, 0, 0, int32(words)})
+	binary.Write(out, binary.LittleEndian, []int32{1000, shapeTypePoint})
+	// x and y range, z and m are unused
+	binary.Write(out, binary.LittleEndian, append(bbox[:], 0, 0, 0, 0))
+}
+
+// dbfField is a column of the attribute table.
+type dbfField struct {
+	Name     string
+	Type     byte // C for text, N for numbers
+	Length   int
+	Decimals int
+}
+
+// dbfTable builds a dBASE III table of the given records, each a value per
+// field.
+func dbfTable(fields []dbfField, records [][]any, updated time.Time) []byte {
+	recordLength := 1
+	for _, field := range fields {
+		recordLength += field.Length
+	}
+
+	var out bytes.Buffer
+	out.Write([]byte{dbfVersion, byte(updated.Year() - 1900), byte(updated.Month()), byte(updated.Day())})
+	binary.Write(&out, binary.LittleEndian, uint32(len(records)))
+	binary.Write(&out, binary.LittleEndian, uint16(32+32*len(fields)+1))
+	binary.Write(&out, binary.LittleEndian, uint16(recordLength))
+	out.Write(make([]byte, 20))
+	for _, field := range fields {
+		name := make([]byte, 11)
+		copy(name, field.Name)
+		out.Write(name)
+		out.WriteByte(field.Type)
+		out.Write(make([]byte, 4))
+		out.Write([]byte{byte(field.Length), byte(field.Decimals)})
+		out.Write(make([]byte, 14))
+	}
+	out.WriteByte(0x0D)
+
+	for _, record := range records {
+		// not deleted
+		out.WriteByte(' ')
+		for i, field := range fields {
+			var value string
+			switch v := record[i].(type) {
+			case float64:
+				value = fmt.Sprintf("%*.*f", field.Length, field.Decimals, v)
+			case int:
+				value = fmt.Sprintf("%*d", field.Length, v)
+			default:
+				value = fmt.Sprintf("%-*v", field.Length, v)
+			}
+			out.WriteString(value[:field.Length])
+		}
+	}
+	out.WriteByte(0x1A)
+	return out.Bytes()
+}
+
+// exportShapefile writes the history as zipped Shapefile of point features
+// at the position of the sensor, one per reading. battery_level is named
+// batt_level, dBASE field names are limited to 10 characters.
+func exportShapefile(w http.ResponseWriter, r *http.Request) {
+	history, position, ok := loadGeoHistory(w, r)
+	if !ok {
+		return
+	}
+
+	n := len(history.Readings)
+	var bbox [4]float64
+	if n > 0 {
+		bbox = [4]float64{position.Lon, position.Lat, position.Lon, position.Lat}
+	}
+	recordWords := shapeRecordHeader + shapePointWords
+
+	var shp, shx bytes.Buffer
+	shapeHeader(&shp, shapeHeaderWords+n*recordWords, bbox)
+	shapeHeader(&shx, shapeHeaderWords+n*shapeRecordHeader, bbox)
+	var records [][]any
+	for i, reading := range history.Readings {
+		binary.Write(&shp, binary.BigEndian, []int32{int32(i + 1), shapePointWords})
+		binary.Write(&shp, binary.LittleEndian, int32(shapeTypePoint))
+		binary.Write(&shp, binary.LittleEndian, []float64{position.Lon, position.Lat})
+		binary.Write(&shx, binary.BigEndian, []int32{int32(shapeHeaderWords + i*recordWords), shapePointWords})
+		records = append(records, []any{
+			reading.Timestamp.UTC().Format(time.RFC3339),
+			math.Round(reading.Temp*100) / 100,
+			math.Round(reading.Humidity*100) / 100,
+			int(reading.BatteryMV),
+			int(reading.BatteryLevel),
+		})
+	}
+	dbf := dbfTable([]dbfField{
+		{"timestamp", 'C', 20, 0},
+		{"temp", 'N', 7, 2},
+		{"humidity", 'N', 7, 2},
+		{"battery_mv", 'N', 5, 0},
+		{"batt_level", 'N', 4, 0},
+	}, records, time.Now().UTC())
+
+	name := sensorName(history.Mac)
+	writeZip(w, exportFilename(history.Mac, "shp.zip"), []zipFile{
+		{Name: name + ".shp", Data: shp.Bytes()},
+		{Name: name + ".shx", Data: shx.Bytes()},
+		{Name: name + ".dbf", Data: dbf},
+		{Name: name + ".prj", Data: []byte(shapefilePrj)},
+		{Name: name + ".cpg", Data: []byte("UTF-8")},
+	})
+}
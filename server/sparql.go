@@ -0,0 +1,957 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"net/http"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/deiu/rdf2go"
+)
+
+// sparqlReadings is the number of the latest readings of each sensor in
+// the graph queried by /sparql.
+const sparqlReadings = 1000
+
+// The patterns are joined depth first, only the solutions are kept in
+// memory. A query fails with more than sparqlMaxSolutions of them, before
+// OFFSET and LIMIT, or when it runs longer than sparqlTimeout.
+const (
+	sparqlMaxSolutions = 100000
+	sparqlTimeout      = 10 * time.Second
+)
+
+var errSparqlTooManySolutions = fmt.Errorf("query has more than %d solutions, add patterns, filters or a LIMIT", sparqlMaxSolutions)
+
+// The /sparql endpoint implements SELECT queries without generated code
+// or a triple store: basic graph patterns with FILTER, DISTINCT, ORDER BY,
+// LIMIT and OFFSET. OPTIONAL, UNION, property paths, aggregates and
+// subqueries are not supported.
+
+type sparqlToken struct {
+	Kind string // punct, iri, var, string, number, name
+	Text string
+}
+
+type sparqlNode struct {
+	Var  string
+	Term rdf2go.Term
+}
+
+type sparqlPattern struct {
+	Subject, Predicate, Object sparqlNode
+}
+
+// sparqlBinding maps variable names to terms.
+type sparqlBinding map[string]rdf2go.Term
+
+// sparqlExpr evaluates to a term, nil if the expression is unbound or an
+// error.
+type sparqlExpr func(binding sparqlBinding) rdf2go.Term
+
+type sparqlOrder struct {
+	Expr sparqlExpr
+	Desc bool
+}
+
+type sparqlQuery struct {
+	Vars     []string // nil for SELECT *
+	Distinct bool
+	Patterns []sparqlPattern
+	Filters  []sparqlExpr
+	Order    []sparqlOrder
+	Limit    int // -1 without LIMIT
+	Offset   int
+}
+
+func tokenizeSparql(query string) ([]sparqlToken, error) {
+	var tokens []sparqlToken
+	for i := 0; i < len(query); {
+		c := query[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '#':
+			for i < len(query) && query[i] != '\n' {
+				i++
+			}
+		case c == '<':
+			// an IRI if it is closed before any whitespace, else an operator
+			if end := strings.IndexAny(query[i+1:], "<> \t\n\r"); end >= 0 && query[i+1+end] == '>' {
+				tokens = append(tokens, sparqlToken{"iri", query[i+1 : i+1+end]})
+				i += end + 2
+				continue
+			}
+			fallthrough
+		case strings.ContainsRune("=!><&|", rune(c)):
+			op := string(c)
+			if i+1 < len(query) && slices.Contains([]string{"!=", "<=", ">=", "&&", "||"}, query[i:i+2]) {
+				op = query[i : i+2]
+			}
+			tokens = append(tokens, sparqlToken{"punct", op})
+			i += len(op)
+		case strings.ContainsRune("{}().;,*", rune(c)) && !(c == '.' && i+1 < len(query) && unicode.IsDigit(rune(query[i+1]))):
+			tokens = append(tokens, sparqlToken{"punct", string(c)})
+			i++
+		case c == '^' && i+1 < len(query) && query[i+1] == '^':
+			tokens = append(tokens, sparqlToken{"punct", "^^"})
+			i += 2
+		case c == '"' || c == '\'':
+			var value strings.Builder
+			j := i + 1
+			for ; j < len(query) && query[j] != c; j++ {
+				if query[j] == '\\' && j+1 < len(query) {
+					j++
+					switch query[j] {
+					case 'n':
+						value.WriteByte('\n')
+					case 't':
+						value.WriteByte('\t')
+					case 'r':
+						value.WriteByte('\r')
+					default:
+						value.WriteByte(query[j])
+					}
+					continue
+				}
+				value.WriteByte(query[j])
+			}
+			if j >= len(query) {
+				return nil, fmt.Errorf("unterminated string literal")
+			}
+			tokens = append(tokens, sparqlToken{"string", value.String()})
+			i = j + 1
+		case c == '?' || c == '$':
+			j := i + 1
+			for j < len(query) && (unicode.IsLetter(rune(query[j])) || unicode.IsDigit(rune(query[j])) || query[j] == '_') {
+				j++
+			}
+			if j == i+1 {
+				return nil, fmt.Errorf("empty variable name")
+			}
+			tokens = append(tokens, sparqlToken{"var", query[i+1 : j]})
+			i = j
+		case c == '@':
+			j := i + 1
+			for j < len(query) && (unicode.IsLetter(rune(query[j])) || query[j] == '-') {
+				j++
+			}
+			tokens = append(tokens, sparqlToken{"lang", query[i+1 : j]})
+			i = j
+		case unicode.IsDigit(rune(c)) || c == '.' || ((c == '+' || c == '-') && i+1 < len(query) && unicode.IsDigit(rune(query[i+1]))):
+			j := i + 1
+			for j < len(query) && (unicode.IsDigit(rune(query[j])) || strings.ContainsRune(".eE", rune(query[j])) ||
+				((query[j] == '+' || query[j] == '-') && (query[j-1] == 'e' || query[j-1] == 'E'))) {
+				j++
+			}
+			// a final dot ends the triple
+			if query[j-1] == '.' {
+				j--
+			}
+			tokens = append(tokens, sparqlToken{"number", query[i:j]})
+			i = j
+		default:
+			j := i
+			for j < len(query) && (unicode.IsLetter(rune(query[j])) || unicode.IsDigit(rune(query[j])) || strings.ContainsRune("_-:.", rune(query[j]))) {
+				j++
+			}
+			// prefixed names do not end with a dot
+			for j > i && query[j-1] == '.' {
+				j--
+			}
+			if j == i {
+				return nil, fmt.Errorf("unexpected %q", c)
+			}
+			tokens = append(tokens, sparqlToken{"name", query[i:j]})
+			i = j
+		}
+	}
+	return tokens, nil
+}
+
+type sparqlParser struct {
+	tokens   []sparqlToken
+	pos      int
+	prefixes map[string]string
+}
+
+func (p *sparqlParser) peek() sparqlToken {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return sparqlToken{}
+}
+
+// keyword reports whether the next token is the case-insensitive keyword
+// and consumes it.
+func (p *sparqlParser) keyword(keyword string) bool {
+	if t := p.peek(); t.Kind == "name" && strings.EqualFold(t.Text, keyword) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *sparqlParser) punct(punct string) bool {
+	if t := p.peek(); t.Kind == "punct" && t.Text == punct {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *sparqlParser) expect(punct string) error {
+	if !p.punct(punct) {
+		return fmt.Errorf("expected %q", punct)
+	}
+	return nil
+}
+
+func parseSparql(query string) (*sparqlQuery, error) {
+	tokens, err := tokenizeSparql(query)
+	if err != nil {
+		return nil, err
+	}
+	p := &sparqlParser{tokens: tokens, prefixes: map[string]string{}}
+	for _, prefix := range rdfPrefixes {
+		p.prefixes[prefix[0]] = prefix[1]
+	}
+	for p.keyword("PREFIX") {
+		name, iri := p.peek(), sparqlToken{}
+		p.pos++
+		if p.pos < len(p.tokens) {
+			iri = p.tokens[p.pos]
+			p.pos++
+		}
+		if name.Kind != "name" || !strings.HasSuffix(name.Text, ":") || iri.Kind != "iri" {
+			return nil, fmt.Errorf("invalid PREFIX declaration")
+		}
+		p.prefixes[strings.TrimSuffix(name.Text, ":")] = iri.Text
+	}
+
+	q := &sparqlQuery{Limit: -1}
+	if !p.keyword("SELECT") {
+		return nil, fmt.Errorf("only SELECT queries are supported")
+	}
+	q.Distinct = p.keyword("DISTINCT")
+	if !p.punct("*") {
+		for p.peek().Kind == "var" {
+			q.Vars = append(q.Vars, p.peek().Text)
+			p.pos++
+		}
+		if len(q.Vars) == 0 {
+			return nil, fmt.Errorf("expected variables or * after SELECT")
+		}
+	}
+	p.keyword("WHERE")
+	if err := p.parseGroup(q); err != nil {
+		return nil, err
+	}
+
+	for {
+		switch {
+		case p.keyword("ORDER"):
+			if !p.keyword("BY") {
+				return nil, fmt.Errorf("expected BY after ORDER")
+			}
+			for {
+				desc := false
+				var expr sparqlExpr
+				if p.keyword("ASC") || p.keyword("DESC") {
+					desc = strings.EqualFold(p.tokens[p.pos-1].Text, "DESC")
+					if err := p.expect("("); err != nil {
+						return nil, err
+					}
+					if expr, err = p.parseOr(); err != nil {
+						return nil, err
+					}
+					if err := p.expect(")"); err != nil {
+						return nil, err
+					}
+				} else if t := p.peek(); t.Kind == "var" {
+					p.pos++
+					expr = func(binding sparqlBinding) rdf2go.Term { return binding[t.Text] }
+				} else {
+					break
+				}
+				q.Order = append(q.Order, sparqlOrder{Expr: expr, Desc: desc})
+			}
+			if len(q.Order) == 0 {
+				return nil, fmt.Errorf("expected ORDER BY conditions")
+			}
+		case p.keyword("LIMIT"):
+			if q.Limit, err = p.parseCount(); err != nil {
+				return nil, err
+			}
+		case p.keyword("OFFSET"):
+			if q.Offset, err = p.parseCount(); err != nil {
+				return nil, err
+			}
+		default:
+			if p.pos < len(p.tokens) {
+				return nil, fmt.Errorf("unexpected %q", p.peek().Text)
+			}
+			return q, nil
+		}
+	}
+}
+
+func (p *sparqlParser) parseCount() (int, error) {
+	t := p.peek()
+	n, err := strconv.Atoi(t.Text)
+	if t.Kind != "number" || err != nil || n < 0 {
+		return 0, fmt.Errorf("expected a non-negative integer")
+	}
+	p.pos++
+	return n, nil
+}
+
+// parseGroup parses the group graph pattern { triples and FILTERs }.
+func (p *sparqlParser) parseGroup(q *sparqlQuery) error {
+	if err := p.expect("{"); err != nil {
+		return err
+	}
+	for !p.punct("}") {
+		if p.pos >= len(p.tokens) {
+			return fmt.Errorf("expected \"}\"")
+		}
+		if p.punct(".") {
+			continue
+		}
+		if p.keyword("FILTER") {
+			if err := p.expect("("); err != nil {
+				return err
+			}
+			expr, err := p.parseOr()
+			if err != nil {
+				return err
+			}
+			if err := p.expect(")"); err != nil {
+				return err
+			}
+			q.Filters = append(q.Filters, expr)
+			continue
+		}
+		if t := p.peek(); t.Kind == "name" && slices.ContainsFunc([]string{"OPTIONAL", "UNION", "GRAPH", "MINUS", "BIND", "VALUES", "SERVICE"}, func(k string) bool {
+			return strings.EqualFold(t.Text, k)
+		}) {
+			return fmt.Errorf("%s is not supported", strings.ToUpper(t.Text))
+		}
+
+		subject, err := p.parseNode(false)
+		if err != nil {
+			return err
+		}
+		for {
+			predicate, err := p.parseNode(true)
+			if err != nil {
+				return err
+			}
+			for {
+				object, err := p.parseNode(false)
+				if err != nil {
+					return err
+				}
+				q.Patterns = append(q.Patterns, sparqlPattern{subject, predicate, object})
+				if !p.punct(",") {
+					break
+				}
+			}
+			if !p.punct(";") {
+				break
+			}
+			// a trailing ; before . or }
+			if t := p.peek(); t.Kind == "punct" && (t.Text == "." || t.Text == "}") {
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// parseNode parses a variable or RDF term of a triple pattern, the verb
+// "a" is accepted as predicate.
+func (p *sparqlParser) parseNode(predicate bool) (sparqlNode, error) {
+	t := p.peek()
+	if t.Kind == "var" {
+		p.pos++
+		return sparqlNode{Var: t.Text}, nil
+	}
+	if predicate && t.Kind == "name" && t.Text == "a" {
+		p.pos++
+		return sparqlNode{Term: rdf2go.NewResource(rdfNamespace + "type")}, nil
+	}
+	term, err := p.parseTerm()
+	return sparqlNode{Term: term}, err
+}
+
+// parseTerm parses an IRI, prefixed name or literal.
+func (p *sparqlParser) parseTerm() (rdf2go.Term, error) {
+	t := p.peek()
+	p.pos++
+	switch t.Kind {
+	case "iri":
+		return rdf2go.NewResource(t.Text), nil
+	case "number":
+		datatype := "integer"
+		if strings.ContainsAny(t.Text, "eE") {
+			datatype = "double"
+		} else if strings.Contains(t.Text, ".") {
+			datatype = "decimal"
+		}
+		return xsdLiteral(strings.TrimPrefix(t.Text, "+"), datatype), nil
+	case "string":
+		if next := p.peek(); next.Kind == "lang" {
+			p.pos++
+			return rdf2go.NewLiteralWithLanguage(t.Text, next.Text), nil
+		}
+		if p.punct("^^") {
+			datatype, err := p.parseTerm()
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := datatype.(*rdf2go.Resource); !ok {
+				return nil, fmt.Errorf("invalid datatype")
+			}
+			return rdf2go.NewLiteralWithDatatype(t.Text, datatype), nil
+		}
+		return rdf2go.NewLiteral(t.Text), nil
+	case "name":
+		if strings.EqualFold(t.Text, "true") || strings.EqualFold(t.Text, "false") {
+			return xsdLiteral(strings.ToLower(t.Text), "boolean"), nil
+		}
+		prefix, local, ok := strings.Cut(t.Text, ":")
+		namespace, known := p.prefixes[prefix]
+		if !ok || !known {
+			return nil, fmt.Errorf("unknown prefix in %q", t.Text)
+		}
+		return rdf2go.NewResource(namespace + local), nil
+	}
+	if t.Kind == "" {
+		return nil, fmt.Errorf("unexpected end of query")
+	}
+	return nil, fmt.Errorf("unexpected %q", t.Text)
+}
+
+func (p *sparqlParser) parseOr() (sparqlExpr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.punct("||") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(binding sparqlBinding) rdf2go.Term {
+			return sparqlBoolean(sparqlTrue(l(binding)) || sparqlTrue(right(binding)))
+		}
+	}
+	return left, nil
+}
+
+func (p *sparqlParser) parseAnd() (sparqlExpr, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.punct("&&") {
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(binding sparqlBinding) rdf2go.Term {
+			return sparqlBoolean(sparqlTrue(l(binding)) && sparqlTrue(right(binding)))
+		}
+	}
+	return left, nil
+}
+
+func (p *sparqlParser) parseUnary() (sparqlExpr, error) {
+	if p.punct("!") {
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return func(binding sparqlBinding) rdf2go.Term {
+			return sparqlBoolean(!sparqlTrue(operand(binding)))
+		}, nil
+	}
+	left, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	t := p.peek()
+	var matches func(c int) bool
+	switch t.Text {
+	case "=":
+		matches = func(c int) bool { return c == 0 }
+	case "!=":
+		matches = func(c int) bool { return c != 0 }
+	case "<":
+		matches = func(c int) bool { return c < 0 }
+	case "<=":
+		matches = func(c int) bool { return c <= 0 }
+	case ">":
+		matches = func(c int) bool { return c > 0 }
+	case ">=":
+		matches = func(c int) bool { return c >= 0 }
+	}
+	if t.Kind != "punct" || matches == nil {
+		return left, nil
+	}
+	p.pos++
+	right, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	return func(binding sparqlBinding) rdf2go.Term {
+		c, ok := compareSparqlTerms(left(binding), right(binding))
+		if !ok {
+			// terms of different kinds are only unequal
+			return sparqlBoolean(t.Text == "!=" && left(binding) != nil && right(binding) != nil)
+		}
+		return sparqlBoolean(matches(c))
+	}, nil
+}
+
+func (p *sparqlParser) parsePrimary() (sparqlExpr, error) {
+	t := p.peek()
+	switch {
+	case t.Kind == "punct" && t.Text == "(":
+		p.pos++
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		return expr, p.expect(")")
+	case t.Kind == "var":
+		p.pos++
+		return func(binding sparqlBinding) rdf2go.Term { return binding[t.Text] }, nil
+	case t.Kind == "name" && !strings.Contains(t.Text, ":") && !strings.EqualFold(t.Text, "true") && !strings.EqualFold(t.Text, "false"):
+		return p.parseFunction()
+	}
+	term, err := p.parseTerm()
+	if err != nil {
+		return nil, err
+	}
+	return func(sparqlBinding) rdf2go.Term { return term }, nil
+}
+
+// parseFunction parses the supported functions STR, BOUND and REGEX.
+func (p *sparqlParser) parseFunction() (sparqlExpr, error) {
+	name := strings.ToUpper(p.peek().Text)
+	p.pos++
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	var args []sparqlExpr
+	for !p.punct(")") {
+		if len(args) > 0 {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+		arg, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+	}
+
+	switch {
+	case name == "STR" && len(args) == 1:
+		return func(binding sparqlBinding) rdf2go.Term {
+			if term := args[0](binding); term != nil {
+				return rdf2go.NewLiteral(term.RawValue())
+			}
+			return nil
+		}, nil
+	case name == "BOUND" && len(args) == 1:
+		return func(binding sparqlBinding) rdf2go.Term {
+			return sparqlBoolean(args[0](binding) != nil)
+		}, nil
+	case name == "REGEX" && (len(args) == 2 || len(args) == 3):
+		return func(binding sparqlBinding) rdf2go.Term {
+			text, pattern := args[0](binding), args[1](binding)
+			if text == nil || pattern == nil {
+				return nil
+			}
+			expr := pattern.RawValue()
+			if len(args) == 3 {
+				if flags := args[2](binding); flags != nil && strings.Contains(flags.RawValue(), "i") {
+					expr = "(?i)" + expr
+				}
+			}
+			re, err := regexp.Compile(expr)
+			if err != nil {
+				return nil
+			}
+			return sparqlBoolean(re.MatchString(text.RawValue()))
+		}, nil
+	}
+	return nil, fmt.Errorf("unsupported function %s with %d arguments", name, len(args))
+}
+
+func sparqlBoolean(v bool) rdf2go.Term {
+	return xsdLiteral(strconv.FormatBool(v), "boolean")
+}
+
+// sparqlTrue is the effective boolean value of a term.
+func sparqlTrue(term rdf2go.Term) bool {
+	literal, ok := term.(*rdf2go.Literal)
+	if !ok {
+		return false
+	}
+	if v, ok := sparqlNumber(literal); ok {
+		return v != 0
+	}
+	if literal.Datatype != nil && literal.Datatype.RawValue() == xsdNamespace+"boolean" {
+		return literal.Value == "true" || literal.Value == "1"
+	}
+	return literal.Value != ""
+}
+
+func sparqlNumber(literal *rdf2go.Literal) (float64, bool) {
+	if literal.Datatype == nil {
+		return 0, false
+	}
+	switch strings.TrimPrefix(literal.Datatype.RawValue(), xsdNamespace) {
+	case "integer", "decimal", "double", "float", "int", "long", "short", "byte":
+		v, err := strconv.ParseFloat(literal.Value, 64)
+		return v, err == nil
+	}
+	return 0, false
+}
+
+// compareSparqlTerms orders numbers, dateTimes, strings and IRIs among
+// themselves, ok is false for terms that cannot be compared.
+func compareSparqlTerms(a, b rdf2go.Term) (int, bool) {
+	if a == nil || b == nil {
+		return 0, false
+	}
+	la, aLiteral := a.(*rdf2go.Literal)
+	lb, bLiteral := b.(*rdf2go.Literal)
+	if !aLiteral || !bLiteral {
+		if aLiteral == bLiteral && fmt.Sprintf("%T", a) == fmt.Sprintf("%T", b) {
+			return strings.Compare(a.RawValue(), b.RawValue()), true
+		}
+		return 0, false
+	}
+	if x, ok := sparqlNumber(la); ok {
+		if y, ok := sparqlNumber(lb); ok {
+			return cmp.Compare(x, y), true
+		}
+		return 0, false
+	}
+	dateTime := xsdNamespace + "dateTime"
+	if la.Datatype != nil && la.Datatype.RawValue() == dateTime && lb.Datatype != nil && lb.Datatype.RawValue() == dateTime {
+		x, errX := time.Parse(time.RFC3339, la.Value)
+		y, errY := time.Parse(time.RFC3339, lb.Value)
+		if errX == nil && errY == nil {
+			return x.Compare(y), true
+		}
+	}
+	if (la.Datatype == nil) != (lb.Datatype == nil) || (la.Datatype != nil && !la.Datatype.Equal(lb.Datatype)) || la.Language != lb.Language {
+		return 0, false
+	}
+	return strings.Compare(la.Value, lb.Value), true
+}
+
+// sparqlStore indexes the triples of the graph by subject and predicate.
+type sparqlStore struct {
+	all         []*rdf2go.Triple
+	bySubject   map[string][]*rdf2go.Triple
+	byPredicate map[string][]*rdf2go.Triple
+}
+
+func newSparqlStore(graph *rdf2go.Graph) *sparqlStore {
+	store := &sparqlStore{bySubject: map[string][]*rdf2go.Triple{}, byPredicate: map[string][]*rdf2go.Triple{}}
+	for triple := range graph.IterTriples() {
+		store.all = append(store.all, triple)
+		store.bySubject[triple.Subject.String()] = append(store.bySubject[triple.Subject.String()], triple)
+		store.byPredicate[triple.Predicate.String()] = append(store.byPredicate[triple.Predicate.String()], triple)
+	}
+	return store
+}
+
+// match extends the binding with the triples matching the pattern.
+func (s *sparqlStore) match(pattern sparqlPattern, binding sparqlBinding) iter.Seq[sparqlBinding] {
+	resolve := func(node sparqlNode) rdf2go.Term {
+		if node.Var != "" {
+			return binding[node.Var]
+		}
+		return node.Term
+	}
+	subject, predicate, object := resolve(pattern.Subject), resolve(pattern.Predicate), resolve(pattern.Object)
+	candidates := s.all
+	if subject != nil {
+		candidates = s.bySubject[subject.String()]
+	} else if predicate != nil {
+		candidates = s.byPredicate[predicate.String()]
+	}
+
+	return func(yield func(sparqlBinding) bool) {
+		for _, triple := range candidates {
+			extended := sparqlBinding{}
+			ok := true
+			for _, pair := range []struct {
+				node  sparqlNode
+				bound rdf2go.Term
+				term  rdf2go.Term
+			}{
+				{pattern.Subject, subject, triple.Subject},
+				{pattern.Predicate, predicate, triple.Predicate},
+				{pattern.Object, object, triple.Object},
+			} {
+				if pair.bound != nil {
+					ok = ok && pair.bound.Equal(pair.term)
+				} else if previous, seen := extended[pair.node.Var]; seen {
+					// the same variable twice in the pattern
+					ok = ok && previous.Equal(pair.term)
+				} else {
+					extended[pair.node.Var] = pair.term
+				}
+			}
+			if !ok {
+				continue
+			}
+			for name, term := range binding {
+				extended[name] = term
+			}
+			if !yield(extended) {
+				return
+			}
+		}
+	}
+}
+
+// evaluate runs the query, returning the projected variables and rows.
+// Without ORDER BY it stops once OFFSET and LIMIT are satisfied.
+func (s *sparqlStore) evaluate(ctx context.Context, q *sparqlQuery) ([]string, []sparqlBinding, error) {
+	vars := q.Vars
+	if vars == nil {
+		seen := map[string]bool{}
+		for _, pattern := range q.Patterns {
+			for _, node := range []sparqlNode{pattern.Subject, pattern.Predicate, pattern.Object} {
+				if node.Var != "" && !seen[node.Var] {
+					seen[node.Var] = true
+					vars = append(vars, node.Var)
+				}
+			}
+		}
+	}
+
+	// add projects a solution to a row and applies DISTINCT, OFFSET and
+	// LIMIT, false once no more rows are needed
+	rows := []sparqlBinding{}
+	seen := map[string]bool{}
+	skipped := 0
+	add := func(binding sparqlBinding) bool {
+		row := sparqlBinding{}
+		var key strings.Builder
+		for _, name := range vars {
+			if term := binding[name]; term != nil {
+				row[name] = term
+				key.WriteString(term.String())
+			}
+			key.WriteByte(0)
+		}
+		if q.Distinct {
+			if seen[key.String()] {
+				return true
+			}
+			seen[key.String()] = true
+		}
+		if skipped < q.Offset {
+			skipped++
+			return true
+		}
+		rows = append(rows, row)
+		return q.Limit < 0 || len(rows) < q.Limit
+	}
+	if q.Limit == 0 {
+		return vars, rows, nil
+	}
+
+	// solutions are only collected to be sorted, rows are added right away
+	// without ORDER BY
+	var solutions []sparqlBinding
+	count, steps := 0, 0
+	var err error
+	var join func(i int, binding sparqlBinding) bool
+	join = func(i int, binding sparqlBinding) bool {
+		if steps++; steps%1024 == 0 {
+			if err = ctx.Err(); err != nil {
+				return false
+			}
+		}
+		if i < len(q.Patterns) {
+			for extended := range s.match(q.Patterns[i], binding) {
+				if !join(i+1, extended) {
+					return false
+				}
+			}
+			return true
+		}
+		for _, filter := range q.Filters {
+			if !sparqlTrue(filter(binding)) {
+				return true
+			}
+		}
+		if count++; count > sparqlMaxSolutions {
+			err = errSparqlTooManySolutions
+			return false
+		}
+		if len(q.Order) > 0 {
+			solutions = append(solutions, binding)
+			return true
+		}
+		return add(binding)
+	}
+	join(0, sparqlBinding{})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(q.Order) > 0 {
+		sort.SliceStable(solutions, func(i, j int) bool {
+			for _, order := range q.Order {
+				a, b := order.Expr(solutions[i]), order.Expr(solutions[j])
+				c, ok := compareSparqlTerms(a, b)
+				if !ok {
+					// unbound values first, then by their lexical form
+					c = cmp.Compare(sparqlSortKey(a), sparqlSortKey(b))
+				}
+				if order.Desc {
+					c = -c
+				}
+				if c != 0 {
+					return c < 0
+				}
+			}
+			return false
+		})
+		for _, binding := range solutions {
+			if !add(binding) {
+				break
+			}
+		}
+	}
+	return vars, rows, nil
+}
+
+func sparqlSortKey(term rdf2go.Term) string {
+	if term == nil {
+		return ""
+	}
+	return "\x01" + term.String()
+}
+
+// sparqlResultTerm encodes a term in the SPARQL JSON results format.
+func sparqlResultTerm(term rdf2go.Term) map[string]string {
+	switch term := term.(type) {
+	case *rdf2go.Resource:
+		return map[string]string{"type": "uri", "value": term.URI}
+	case *rdf2go.Literal:
+		result := map[string]string{"type": "literal", "value": term.Value}
+		if term.Language != "" {
+			result["xml:lang"] = term.Language
+		} else if term.Datatype != nil {
+			result["datatype"] = term.Datatype.RawValue()
+		}
+		return result
+	}
+	return map[string]string{"type": "bnode", "value": term.RawValue()}
+}
+
+// sparqlGraph builds the graph of all sensors with their latest readings.
+func sparqlGraph() (*rdf2go.Graph, error) {
+	graph := rdf2go.NewGraph(rdfSensorBase)
+	macs := make([]string, 0, len(configMap))
+	for mac := range configMap {
+		macs = append(macs, mac)
+	}
+	sort.Strings(macs)
+	for _, mac := range macs {
+		config := configMap[mac]
+		readings, err := latestReadings(config, sparqlReadings)
+		if err != nil {
+			return nil, err
+		}
+		graph.Merge(historyGraph(&SensorHistory{Mac: mac, Loc: config.Loc, Readings: readings}))
+	}
+	return graph, nil
+}
+
+// sparqlHandler is a SPARQL protocol endpoint for SELECT queries, passed
+// as query parameter or, with POST, as form value or request body.
+func sparqlHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query().Get("query")
+	if r.Method == http.MethodPost {
+		if strings.HasPrefix(r.Header.Get("Content-Type"), "application/sparql-query") {
+			body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+			if err != nil {
+				http.Error(w, "invalid request body", http.StatusBadRequest)
+				return
+			}
+			query = string(body)
+		} else {
+			query = r.PostFormValue("query")
+		}
+	}
+	if query == "" {
+		http.Error(w, "missing query", http.StatusBadRequest)
+		return
+	}
+	q, err := parseSparql(query)
+	if err != nil {
+		http.Error(w, "invalid query: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	graph, err := sparqlGraph()
+	if err != nil {
+		exportError(w, err)
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), sparqlTimeout)
+	defer cancel()
+	vars, rows, err := newSparqlStore(graph).evaluate(ctx, q)
+	switch {
+	case errors.Is(err, errSparqlTooManySolutions):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case errors.Is(err, context.DeadlineExceeded):
+		http.Error(w, fmt.Sprintf("query took longer than %v", sparqlTimeout), http.StatusServiceUnavailable)
+		return
+	case err != nil:
+		// the client is gone
+		return
+	}
+
+	bindings := []any{}
+	for _, row := range rows {
+		result := map[string]any{}
+		for name, term := range row {
+			result[name] = sparqlResultTerm(term)
+		}
+		bindings = append(bindings, result)
+	}
+	writeJSON(w, "application/sparql-results+json", map[string]any{
+		"head":    map[string]any{"vars": vars},
+		"results": map[string]any{"bindings": bindings},
+	})
+}
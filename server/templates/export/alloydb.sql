@@ -0,0 +1,13 @@
+-- AlloyDB import of Mijia sensor {{ .Loc }} ({{ .Mac }})
+--   psql -h <instance ip> -U postgres -d mijia -f alloydb.sql
+-- or imported from Cloud Storage by alloydb_setup.sh. The columnar engine
+-- has to be enabled by the google_columnar_engine.enabled flag.
+
+CREATE EXTENSION IF NOT EXISTS google_columnar_engine;
+
+{{ template "postgresql_ddl" . }}
+
+{{ template "postgresql_copy" . }}
+
+-- keep the readings in the column store for analytical queries
+SELECT google_columnar_engine_add('sensor_data');
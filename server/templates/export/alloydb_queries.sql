@@ -0,0 +1,21 @@
+-- Analytical queries on the readings of Mijia sensor {{ .Loc }} ({{ .Mac }})
+-- using the AlloyDB columnar engine, also with AlloyDB Omni.
+
+SET google_columnar_engine.enable_columnar_scan = on;
+
+-- the hint needs the pg_hint_plan extension
+/*+ ColumnarScan(sensor_data) */
+SELECT
+    date_trunc('day', timestamp) AS day,
+    round(avg(temp), 2) AS avg_temp,
+    min(temp) AS min_temp,
+    max(temp) AS max_temp,
+    round(avg(humidity), 2) AS avg_humidity
+FROM sensor_data
+WHERE mac = {{ sqlquote .Mac }}
+GROUP BY 1
+ORDER BY 1;
+
+-- shows whether the columnar engine was used
+EXPLAIN (ANALYZE, COLUMNAR_ENGINE)
+SELECT avg(temp) FROM sensor_data WHERE mac = {{ sqlquote .Mac }};
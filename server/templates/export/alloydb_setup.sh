@@ -0,0 +1,21 @@
+#!/bin/sh
+# Creates an AlloyDB cluster and imports the history of Mijia sensor
+# {{ .Loc }} ({{ .Mac }}) from alloydb.sql through Cloud Storage.
+# Requires: gcloud, gsutil and a database mijia in the cluster
+set -e
+REGION="${REGION:-europe-west3}"
+CLUSTER="${CLUSTER:-mijia}"
+NETWORK="${NETWORK:-default}"
+BUCKET="${BUCKET:?Cloud Storage bucket for the import}"
+PASSWORD="${PASSWORD:?password of the postgres user}"
+
+gcloud alloydb clusters create "$CLUSTER" \
+    --region="$REGION" --network="$NETWORK" --password="$PASSWORD"
+gcloud alloydb instances create "$CLUSTER-primary" \
+    --cluster="$CLUSTER" --region="$REGION" --instance-type=PRIMARY --cpu-count=2 \
+    --database-flags=google_columnar_engine.enabled=on
+
+gsutil cp alloydb.sql "gs://$BUCKET/{{ .Name }}.alloydb.sql"
+gcloud alloydb clusters import "$CLUSTER" \
+    --region="$REGION" --database=mijia --user=postgres \
+    --gcs-uri="gs://$BUCKET/{{ .Name }}.alloydb.sql" --sql
@@ -0,0 +1,42 @@
+# Fetches the history of Mijia sensor {{ .Loc }} ({{ .Mac }}) from the
+# Arrow Flight server of the Mijia server as Arrow table.
+#   pip install pyarrow
+#   python {{ .Name }}.flight.py [from] [to]
+# from and to are optional RFC 3339 timestamps like 2024-01-01T00:00:00Z.
+import json
+import sys
+
+import pyarrow.compute as pc
+import pyarrow.flight as flight
+
+FLIGHT_URL = {{ quote .FlightURL }}
+MAC = {{ quote .Mac }}
+
+client = flight.connect(FLIGHT_URL)
+
+# the flight of a sensor is described by its MAC as path
+info = client.get_flight_info(flight.FlightDescriptor.for_path(MAC))
+print(f"{info.total_records} readings, schema:")
+print(info.schema)
+
+ticket = info.endpoints[0].ticket
+if len(sys.argv) > 1:
+    # tickets are JSON, from and to limit the readings
+    selection = json.loads(ticket.ticket)
+    selection["from"] = sys.argv[1]
+    if len(sys.argv) > 2:
+        selection["to"] = sys.argv[2]
+    ticket = flight.Ticket(json.dumps(selection).encode())
+
+# the record batches are streamed in the Arrow IPC format
+reader = client.do_get(ticket)
+table = reader.read_all()
+print(f"{table.num_rows} readings in {len(table.to_batches())} record batches")
+if table.num_rows:
+    for column in ("temp", "humidity"):
+        stats = pc.min_max(table[column])
+        print(f"{column}: min {stats['min']}, max {stats['max']}, mean {pc.mean(table[column]).as_py():.2f}")
+
+# other sensors of the server
+for other in client.list_flights():
+    print("flight", other.descriptor.path[0].decode(), other.total_records, "readings")
@@ -0,0 +1,28 @@
+-- Aurora MySQL import of Mijia sensor {{ .Loc }} ({{ .Mac }})
+--
+-- Stage the CSV export in S3 first:
+--   curl {{ .CSVURL }} | aws s3 cp - {{ .S3Prefix }}{{ .Name }}.csv
+-- The cluster needs the IAM role of aurora_iam_policy.json in its
+-- aurora_load_from_s3_role parameter, see aurora_cloudformation.yaml, and
+-- the user the AWS_LOAD_S3_ACCESS role (GRANT AWS_LOAD_S3_ACCESS TO ...).
+-- Timestamps are in UTC.
+
+CREATE TABLE IF NOT EXISTS sensor_data (
+    mac CHAR(17) NOT NULL,
+    timestamp DATETIME NOT NULL,
+    temp DECIMAL(5,2) NOT NULL,
+    humidity DECIMAL(5,2) NOT NULL,
+    battery_mv SMALLINT NOT NULL,
+    battery_level TINYINT NOT NULL,
+    PRIMARY KEY (mac, timestamp)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+-- readings imported before are skipped
+LOAD DATA FROM S3 {{ sqlquote (print .S3Prefix .Name ".csv") }}
+IGNORE INTO TABLE sensor_data
+FIELDS TERMINATED BY ','
+LINES TERMINATED BY '\n'
+IGNORE 1 LINES
+(@timestamp, temp, humidity, battery_mv, battery_level)
+SET mac = {{ sqlquote .Mac }},
+    timestamp = STR_TO_DATE(@timestamp, '%Y-%m-%dT%H:%i:%sZ');
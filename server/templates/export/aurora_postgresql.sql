@@ -0,0 +1,32 @@
+-- Aurora PostgreSQL import of Mijia sensor {{ .Loc }} ({{ .Mac }})
+--
+-- Stage the CSV export in S3 first:
+--   curl {{ .CSVURL }} | aws s3 cp - {{ .S3Prefix }}{{ .Name }}.csv
+-- The IAM role of aurora_iam_policy.json has to be added to the cluster
+-- for the s3Import feature:
+--   aws rds add-role-to-db-cluster --db-cluster-identifier <cluster> --feature-name s3Import --role-arn <role arn>
+
+CREATE EXTENSION IF NOT EXISTS aws_s3 CASCADE;
+
+{{ template "postgresql_ddl" . }}
+
+-- the export has no mac column, import into a staging table first
+CREATE TEMP TABLE sensor_data_import (
+    timestamp TIMESTAMP WITH TIME ZONE,
+    temp NUMERIC(5,2),
+    humidity NUMERIC(5,2),
+    battery_mv SMALLINT,
+    battery_level SMALLINT
+);
+
+SELECT aws_s3.table_import_from_s3(
+    'sensor_data_import',
+    'timestamp, temp, humidity, battery_mv, battery_level',
+    '(FORMAT csv, HEADER true)',
+    aws_commons.create_s3_uri({{ sqlquote .Bucket }}, {{ sqlquote .Key }}, {{ sqlquote .Region }})
+);
+
+INSERT INTO sensor_data (mac, timestamp, temp, humidity, battery_mv, battery_level)
+SELECT {{ sqlquote .Mac }}, timestamp, temp, humidity, battery_mv, battery_level
+FROM sensor_data_import
+ON CONFLICT (mac, timestamp) DO NOTHING;
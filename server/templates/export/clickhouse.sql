@@ -0,0 +1,21 @@
+-- ClickHouse import of Mijia sensor {{ .Loc }} ({{ .Mac }})
+-- clickhouse-client --multiquery < clickhouse.sql
+
+CREATE TABLE IF NOT EXISTS sensor_data
+(
+    mac LowCardinality(String),
+    timestamp DateTime('UTC'),
+    temp Float32,
+    humidity Float32,
+    battery_mv Int16,
+    battery_level UInt8
+)
+ENGINE = MergeTree
+PARTITION BY toYYYYMM(timestamp)
+ORDER BY timestamp;
+{{ range batch .Readings 10000 }}
+INSERT INTO sensor_data (mac, timestamp, temp, humidity, battery_mv, battery_level) VALUES
+{{- range $i, $r := . }}{{ if $i }},{{ end }}
+({{ sqlquote $.Mac }}, '{{ $r.Timestamp.Format "2006-01-02 15:04:05" }}', {{ $r.Temp }}, {{ $r.Humidity }}, {{ $r.BatteryMV }}, {{ $r.BatteryLevel }})
+{{- end }};
+{{ end -}}
@@ -0,0 +1,7 @@
+#!/bin/sh
+# Bulk insert of Mijia sensor {{ .Loc }} ({{ .Mac }}) via the ClickHouse
+# HTTP interface, create the table with the DDL of clickhouse.sql first.
+CLICKHOUSE_URL="${CLICKHOUSE_URL:-http://localhost:8123}"
+
+curl --fail --data-binary @sensor_data.jsonl \
+    "$CLICKHOUSE_URL/?query=INSERT%20INTO%20sensor_data%20FORMAT%20JSONEachRow"
@@ -0,0 +1,32 @@
+-- CockroachDB import of Mijia sensor {{ .Loc }} ({{ .Mac }})
+--   cockroach sql --url "postgresql://root@localhost:26257/mijia" -f {{ .Name }}.cockroachdb.sql
+
+-- Rows expire after {{ .TTL }} by row level TTL. The table is list partitioned
+-- by mac, the partition can be pinned to a region with a zone config:
+--   ALTER PARTITION {{ .Name }} OF TABLE sensor_data CONFIGURE ZONE USING constraints = '[+region=eu-west-1]';
+-- When the table exists already, add the sensor by repartitioning it with
+-- ALTER TABLE sensor_data PARTITION BY LIST (mac) (...) listing all sensors.
+CREATE TABLE IF NOT EXISTS sensor_data (
+    mac VARCHAR(17) NOT NULL,
+    timestamp TIMESTAMPTZ NOT NULL,
+    temp DECIMAL(5,2) NOT NULL,
+    humidity DECIMAL(5,2) NOT NULL,
+    battery_mv INT2 NOT NULL,
+    battery_level INT2 NOT NULL,
+    PRIMARY KEY (mac, timestamp)
+) PARTITION BY LIST (mac) (
+    PARTITION {{ .Name }} VALUES IN ({{ sqlquote .Mac }}),
+    PARTITION other VALUES IN (DEFAULT)
+) WITH (ttl_expiration_expression = {{ sqlquote (printf "timestamp + INTERVAL %s" (sqlquote .TTL)) }});
+
+CREATE INDEX IF NOT EXISTS sensor_data_timestamp_idx ON sensor_data (timestamp);
+
+-- IMPORT INTO takes the table offline during the import and fails on
+-- readings imported before, use the from parameter of the CSV export to
+-- only get new readings. The CSV has no mac column, it is filled with a
+-- column default set for the import.
+ALTER TABLE sensor_data ALTER COLUMN mac SET DEFAULT {{ sqlquote .Mac }};
+IMPORT INTO sensor_data (timestamp, temp, humidity, battery_mv, battery_level)
+    CSV DATA ({{ sqlquote .CSVURL }})
+    WITH skip = '1';
+ALTER TABLE sensor_data ALTER COLUMN mac DROP DEFAULT;
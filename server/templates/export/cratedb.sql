@@ -0,0 +1,36 @@
+-- CrateDB import of Mijia sensor {{ .Loc }} ({{ .Mac }})
+-- crash --hosts localhost:4200 < {{ .Name }}.cratedb.sql
+
+CREATE TABLE IF NOT EXISTS sensors.sensor_data (
+    mac TEXT,
+    loc TEXT,
+    timestamp TIMESTAMP WITH TIME ZONE,
+    temp REAL,
+    humidity REAL,
+    battery_mv SMALLINT,
+    battery_level BYTE
+) CLUSTERED BY (mac) INTO 3 SHARDS WITH (number_of_replicas = 1);
+{{ range batch .Readings 1000 }}
+INSERT INTO sensors.sensor_data (mac, loc, timestamp, temp, humidity, battery_mv, battery_level) VALUES
+{{- range $i, $r := . }}{{ if $i }},{{ end }}
+({{ sqlquote $.Mac }}, {{ sqlquote $.Loc }}, '{{ $r.Timestamp.Format "2006-01-02T15:04:05Z07:00" }}', {{ $r.Temp }}, {{ $r.Humidity }}, {{ $r.BatteryMV }}, {{ $r.BatteryLevel }})
+{{- end }};
+{{ end }}
+REFRESH TABLE sensors.sensor_data;
+
+-- Bulk loading instead of the INSERTs: COPY FROM fetches the CSV export,
+-- which has no mac and loc columns, into a staging table first.
+--
+-- CREATE TABLE IF NOT EXISTS sensors.sensor_data_import (
+--     timestamp TIMESTAMP WITH TIME ZONE,
+--     temp REAL,
+--     humidity REAL,
+--     battery_mv SMALLINT,
+--     battery_level BYTE
+-- );
+-- COPY sensors.sensor_data_import FROM {{ sqlquote .CSVURL }} WITH (format = 'csv');
+-- REFRESH TABLE sensors.sensor_data_import;
+-- INSERT INTO sensors.sensor_data (mac, loc, timestamp, temp, humidity, battery_mv, battery_level)
+-- SELECT {{ sqlquote .Mac }}, {{ sqlquote .Loc }}, timestamp, temp, humidity, battery_mv, battery_level
+-- FROM sensors.sensor_data_import;
+-- DROP TABLE sensors.sensor_data_import;
@@ -0,0 +1,68 @@
+# Databricks notebook source
+# MAGIC %md
+# MAGIC # Mijia sensor {{ .Loc }}
+# MAGIC History of `{{ .Mac }}`, loaded from the CSV export of the Mijia server
+# MAGIC into the Delta table `{{ .Name }}` with hourly aggregations in `{{ .Name }}_hourly`.
+
+# COMMAND ----------
+
+import urllib.request
+
+CSV_URL = {{ quote .CSVURL }}
+CSV_PATH = "dbfs:/tmp/{{ .Name }}.csv"
+
+# Spark cannot read from HTTP directly, stage the export on DBFS first
+with urllib.request.urlopen(CSV_URL) as response:
+    dbutils.fs.put(CSV_PATH, response.read().decode("utf-8"), overwrite=True)
+
+# COMMAND ----------
+
+from pyspark.sql import functions as F
+
+raw = (
+    spark.read.format("csv")
+    .option("header", "true")
+    .load(CSV_PATH)
+)
+df = raw.select(
+    F.to_timestamp("timestamp").alias("timestamp"),
+    F.col("temp").cast("double").alias("temp"),
+    F.col("humidity").cast("double").alias("humidity"),
+    F.col("battery_mv").cast("smallint").alias("battery_mv"),
+    F.col("battery_level").cast("tinyint").alias("battery_level"),
+)
+display(df)
+
+# COMMAND ----------
+
+hourly = (
+    df.groupBy(F.window("timestamp", "1 hour"))
+    .agg(
+        F.avg("temp").alias("avg_temp"),
+        F.min("temp").alias("min_temp"),
+        F.max("temp").alias("max_temp"),
+        F.avg("humidity").alias("avg_humidity"),
+        F.count("*").alias("readings"),
+    )
+    .select(
+        F.col("window.start").alias("window_start"),
+        F.col("window.end").alias("window_end"),
+        "avg_temp",
+        "min_temp",
+        "max_temp",
+        "avg_humidity",
+        "readings",
+    )
+    .orderBy("window_start")
+)
+display(hourly)
+
+# COMMAND ----------
+
+df.write.format("delta").mode("overwrite").saveAsTable("{{ .Name }}")
+hourly.write.format("delta").mode("overwrite").saveAsTable("{{ .Name }}_hourly")
+
+# COMMAND ----------
+
+# MAGIC %sql
+# MAGIC SELECT * FROM {{ .Name }}_hourly ORDER BY window_start DESC
@@ -0,0 +1,74 @@
+#!/bin/sh
+# Replicates the history of Mijia sensor {{ .Loc }} ({{ .Mac }}) into
+# BigQuery with Google Cloud Datastream.
+#
+# Datastream has no SQLite source, so the readings of the sensor database
+# are loaded into a MySQL staging database with the MySQL export, which
+# Datastream then replicates. Run the load again (e.g. by cron) to stream
+# new readings, already loaded ones are skipped by INSERT IGNORE.
+# Requires: gcloud, mysql, curl
+set -e
+PROJECT="${PROJECT:-$(gcloud config get-value project)}"
+REGION="${REGION:-europe-west3}"
+MYSQL_HOST="${MYSQL_HOST:?MySQL host reachable by Datastream}"
+MYSQL_USER="${MYSQL_USER:-datastream}"
+MYSQL_PASSWORD="${MYSQL_PASSWORD:?}"
+DATASET="${DATASET:-mijia}"
+
+curl --fail --silent {{ shellquote .MySQLURL }} \
+    | mysql -h "$MYSQL_HOST" -u "$MYSQL_USER" -p"$MYSQL_PASSWORD" mijia
+
+# Schema profile of sensor_data, the SQLite columns of the logger map to
+# the MySQL staging and Datastream data types:
+#   timestamp      DATETIME (UTC)      -> DATETIME          -> BigQuery DATETIME
+#   temp           INTEGER (c°C)       -> DECIMAL(5,2) °C   -> BigQuery NUMERIC
+#   humidity       INTEGER (c%)        -> DECIMAL(5,2) %    -> BigQuery NUMERIC
+#   battery_mv     INTEGER             -> SMALLINT          -> BigQuery INT64
+#   battery_level  INTEGER             -> TINYINT           -> BigQuery INT64
+#   (mac)          database file name  -> CHAR(17)          -> BigQuery STRING
+cat > datastream_source.json <<'JSON'
+{
+  "includeObjects": {
+    "mysqlDatabases": [
+      {
+        "database": "mijia",
+        "mysqlTables": [
+          {
+            "table": "sensor_data",
+            "mysqlColumns": [
+              {"column": "mac", "dataType": "CHAR", "length": 17, "primaryKey": true, "nullable": false, "ordinalPosition": 1},
+              {"column": "timestamp", "dataType": "DATETIME", "primaryKey": true, "nullable": false, "ordinalPosition": 2},
+              {"column": "temp", "dataType": "DECIMAL", "precision": 5, "scale": 2, "nullable": false, "ordinalPosition": 3},
+              {"column": "humidity", "dataType": "DECIMAL", "precision": 5, "scale": 2, "nullable": false, "ordinalPosition": 4},
+              {"column": "battery_mv", "dataType": "SMALLINT", "nullable": false, "ordinalPosition": 5},
+              {"column": "battery_level", "dataType": "TINYINT", "nullable": false, "ordinalPosition": 6}
+            ]
+          }
+        ]
+      }
+    ]
+  }
+}
+JSON
+
+cat > datastream_destination.json <<JSON
+{
+  "singleTargetDataset": {"datasetId": "$PROJECT:$DATASET"},
+  "dataFreshness": "900s"
+}
+JSON
+
+gcloud datastream connection-profiles create mijia-mysql \
+    --location="$REGION" --type=mysql --display-name="Mijia MySQL staging" \
+    --mysql-hostname="$MYSQL_HOST" --mysql-port=3306 \
+    --mysql-username="$MYSQL_USER" --mysql-password="$MYSQL_PASSWORD" \
+    --static-ip-connectivity
+
+gcloud datastream connection-profiles create mijia-bigquery \
+    --location="$REGION" --type=bigquery --display-name="Mijia BigQuery"
+
+gcloud datastream streams create {{ .StreamID }} \
+    --location="$REGION" --display-name={{ shellquote (printf "Mijia %s" .Loc) }} \
+    --source=mijia-mysql --mysql-source-config=datastream_source.json \
+    --destination=mijia-bigquery --bigquery-destination-config=datastream_destination.json \
+    --backfill-all
@@ -0,0 +1,22 @@
+-- Db2 import of Mijia sensor {{ .Loc }} ({{ .Mac }})
+-- db2 -tvf db2.sql, from the directory of sensor_data.del
+-- Timestamps are in UTC.
+
+CONNECT TO MIJIA;
+
+CREATE TABLE SENSOR_DATA (
+    MAC VARCHAR(17) NOT NULL,
+    TIMESTAMP TIMESTAMP(0) NOT NULL,
+    TEMP DECIMAL(5,2) NOT NULL,
+    HUMIDITY DECIMAL(5,2) NOT NULL,
+    BATTERY_MV SMALLINT NOT NULL,
+    BATTERY_LEVEL SMALLINT NOT NULL,
+    PRIMARY KEY (MAC, TIMESTAMP)
+) COMPRESS YES ORGANIZE BY ROW;
+
+-- readings loaded before are rejected as duplicates of the primary key
+LOAD FROM sensor_data.del OF DEL
+    MODIFIED BY timestampformat="YYYY-MM-DD HH:MM:SS"
+    INSERT INTO SENSOR_DATA (MAC, TIMESTAMP, TEMP, HUMIDITY, BATTERY_MV, BATTERY_LEVEL);
+
+CONNECT RESET;
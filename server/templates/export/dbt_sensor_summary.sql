@@ -0,0 +1,12 @@
+-- Daily averages of Mijia sensor {{ .Loc }} ({{ .Mac }})
+select
+    date(timestamp) as day,
+    round(avg(temp) / 100.0, 2) as avg_temp,
+    round(min(temp) / 100.0, 2) as min_temp,
+    round(max(temp) / 100.0, 2) as max_temp,
+    round(avg(humidity) / 100.0, 2) as avg_humidity,
+    round(avg(battery_level), 0) as avg_battery_level,
+    count(*) as readings
+from {{ printf "{{ source('%s', 'sensor_data') }}" .Name }}
+group by date(timestamp)
+order by day
@@ -0,0 +1,26 @@
+#!/bin/sh
+# Creates the Kafka topics of the Debezium SQLite source connector of
+# Mijia sensor {{ .Loc }} ({{ .Mac }}) and registers the connector of
+# debezium_connector.json with Kafka Connect.
+# The debezium-connector-sqlite community connector has to be installed
+# in the plugin path of the Connect workers.
+set -e
+BOOTSTRAP_SERVERS="${BOOTSTRAP_SERVERS:-localhost:9092}"
+CONNECT_URL="${CONNECT_URL:-http://localhost:8083}"
+
+create_topic() {
+    topic="$1"
+    shift
+    kafka-topics.sh --bootstrap-server "$BOOTSTRAP_SERVERS" --create --if-not-exists \
+        --topic "$topic" --partitions 1 --replication-factor 1 "$@"
+}
+
+# heartbeats keep the offsets moving while no readings are logged
+create_topic {{ .HeartbeatTopic }} --config cleanup.policy=delete --config retention.ms=86400000
+# offsets and schema history are read completely on restart
+create_topic {{ .OffsetTopic }} --config cleanup.policy=compact
+create_topic {{ .SchemaHistoryTopic }} --config cleanup.policy=delete --config retention.ms=-1
+create_topic {{ .DataTopic }}
+
+curl --fail -X POST -H "Content-Type: application/json" \
+    --data @debezium_connector.json "$CONNECT_URL/connectors"
@@ -0,0 +1,29 @@
+#!/bin/sh
+# Imports the history of Mijia sensor {{ .Loc }} ({{ .Mac }}) into a Dolt
+# repository as one commit and pushes it.
+# DOLT_REMOTE is the repository, e.g. myorg/mijia on DoltHub.
+set -e
+DOLT_REMOTE="${DOLT_REMOTE:?Dolt repository to clone}"
+DIR="${DIR:-$(basename "$DOLT_REMOTE")}"
+
+if [ ! -d "$DIR/.dolt" ]; then
+    dolt clone "$DOLT_REMOTE" "$DIR"
+fi
+cd "$DIR"
+dolt pull origin
+
+# MySQL export, readings imported before are skipped by INSERT IGNORE
+dolt sql <<'SQL'
+{{ .SQL -}}
+SQL
+
+if [ -n "$(dolt diff --stat)" ]; then
+    dolt add sensor_data
+    dolt commit -m {{ shellquote .Message }}
+    dolt push origin
+else
+    echo "no new readings"
+fi
+
+# audit of the imports of this sensor
+dolt sql -q {{ shellquote (printf "SELECT commit_hash, committer, date, message FROM dolt_log WHERE message = %s ORDER BY date DESC" (sqlquote .Message)) }}
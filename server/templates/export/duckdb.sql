@@ -0,0 +1,28 @@
+-- DuckDB import of Mijia sensor {{ .Loc }} ({{ .Mac }})
+-- duckdb {{ .Name }}.duckdb < {{ .Name }}.duckdb.sql
+
+INSTALL httpfs;
+LOAD httpfs;
+
+CREATE OR REPLACE TABLE sensor_data AS
+SELECT {{ sqlquote .Mac }} AS mac, *
+FROM read_csv_auto({{ sqlquote .CSVURL }}, header = true);
+
+DESCRIBE sensor_data;
+
+CREATE OR REPLACE TABLE sensor_daily AS
+SELECT
+    mac,
+    CAST(timestamp AS DATE) AS day,
+    round(avg(temp), 2) AS avg_temp,
+    min(temp) AS min_temp,
+    max(temp) AS max_temp,
+    round(avg(humidity), 2) AS avg_humidity,
+    count(*) AS readings
+FROM sensor_data
+GROUP BY ALL
+ORDER BY day;
+
+SELECT * FROM sensor_daily;
+
+COPY sensor_data TO '{{ .Name }}.parquet' (FORMAT PARQUET);
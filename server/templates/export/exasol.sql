@@ -0,0 +1,38 @@
+-- Exasol import of Mijia sensor {{ .Loc }} ({{ .Mac }})
+-- exaplus -c localhost:8563 -u sys -f {{ .Name }}.exasol.sql
+-- Timestamps are in UTC.
+
+CREATE SCHEMA IF NOT EXISTS mijia;
+OPEN SCHEMA mijia;
+
+-- Exasol partitions by the values of a column, not by an expression like
+-- MONTHS(timestamp), the ranges are formed automatically
+CREATE TABLE IF NOT EXISTS sensor_data (
+    mac VARCHAR(17) NOT NULL,
+    "timestamp" TIMESTAMP NOT NULL,
+    temp DECIMAL(5,2) NOT NULL,
+    humidity DECIMAL(5,2) NOT NULL,
+    battery_mv SMALLINT NOT NULL,
+    battery_level SMALLINT NOT NULL,
+    DISTRIBUTE BY mac,
+    PARTITION BY "timestamp"
+);
+
+-- the history resources of the sensor, the database fetches the CSV
+-- export itself over HTTP
+CREATE OR REPLACE CONNECTION {{ .Name }}_http TO {{ sqlquote .HistoryURL }};
+
+INSERT INTO sensor_data (mac, "timestamp", temp, humidity, battery_mv, battery_level)
+SELECT
+    {{ sqlquote .Mac }},
+    TO_TIMESTAMP(REPLACE(REPLACE(t.ts, 'T', ' '), 'Z', ''), 'YYYY-MM-DD HH24:MI:SS'),
+    t.temp,
+    t.humidity,
+    t.battery_mv,
+    t.battery_level
+FROM (
+    IMPORT INTO (ts VARCHAR(25), temp DECIMAL(5,2), humidity DECIMAL(5,2), battery_mv SMALLINT, battery_level SMALLINT)
+    FROM CSV AT {{ .Name }}_http FILE 'export.csv'
+    COLUMN SEPARATOR = ','
+    SKIP = 1
+) t;
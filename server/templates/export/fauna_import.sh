@@ -0,0 +1,19 @@
+#!/bin/sh
+# Imports the history of Mijia sensor {{ .Loc }} ({{ .Mac }}) into Fauna
+# with the Fauna CLI (npm install -g fauna-shell), authenticated by
+# FAUNA_SECRET or a fauna login:
+#
+#   FAUNA_DATABASE=us/mijia ./fauna_import.sh
+#
+# fauna.fsl defines the collection sensor_readings, batches/*.fql create
+# 50 readings each in one transaction. A batch fails as a whole when one
+# of its readings was imported before.
+set -e
+: "${FAUNA_DATABASE:?set FAUNA_DATABASE to the database path, like us/mijia}"
+
+fauna schema push --dir . --database "$FAUNA_DATABASE" --no-input --active
+
+for batch in batches/*.fql; do
+  echo "$batch"
+  fauna query --input "$batch" --database "$FAUNA_DATABASE"
+done
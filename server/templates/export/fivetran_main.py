@@ -0,0 +1,36 @@
+# Fivetran function syncing Mijia sensor {{ .Loc }} ({{ .Mac }})
+import json
+import urllib.parse
+import urllib.request
+
+HISTORY_URL = {{ quote .HistoryURL }}
+TABLE = {{ quote .Name }}
+PAGE_SIZE = 1000
+
+
+def handler(request, context=None):
+    state = request.get("state") or {}
+    params = {"page_size": PAGE_SIZE}
+    cursor = state.get("cursor")
+    if cursor:
+        # from is inclusive, the reading at the cursor is upserted again
+        params["from"] = cursor
+
+    url = HISTORY_URL + "?" + urllib.parse.urlencode(params)
+    with urllib.request.urlopen(url) as response:
+        readings = json.load(response)
+
+    if readings:
+        cursor = readings[-1]["timestamp"]
+
+    return {
+        "state": {"cursor": cursor},
+        "insert": {TABLE: readings},
+        "schema": {TABLE: {"primary_key": ["timestamp"]}},
+        "hasMore": len(readings) == PAGE_SIZE,
+    }
+
+
+# AWS Lambda entry point
+def lambda_handler(event, context):
+    return handler(event, context)
@@ -0,0 +1,41 @@
+-- Flink CDC job streaming the database of Mijia sensor {{ .Loc }} ({{ .Mac }})
+-- to Kafka, run with: sql-client.sh -f {{ .Name }}.flink-cdc.sql
+-- The sqlite-cdc connector and the Kafka SQL connector jars have to be in
+-- the lib directory of Flink. Columns are as stored by the logger, temp
+-- and humidity in hundredths.
+
+SET 'execution.runtime-mode' = 'streaming';
+SET 'execution.checkpointing.interval' = '60s';
+
+CREATE TABLE sensor_source (
+    id BIGINT,
+    `timestamp` TIMESTAMP(0),
+    temp INT,
+    humidity INT,
+    battery_mv INT,
+    battery_level INT,
+    PRIMARY KEY (id) NOT ENFORCED
+) WITH (
+    'connector' = 'sqlite-cdc',
+    'database-name' = {{ sqlquote .Database }},
+    'table-name' = 'sensor_data'
+);
+
+-- the CDC source is a changelog stream, so the sink has to be upsert-kafka
+CREATE TABLE kafka_sink (
+    id BIGINT,
+    `timestamp` TIMESTAMP(0),
+    temp INT,
+    humidity INT,
+    battery_mv INT,
+    battery_level INT,
+    PRIMARY KEY (id) NOT ENFORCED
+) WITH (
+    'connector' = 'upsert-kafka',
+    'topic' = {{ sqlquote .Topic }},
+    'properties.bootstrap.servers' = 'localhost:9092',
+    'key.format' = 'json',
+    'value.format' = 'json'
+);
+
+INSERT INTO kafka_sink SELECT * FROM sensor_source;
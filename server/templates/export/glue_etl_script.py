@@ -0,0 +1,50 @@
+# AWS Glue ETL job for Mijia sensor {{ .Loc }} ({{ .Mac }})
+# Reads the CSV export of the Mijia server and appends it as Parquet to the
+# location of the Glue table {{ .Name }}.
+import sys
+import urllib.request
+
+from awsglue.context import GlueContext
+from awsglue.job import Job
+from awsglue.utils import getResolvedOptions
+from pyspark.context import SparkContext
+from pyspark.sql.types import (
+    ByteType,
+    DoubleType,
+    ShortType,
+    StructField,
+    StructType,
+    TimestampType,
+)
+
+CSV_URL = {{ quote .CSVURL }}
+S3_PREFIX = {{ quote .S3Prefix }}
+
+SCHEMA = StructType([
+    StructField("timestamp", TimestampType(), False),
+    StructField("temp", DoubleType(), False),
+    StructField("humidity", DoubleType(), False),
+    StructField("battery_mv", ShortType(), False),
+    StructField("battery_level", ByteType(), False),
+])
+
+args = getResolvedOptions(sys.argv, ["JOB_NAME"])
+sc = SparkContext()
+glue_context = GlueContext(sc)
+spark = glue_context.spark_session
+job = Job(glue_context)
+job.init(args["JOB_NAME"], args)
+
+# Spark cannot read from HTTP directly, fetch the export on the driver
+with urllib.request.urlopen(CSV_URL) as response:
+    lines = response.read().decode("utf-8").splitlines()
+
+df = spark.read.csv(
+    sc.parallelize(lines),
+    header=True,
+    schema=SCHEMA,
+    timestampFormat="yyyy-MM-dd'T'HH:mm:ssXXX",
+)
+df.write.mode("append").parquet(S3_PREFIX)
+
+job.commit()
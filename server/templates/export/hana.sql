@@ -0,0 +1,44 @@
+-- SAP HANA import of Mijia sensor {{ .Loc }} ({{ .Mac }})
+-- hdbsql -n localhost:39015 -u SYSTEM -I hana.sql
+-- Sybase ASE is not covered as it is in maintenance only.
+-- Timestamps are in UTC.
+
+CREATE COLUMN TABLE sensor_data (
+    mac NVARCHAR(17) NOT NULL,
+    timestamp LONGDATE NOT NULL,
+    temp DECIMAL(5,2) NOT NULL,
+    humidity DECIMAL(5,2) NOT NULL,
+    battery_mv SMALLINT NOT NULL,
+    battery_level TINYINT NOT NULL,
+    PRIMARY KEY (mac, timestamp)
+)
+PARTITION BY RANGE (timestamp) (
+    PARTITION OTHERS DYNAMIC INTERVAL 1 MONTH
+);
+
+-- the CSV export has no mac column, it is imported into a staging table
+CREATE LOCAL TEMPORARY COLUMN TABLE #sensor_data_import (
+    timestamp LONGDATE,
+    temp DECIMAL(5,2),
+    humidity DECIMAL(5,2),
+    battery_mv SMALLINT,
+    battery_level TINYINT
+);
+
+-- curl -o /usr/sap/import/{{ .Name }}.csv {{ .CSVURL }}
+-- on SAP HANA Cloud, upload the file to object storage and import from
+-- its URL instead, e.g. 's3-eu-central-1://<key>:<secret>@<bucket>/{{ .Name }}.csv'
+IMPORT FROM CSV FILE '/usr/sap/import/{{ .Name }}.csv' INTO #sensor_data_import
+WITH
+    RECORD DELIMITED BY '\n'
+    FIELD DELIMITED BY ','
+    SKIP FIRST 1 ROW
+    TIMESTAMP FORMAT 'YYYY-MM-DD"T"HH24:MI:SS"Z"'
+    THREADS 4
+    ERROR LOG '/usr/sap/import/{{ .Name }}.err';
+
+UPSERT sensor_data (mac, timestamp, temp, humidity, battery_mv, battery_level)
+SELECT {{ sqlquote .Mac }}, timestamp, temp, humidity, battery_mv, battery_level
+FROM #sensor_data_import;
+
+DROP TABLE #sensor_data_import;
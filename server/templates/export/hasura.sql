@@ -0,0 +1,28 @@
+-- PostgreSQL import of Mijia sensor {{ .Loc }} ({{ .Mac }}) for Hasura
+--   psql "$HASURA_GRAPHQL_DATABASE_URL" -f hasura.sql
+--   hasura metadata apply
+--
+-- Next to the PostgreSQL export the sensor is stored in a sensors table,
+-- the foreign key of sensor_data on it is what the Hasura relationships
+-- sensor and readings are built on.
+
+CREATE TABLE IF NOT EXISTS sensors (
+    mac VARCHAR(17) PRIMARY KEY,
+    loc TEXT NOT NULL
+);
+
+INSERT INTO sensors (mac, loc) VALUES ({{ sqlquote .Mac }}, {{ sqlquote .Loc }})
+ON CONFLICT (mac) DO UPDATE SET loc = EXCLUDED.loc;
+
+{{ template "postgresql_ddl" . }}
+
+DO $$
+BEGIN
+    ALTER TABLE sensor_data ADD CONSTRAINT sensor_data_mac_fkey
+        FOREIGN KEY (mac) REFERENCES sensors (mac);
+EXCEPTION WHEN duplicate_object THEN
+    NULL;
+END
+$$;
+
+{{ template "postgresql_copy" . }}
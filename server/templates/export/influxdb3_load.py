@@ -0,0 +1,75 @@
+#!/usr/bin/env python3
+# Bulk loads the history of Mijia sensor {{ .Loc }} ({{ .Mac }}) into
+# InfluxDB 3 and reads it back over Arrow Flight.
+#
+# The readings are loaded as Arrow table from the CSV export and written
+# in record batches to the line protocol API, as the Flight SQL endpoint
+# of InfluxDB 3 only serves queries. The Flight client then verifies the
+# import with an SQL query returning Arrow data.
+# Requires: pip install pyarrow
+import json
+import os
+import urllib.request
+
+import pyarrow.csv as pv
+import pyarrow.flight as flight
+
+CSV_URL = {{ quote .CSVURL }}
+MAC = {{ quote .Mac }}
+LOC = {{ quote .Loc }}
+
+HOST = os.environ.get("INFLUX_HOST", "localhost:8181")
+DATABASE = os.environ.get("INFLUX_DATABASE", "mijia")
+TOKEN = os.environ.get("INFLUX_TOKEN", "")
+TLS = os.environ.get("INFLUX_TLS", "false") == "true"
+BATCH_SIZE = 10000
+
+
+def escape_tag(value):
+    return value.replace(",", "\\,").replace("=", "\\=").replace(" ", "\\ ")
+
+
+def write_batch(batch):
+    columns = batch.to_pydict()
+    lines = []
+    for i in range(batch.num_rows):
+        lines.append(
+            "sensor_data,mac=%s,loc=%s temp=%r,humidity=%r,battery_mv=%di,battery_level=%di %d"
+            % (
+                escape_tag(MAC),
+                escape_tag(LOC),
+                columns["temp"][i],
+                columns["humidity"][i],
+                columns["battery_mv"][i],
+                columns["battery_level"][i],
+                int(columns["timestamp"][i].timestamp() * 1_000_000_000),
+            )
+        )
+    scheme = "https" if TLS else "http"
+    request = urllib.request.Request(
+        f"{scheme}://{HOST}/api/v3/write_lp?db={DATABASE}&precision=nanosecond",
+        data="\n".join(lines).encode(),
+        method="POST",
+    )
+    if TOKEN:
+        request.add_header("Authorization", f"Bearer {TOKEN}")
+    urllib.request.urlopen(request).close()
+
+
+with urllib.request.urlopen(CSV_URL) as response:
+    table = pv.read_csv(response)
+
+for batch in table.to_batches(max_chunksize=BATCH_SIZE):
+    write_batch(batch)
+print(f"Wrote {table.num_rows} readings")
+
+client = flight.FlightClient(("grpc+tls://" if TLS else "grpc+tcp://") + HOST)
+options = flight.FlightCallOptions(
+    headers=[(b"authorization", f"Bearer {TOKEN}".encode())] if TOKEN else []
+)
+ticket = flight.Ticket(json.dumps({
+    "database": DATABASE,
+    "sql_query": f"SELECT count(*) AS readings FROM sensor_data WHERE mac = '{MAC}'",
+    "query_type": "sql",
+}).encode())
+print(client.do_get(ticket, options).read_all().to_pandas())
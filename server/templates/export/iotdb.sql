@@ -0,0 +1,14 @@
+-- Apache IoTDB import of Mijia sensor {{ .Loc }} ({{ .Mac }})
+--   start-cli.sh -e "$(cat {{ .Name }}.iotdb.sql)"
+-- or paste into the CLI. Timestamps are epoch milliseconds.
+
+SET STORAGE GROUP TO root.sensors.{{ .Name }};
+
+CREATE TIMESERIES root.sensors.{{ .Name }}.temp WITH DATATYPE=FLOAT, ENCODING=GORILLA, COMPRESSOR=SNAPPY;
+CREATE TIMESERIES root.sensors.{{ .Name }}.humidity WITH DATATYPE=FLOAT, ENCODING=GORILLA, COMPRESSOR=SNAPPY;
+CREATE TIMESERIES root.sensors.{{ .Name }}.battery_mv WITH DATATYPE=INT32, ENCODING=TS_2DIFF, COMPRESSOR=SNAPPY;
+CREATE TIMESERIES root.sensors.{{ .Name }}.battery_level WITH DATATYPE=INT32, ENCODING=RLE, COMPRESSOR=SNAPPY;
+{{ range batch .Readings 1000 }}
+INSERT INTO root.sensors.{{ $.Name }}(timestamp, temp, humidity, battery_mv, battery_level) VALUES
+{{- range $i, $r := . }}{{ if $i }},{{ end }} ({{ $r.Timestamp.UnixMilli }}, {{ $r.Temp }}, {{ $r.Humidity }}, {{ $r.BatteryMV }}, {{ $r.BatteryLevel }}){{ end }};
+{{ end -}}
@@ -0,0 +1,51 @@
+-- Materialize pipeline of Mijia sensor {{ .Loc }} ({{ .Mac }})
+-- psql "postgres://materialize@localhost:6875/materialize" -f {{ .Name }}.materialize.sql
+--
+-- The readings arrive over HTTP in a webhook source. Each element of a
+-- posted JSON array becomes a row, so the JSON history API can be fed in
+-- directly, e.g. by cron with a from parameter:
+--   curl -s '{{ .HistoryURL }}' | curl -X POST -H 'Content-Type: application/json' \
+--     --data-binary @- https://<materialize host>/api/webhook/materialize/public/{{ .Source }}
+
+CREATE SOURCE {{ .Source }} IN CLUSTER quickstart FROM WEBHOOK
+    BODY FORMAT JSON ARRAY;
+
+CREATE VIEW {{ .Name }}_readings AS
+SELECT
+    {{ sqlquote .Mac }} AS mac,
+    (body->>'timestamp')::timestamptz AS timestamp,
+    (body->>'temp')::float8 AS temp,
+    (body->>'humidity')::float8 AS humidity,
+    (body->>'battery_mv')::int AS battery_mv,
+    (body->>'battery_level')::int AS battery_level
+FROM {{ .Source }};
+
+-- hourly averages, kept up to date as readings arrive
+CREATE MATERIALIZED VIEW {{ .Name }}_hourly IN CLUSTER quickstart AS
+SELECT
+    mac,
+    date_trunc('hour', timestamp) AS hour,
+    avg(temp) AS avg_temp,
+    avg(humidity) AS avg_humidity,
+    count(*) AS readings
+FROM {{ .Name }}_readings
+GROUP BY mac, date_trunc('hour', timestamp);
+
+-- average over the last hour, readings drop out as time passes
+CREATE MATERIALIZED VIEW {{ .Name }}_last_hour IN CLUSTER quickstart AS
+SELECT mac, avg(temp) AS avg_temp, avg(humidity) AS avg_humidity
+FROM {{ .Name }}_readings
+WHERE mz_now() <= timestamp + INTERVAL '1 hour'
+GROUP BY mac;
+
+CREATE CONNECTION IF NOT EXISTS kafka_connection TO KAFKA (
+    BROKER 'localhost:9092',
+    SECURITY PROTOCOL = 'PLAINTEXT'
+);
+
+CREATE SINK {{ .Name }}_hourly_sink IN CLUSTER quickstart
+FROM {{ .Name }}_hourly
+INTO KAFKA CONNECTION kafka_connection (TOPIC 'sensors.{{ .Name }}.hourly')
+KEY (mac, hour)
+FORMAT JSON
+ENVELOPE UPSERT;
@@ -0,0 +1,32 @@
+#!/bin/sh
+# Backfills the history of Mijia sensor {{ .Loc }} ({{ .Mac }}) into
+# Grafana Mimir: creates a TSDB block from sensor_data.csv and uploads it
+# with the block upload API, which has to be enabled for the tenant
+# (compactor_block_upload_enabled). Requires Go and curl.
+set -e
+MIMIR_URL="${MIMIR_URL:-http://localhost:9009}"
+MIMIR_TENANT="${MIMIR_TENANT:-anonymous}"
+
+if [ ! -f go.mod ]; then
+    go mod init mijia_thanos_block
+    go get github.com/prometheus/prometheus@v0.54.1
+    go mod tidy
+fi
+BLOCK=$(go run thanos_block.go)
+ID=$(basename "$BLOCK")
+UPLOAD_URL="$MIMIR_URL/api/v1/upload/block/$ID"
+
+upload() {
+    curl --fail --silent --show-error -X POST \
+        -H "X-Scope-OrgID: $MIMIR_TENANT" "$@"
+}
+
+# meta.json with the Thanos section starts the upload, then the files
+# listed in it are sent before the upload is finished
+upload --data-binary @"$BLOCK/meta.json" "$UPLOAD_URL/start"
+upload --data-binary @"$BLOCK/index" "$UPLOAD_URL/files?path=index"
+for chunk in "$BLOCK"/chunks/*; do
+    upload --data-binary @"$chunk" "$UPLOAD_URL/files?path=chunks/$(basename "$chunk")"
+done
+upload "$UPLOAD_URL/finish"
+echo "uploaded block $ID"
@@ -0,0 +1,17 @@
+# Mijia sensor history for {{ .Loc }} ({{ .Mac }})
+import pandas as pd
+import matplotlib.pyplot as plt
+
+df = pd.read_json({{ quote .HistoryURL }})
+df["timestamp"] = pd.to_datetime(df["timestamp"])
+df = df.set_index("timestamp")
+
+fig, ax = plt.subplots(figsize=(12, 6))
+df["temp"].plot(ax=ax, color="tab:red", label="Temperature (°C)")
+ax.set_ylabel("Temperature (°C)")
+ax2 = ax.twinx()
+df["humidity"].plot(ax=ax2, color="tab:blue", label="Humidity (%)")
+ax2.set_ylabel("Humidity (%)")
+ax.set_title({{ quote .Loc }})
+fig.legend(loc="upper left")
+plt.show()
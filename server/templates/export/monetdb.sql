@@ -0,0 +1,22 @@
+-- MonetDB tables of Mijia sensor {{ .Loc }} ({{ .Mac }})
+-- mclient -d mijia monetdb.sql, then load with monetdb_import.sh
+-- Timestamps are in UTC.
+
+CREATE TABLE IF NOT EXISTS sensor_data (
+    mac VARCHAR(17) NOT NULL,
+    "timestamp" TIMESTAMP NOT NULL,
+    temp REAL NOT NULL,
+    humidity REAL NOT NULL,
+    battery_mv SMALLINT NOT NULL,
+    battery_level TINYINT NOT NULL,
+    PRIMARY KEY (mac, "timestamp")
+);
+
+-- the CSV export is copied as is, without mac and with ISO timestamps
+CREATE TABLE IF NOT EXISTS sensor_data_import (
+    ts VARCHAR(25),
+    temp REAL,
+    humidity REAL,
+    battery_mv SMALLINT,
+    battery_level TINYINT
+);
@@ -0,0 +1,21 @@
+#!/bin/sh
+# Loads the CSV export of Mijia sensor {{ .Loc }} ({{ .Mac }}) into
+# MonetDB, piped into COPY INTO ... FROM STDIN of mclient.
+# Create the tables with monetdb.sql first.
+set -e
+DATABASE="${DATABASE:-mijia}"
+
+mclient -d "$DATABASE" -s "DELETE FROM sensor_data_import"
+# OFFSET 2 skips the header line
+curl --fail --silent {{ shellquote .CSVURL }} \
+    | mclient -d "$DATABASE" -s "COPY OFFSET 2 INTO sensor_data_import FROM STDIN USING DELIMITERS ',', E'\\n'" -
+
+mclient -d "$DATABASE" -s "
+INSERT INTO sensor_data (mac, \"timestamp\", temp, humidity, battery_mv, battery_level)
+SELECT {{ sqlquote .Mac }}, str_to_timestamp(i.ts, '%Y-%m-%dT%H:%M:%SZ'), i.temp, i.humidity, i.battery_mv, i.battery_level
+FROM sensor_data_import i
+WHERE NOT EXISTS (
+    SELECT 1 FROM sensor_data d
+    WHERE d.mac = {{ sqlquote .Mac }} AND d.\"timestamp\" = str_to_timestamp(i.ts, '%Y-%m-%dT%H:%M:%SZ')
+);
+DELETE FROM sensor_data_import;"
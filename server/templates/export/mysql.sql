@@ -0,0 +1,26 @@
+-- MySQL import of Mijia sensor {{ .Loc }} ({{ .Mac }})
+-- mysql mijia < {{ .Name }}.mysql.sql
+-- Timestamps are in UTC.
+
+CREATE TABLE IF NOT EXISTS sensor_data (
+    mac CHAR(17) NOT NULL,
+    timestamp DATETIME NOT NULL,
+    temp DECIMAL(5,2) NOT NULL,
+    humidity DECIMAL(5,2) NOT NULL,
+    battery_mv SMALLINT NOT NULL,
+    battery_level TINYINT NOT NULL,
+    PRIMARY KEY (mac, timestamp)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+{{ range batch .Readings 100 }}
+INSERT {{ if not $.Upsert }}IGNORE {{ end }}INTO sensor_data (mac, timestamp, temp, humidity, battery_mv, battery_level) VALUES
+{{- range $i, $r := . }}{{ if $i }},{{ end }}
+({{ sqlquote $.Mac }}, '{{ $r.Timestamp.Format "2006-01-02 15:04:05" }}', {{ $r.Temp }}, {{ $r.Humidity }}, {{ $r.BatteryMV }}, {{ $r.BatteryLevel }})
+{{- end }}
+{{- if $.Upsert }}
+ON DUPLICATE KEY UPDATE
+    temp = VALUES(temp),
+    humidity = VALUES(humidity),
+    battery_mv = VALUES(battery_mv),
+    battery_level = VALUES(battery_level)
+{{- end }};
+{{ end -}}
@@ -0,0 +1,25 @@
+#!/bin/sh
+# Imports the history of Mijia sensor {{ .Loc }} ({{ .Mac }}) into a new
+# branch of a Neon project, so the import can be checked before it is
+# used. Neon branches carry no tags, the import timestamp is part of the
+# branch name.
+#
+# Requires the Neon CLI (npm i -g neonctl, then neon auth) and psql.
+# NEON_PROJECT_ID is the project, PARENT the branch to start from.
+set -e
+NEON_PROJECT_ID="${NEON_PROJECT_ID:?Neon project id}"
+PARENT="${PARENT:-main}"
+DATABASE="${DATABASE:-neondb}"
+BRANCH="import-{{ .Name }}-$(date -u +%Y%m%dT%H%M%SZ)"
+
+neon branches create --project-id "$NEON_PROJECT_ID" --parent "$PARENT" --name "$BRANCH"
+DATABASE_URL=$(neon connection-string "$BRANCH" --project-id "$NEON_PROJECT_ID" --database-name "$DATABASE")
+
+# PostgreSQL export, the readings in the COPY format of pg_dump
+psql "$DATABASE_URL" --set ON_ERROR_STOP=1 <<'SQL'
+{{ template "postgresql_ddl" . }}
+
+{{ template "postgresql_copy" . }}
+SQL
+
+echo "imported into branch $BRANCH"
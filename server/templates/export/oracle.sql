@@ -0,0 +1,20 @@
+-- Oracle import of Mijia sensor {{ .Loc }} ({{ .Mac }})
+-- sqlplus user/password@localhost/FREEPDB1 @oracle.sql
+-- sqlldr user/password@localhost/FREEPDB1 control=sensor_data.ctl
+-- Timestamps are in UTC.
+
+-- monthly partitions are created automatically by the interval
+CREATE TABLE sensor_data (
+    mac VARCHAR2(17) NOT NULL,
+    timestamp TIMESTAMP NOT NULL,
+    temp NUMBER(5,2) NOT NULL,
+    humidity NUMBER(5,2) NOT NULL,
+    battery_mv NUMBER(6) NOT NULL,
+    battery_level NUMBER(3) NOT NULL,
+    CONSTRAINT sensor_data_pk PRIMARY KEY (mac, timestamp)
+)
+TABLESPACE users
+PARTITION BY RANGE (timestamp) INTERVAL (NUMTOYMINTERVAL(1, 'MONTH'))
+(PARTITION sensor_data_start VALUES LESS THAN (TIMESTAMP '2000-01-01 00:00:00'));
+
+EXIT;
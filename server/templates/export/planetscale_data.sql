@@ -0,0 +1,8 @@
+-- Readings of Mijia sensor {{ .Loc }} ({{ .Mac }}), readings imported
+-- before are skipped
+{{ range batch .Readings 100 }}
+INSERT IGNORE INTO sensor_data (mac, timestamp, temp, humidity, battery_mv, battery_level) VALUES
+{{- range $i, $r := . }}{{ if $i }},{{ end }}
+({{ sqlquote $.Mac }}, '{{ $r.Timestamp.Format "2006-01-02 15:04:05" }}', {{ $r.Temp }}, {{ $r.Humidity }}, {{ $r.BatteryMV }}, {{ $r.BatteryLevel }})
+{{- end }};
+{{ end -}}
@@ -0,0 +1,20 @@
+#!/bin/sh
+# Creates the PlanetScale database of Mijia sensor {{ .Loc }} ({{ .Mac }}).
+# Production branches only take schema changes by deploy requests, so the
+# schema is applied to a development branch, deployed to main and the
+# readings are loaded afterwards. Requires pscale (pscale auth login).
+set -e
+DATABASE="${DATABASE:-mijia}"
+BRANCH="{{ .Name }}-schema"
+
+pscale database create "$DATABASE" --wait || true
+pscale branch create "$DATABASE" "$BRANCH" --wait
+pscale shell "$DATABASE" "$BRANCH" < planetscale_schema.sql
+# only for sharded keyspaces
+# pscale keyspace vschema update "$DATABASE" "$BRANCH" "$DATABASE" --vschema vschema.json
+
+pscale deploy-request create "$DATABASE" "$BRANCH" --into main
+NUMBER=$(pscale deploy-request list "$DATABASE" --format json | jq -r --arg branch "$BRANCH" '[.[] | select(.branch == $branch)][0].number')
+pscale deploy-request deploy "$DATABASE" "$NUMBER" --wait
+
+pscale shell "$DATABASE" main < planetscale_data.sql
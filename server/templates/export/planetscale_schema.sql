@@ -0,0 +1,16 @@
+-- PlanetScale schema of Mijia sensor {{ .Loc }} ({{ .Mac }}), applied to a
+-- development branch and deployed with a deploy request, see
+-- planetscale_deploy.sh. Timestamps are in UTC.
+
+-- In a sharded keyspace Vitess routes the rows by mac with the hash vindex
+-- of vschema.json, so all readings of a sensor live in one shard. The
+-- primary key starts with the sharding key for single shard lookups.
+CREATE TABLE sensor_data (
+    mac CHAR(17) NOT NULL,
+    timestamp DATETIME NOT NULL,
+    temp DECIMAL(5,2) NOT NULL,
+    humidity DECIMAL(5,2) NOT NULL,
+    battery_mv SMALLINT NOT NULL,
+    battery_level TINYINT NOT NULL,
+    PRIMARY KEY (mac, timestamp)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
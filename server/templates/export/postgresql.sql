@@ -0,0 +1,33 @@
+{{ define "postgresql_ddl" -}}
+CREATE TABLE IF NOT EXISTS sensor_data (
+    mac VARCHAR(17) NOT NULL,
+    timestamp TIMESTAMP WITH TIME ZONE NOT NULL,
+    temp NUMERIC(5,2) NOT NULL,
+    humidity NUMERIC(5,2) NOT NULL,
+    battery_mv SMALLINT NOT NULL,
+    battery_level SMALLINT NOT NULL,
+    PRIMARY KEY (mac, timestamp)
+);
+
+CREATE INDEX IF NOT EXISTS sensor_data_timestamp_idx ON sensor_data (timestamp);
+{{- end -}}
+
+{{- define "postgresql_copy" -}}
+-- COPY aborts on readings that were imported before, use the from
+-- parameter of the export to only get new readings.
+COPY sensor_data (mac, timestamp, temp, humidity, battery_mv, battery_level) FROM STDIN;
+{{ range .Readings }}{{ $.Mac }}	{{ .Timestamp.Format "2006-01-02 15:04:05-07" }}	{{ .Temp }}	{{ .Humidity }}	{{ .BatteryMV }}	{{ .BatteryLevel }}
+{{ end }}\.
+{{- end -}}
+
+-- PostgreSQL import of Mijia sensor {{ .Loc }} ({{ .Mac }})
+--   psql -d mijia -f {{ .Name }}.postgresql.sql
+--
+-- The COPY data section below is sent through psql's connection, so no
+-- file access on the server is needed. To load the readings from a
+-- separate tab separated file instead, use the \copy meta-command:
+--   \copy sensor_data (mac, timestamp, temp, humidity, battery_mv, battery_level) FROM '{{ .Name }}.tsv'
+
+{{ template "postgresql_ddl" . }}
+
+{{ template "postgresql_copy" . }}
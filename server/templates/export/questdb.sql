@@ -0,0 +1,28 @@
+-- QuestDB import of Mijia sensor {{ .Loc }} ({{ .Mac }}) over the
+-- PostgreSQL wire protocol:
+--   psql -h localhost -p 8812 -U admin -d qdb -f {{ .Name }}.questdb.sql
+--
+-- QuestDB limitations to keep in mind:
+-- * timestamp is the designated timestamp, every row needs one and the
+--   table is stored ordered by it. It can not be changed after creation.
+-- * UPDATE is not meant for corrections of bulk data and DELETE is not
+--   supported, fix mistakes by re-importing into a new table.
+-- * COPY FROM STDIN is not supported by the wire protocol, so plain
+--   INSERTs are used. DEDUP makes repeated imports idempotent.
+
+CREATE TABLE IF NOT EXISTS sensor_data (
+    mac SYMBOL,
+    loc SYMBOL,
+    temp DOUBLE,
+    humidity DOUBLE,
+    battery_mv SHORT,
+    battery_level BYTE,
+    timestamp TIMESTAMP
+) TIMESTAMP(timestamp) PARTITION BY DAY WAL
+DEDUP UPSERT KEYS(timestamp, mac);
+{{ range batch .Readings 1000 }}
+INSERT INTO sensor_data (mac, loc, temp, humidity, battery_mv, battery_level, timestamp) VALUES
+{{- range $i, $r := . }}{{ if $i }},{{ end }}
+({{ sqlquote $.Mac }}, {{ sqlquote $.Loc }}, {{ $r.Temp }}, {{ $r.Humidity }}, {{ $r.BatteryMV }}, {{ $r.BatteryLevel }}, '{{ $r.Timestamp.Format "2006-01-02T15:04:05.000000Z" }}')
+{{- end }};
+{{ end -}}
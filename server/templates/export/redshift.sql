@@ -0,0 +1,46 @@
+-- Amazon Redshift import of Mijia sensor {{ .Loc }} ({{ .Mac }})
+--
+-- Stage the CSV export in S3 first:
+--   curl {{ .CSVURL }} | aws s3 cp - {{ .S3Prefix }}{{ .Name }}.csv
+
+-- mac is the distribution key so each sensor's readings stay on one slice,
+-- timestamp is the sort key for range restricted scans
+CREATE TABLE IF NOT EXISTS sensor_data (
+    mac VARCHAR(17) NOT NULL ENCODE ZSTD,
+    timestamp TIMESTAMPTZ NOT NULL ENCODE AZ64,
+    temp DECIMAL(5,2) NOT NULL ENCODE AZ64,
+    humidity DECIMAL(5,2) NOT NULL ENCODE AZ64,
+    battery_mv SMALLINT NOT NULL ENCODE AZ64,
+    battery_level SMALLINT NOT NULL ENCODE AZ64
+)
+DISTSTYLE KEY
+DISTKEY (mac)
+COMPOUND SORTKEY (mac, timestamp);
+
+-- the export has no mac column, load into a staging table first
+CREATE TEMP TABLE sensor_data_staging (
+    timestamp TIMESTAMPTZ,
+    temp DECIMAL(5,2),
+    humidity DECIMAL(5,2),
+    battery_mv SMALLINT,
+    battery_level SMALLINT
+);
+
+COPY sensor_data_staging
+FROM {{ sqlquote (print .S3Prefix .Name ".csv") }}
+IAM_ROLE 'arn:aws:iam::<account_id>:role/<redshift_s3_role>'
+FORMAT AS CSV
+IGNOREHEADER 1
+TIMEFORMAT 'auto';
+
+BEGIN;
+DELETE FROM sensor_data
+USING sensor_data_staging
+WHERE sensor_data.mac = {{ sqlquote .Mac }}
+  AND sensor_data.timestamp = sensor_data_staging.timestamp;
+INSERT INTO sensor_data
+SELECT {{ sqlquote .Mac }}, timestamp, temp, humidity, battery_mv, battery_level
+FROM sensor_data_staging;
+END;
+
+DROP TABLE sensor_data_staging;
@@ -0,0 +1,36 @@
+#!/usr/bin/env python3
+# Inserts the history of Mijia sensor {{ .Loc }} ({{ .Mac }}) directly into
+# Redshift without staging in S3. Slower than COPY, fine for small histories.
+# Requires: pip install psycopg2-binary
+import json
+import os
+import urllib.request
+
+import psycopg2
+from psycopg2.extras import execute_values
+
+HISTORY_URL = {{ quote .HistoryURL }}
+MAC = {{ quote .Mac }}
+
+with urllib.request.urlopen(HISTORY_URL) as response:
+    readings = json.load(response)
+
+connection = psycopg2.connect(
+    host=os.environ.get("REDSHIFT_HOST", "<cluster>.redshift.amazonaws.com"),
+    port=int(os.environ.get("REDSHIFT_PORT", "5439")),
+    dbname=os.environ.get("REDSHIFT_DB", "dev"),
+    user=os.environ.get("REDSHIFT_USER", "awsuser"),
+    password=os.environ["REDSHIFT_PASSWORD"],
+)
+with connection, connection.cursor() as cursor:
+    execute_values(
+        cursor,
+        "INSERT INTO sensor_data (mac, timestamp, temp, humidity, battery_mv, battery_level) VALUES %s",
+        [
+            (MAC, r["timestamp"], r["temp"], r["humidity"], r["battery_mv"], r["battery_level"])
+            for r in readings
+        ],
+        page_size=1000,
+    )
+connection.close()
+print(f"Inserted {len(readings)} readings")
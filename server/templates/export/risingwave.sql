@@ -0,0 +1,36 @@
+-- RisingWave import of Mijia sensor {{ .Loc }} ({{ .Mac }})
+-- psql -h risingwave-host -p 4566 -d dev -U root -f {{ .Name }}.risingwave.sql
+-- Timestamps are in UTC.
+
+-- readings are never updated, an append only table needs no primary key
+CREATE TABLE IF NOT EXISTS sensor_data (
+    mac VARCHAR NOT NULL,
+    timestamp TIMESTAMP NOT NULL,
+    temp DOUBLE PRECISION NOT NULL,
+    humidity DOUBLE PRECISION NOT NULL,
+    battery_mv SMALLINT NOT NULL,
+    battery_level SMALLINT NOT NULL
+) APPEND ONLY;
+{{ range batch .Readings 1000 }}
+INSERT INTO sensor_data (mac, timestamp, temp, humidity, battery_mv, battery_level) VALUES
+{{- range $i, $r := . }}{{ if $i }},{{ end }}
+({{ sqlquote $.Mac }}, '{{ $r.Timestamp.Format "2006-01-02 15:04:05" }}', {{ $r.Temp }}, {{ $r.Humidity }}, {{ $r.BatteryMV }}, {{ $r.BatteryLevel }})
+{{- end }};
+{{ end }}
+CREATE MATERIALIZED VIEW IF NOT EXISTS sensor_hourly AS
+SELECT
+    mac,
+    window_start,
+    avg(temp) AS avg_temp,
+    avg(humidity) AS avg_humidity,
+    count(*) AS readings
+FROM TUMBLE(sensor_data, timestamp, INTERVAL '1 HOUR')
+GROUP BY mac, window_start;
+
+CREATE SINK IF NOT EXISTS sensor_hourly_sink FROM sensor_hourly
+WITH (
+    connector = 'kafka',
+    properties.bootstrap.server = {{ sqlquote .BootstrapServer }},
+    topic = 'sensors.hourly',
+    primary_key = 'mac,window_start'
+) FORMAT UPSERT ENCODE JSON;
@@ -0,0 +1,61 @@
+# AWS Lambda polling the history of Mijia sensor {{ .Loc }} ({{ .Mac }})
+# into the Rockset collection {{ .Workspace }}.{{ .Name }}, triggered on a
+# schedule by the rule of rockset_trigger.json.
+# Environment: ROCKSET_APIKEY, ROCKSET_API_SERVER
+import json
+import os
+import urllib.parse
+import urllib.request
+
+HISTORY_URL = {{ quote .HistoryURL }}
+WORKSPACE = {{ quote .Workspace }}
+COLLECTION = {{ quote .Name }}
+PAGE_SIZE = 1000
+
+API_SERVER = os.environ.get("ROCKSET_API_SERVER", "https://api.usw2a1.rockset.com")
+
+
+def rockset(method, path, body):
+    request = urllib.request.Request(
+        API_SERVER + path,
+        data=json.dumps(body).encode(),
+        method=method,
+        headers={
+            "Authorization": "ApiKey " + os.environ["ROCKSET_APIKEY"],
+            "Content-Type": "application/json",
+        },
+    )
+    with urllib.request.urlopen(request) as response:
+        return json.load(response)
+
+
+def latest_timestamp():
+    result = rockset("POST", "/v1/orgs/self/queries", {
+        "sql": {"query": f"SELECT FORMAT_ISO8601(MAX(_event_time)) AS latest FROM {WORKSPACE}.{COLLECTION}"},
+    })
+    rows = result.get("results") or [{}]
+    return rows[0].get("latest")
+
+
+def lambda_handler(event, context):
+    # the collection itself is the cursor, from is inclusive and the
+    # reading at it replaced by its _id
+    cursor = latest_timestamp()
+    pushed = 0
+    while True:
+        params = {"page_size": PAGE_SIZE}
+        if cursor:
+            params["from"] = cursor
+        with urllib.request.urlopen(HISTORY_URL + "?" + urllib.parse.urlencode(params)) as response:
+            readings = json.load(response)
+        if not readings:
+            break
+
+        docs = [dict(reading, _id=reading["timestamp"]) for reading in readings]
+        rockset("POST", f"/v1/orgs/self/ws/{WORKSPACE}/collections/{COLLECTION}/docs", {"data": docs})
+        pushed += len(docs)
+        if len(readings) < PAGE_SIZE or readings[-1]["timestamp"] == cursor:
+            break
+        cursor = readings[-1]["timestamp"]
+
+    return {"pushed": pushed}
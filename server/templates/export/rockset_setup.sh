@@ -0,0 +1,23 @@
+#!/bin/sh
+# Creates the Rockset collection of Mijia sensor {{ .Loc }} ({{ .Mac }})
+# and the scheduled AWS Lambda polling the history into it.
+# Requires: rockset and aws CLI, ROCKSET_APIKEY, LAMBDA_ROLE_ARN
+set -e
+FUNCTION={{ .Name }}_rockset_ingest
+
+rockset create workspace {{ .Workspace }} || true
+rockset create collection --workspace {{ .Workspace }} --file rockset_collection.json
+rockset query --file rockset_trend.sql
+
+zip -q rockset_ingest.zip rockset_ingest.py
+aws lambda create-function --function-name "$FUNCTION" \
+    --runtime python3.12 --handler rockset_ingest.lambda_handler \
+    --zip-file fileb://rockset_ingest.zip --role "$LAMBDA_ROLE_ARN" \
+    --timeout 300 --environment "Variables={ROCKSET_APIKEY=$ROCKSET_APIKEY}"
+FUNCTION_ARN=$(aws lambda get-function --function-name "$FUNCTION" --query Configuration.FunctionArn --output text)
+
+aws events put-rule --cli-input-json file://rockset_trigger.json
+RULE_ARN=$(aws events describe-rule --name "$FUNCTION" --query Arn --output text)
+aws lambda add-permission --function-name "$FUNCTION" --statement-id events \
+    --action lambda:InvokeFunction --principal events.amazonaws.com --source-arn "$RULE_ARN"
+aws events put-targets --rule "$FUNCTION" --targets "Id=$FUNCTION,Arn=$FUNCTION_ARN"
@@ -0,0 +1,17 @@
+-- Temperature trend of Mijia sensor {{ .Loc }} ({{ .Mac }}): hourly
+-- averages with the change to the previous hour and a 24 hour moving
+-- average.
+SELECT
+    hour,
+    avg_temp,
+    avg_temp - LAG(avg_temp) OVER (ORDER BY hour) AS change,
+    AVG(avg_temp) OVER (ORDER BY hour ROWS BETWEEN 23 PRECEDING AND CURRENT ROW) AS moving_avg_24h
+FROM (
+    SELECT
+        DATE_TRUNC('HOUR', _event_time) AS hour,
+        AVG(temp) AS avg_temp
+    FROM {{ .Workspace }}.{{ .Name }}
+    WHERE _event_time > CURRENT_TIMESTAMP() - INTERVAL 7 DAY
+    GROUP BY hour
+)
+ORDER BY hour;
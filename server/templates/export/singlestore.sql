@@ -0,0 +1,40 @@
+-- SingleStore import of Mijia sensor {{ .Loc }} ({{ .Mac }})
+-- curl -o /tmp/{{ .Name }}.csv {{ .CSVURL }}
+-- singlestore --local-infile -h localhost -u root mijia < {{ .Name }}.singlestore.sql
+-- Timestamps are in UTC.
+
+-- columnstore table, readings are sorted by time within each mac shard
+CREATE TABLE IF NOT EXISTS sensor_data (
+    mac CHAR(17) NOT NULL OPTION 'SeekableLZ4',
+    timestamp DATETIME NOT NULL,
+    temp DECIMAL(5,2) NOT NULL,
+    humidity DECIMAL(5,2) NOT NULL,
+    battery_mv SMALLINT NOT NULL,
+    battery_level TINYINT NOT NULL,
+    SORT KEY (timestamp),
+    SHARD KEY (mac)
+);
+
+LOAD DATA LOCAL INFILE '/tmp/{{ .Name }}.csv'
+INTO TABLE sensor_data
+COLUMNS TERMINATED BY ','
+IGNORE 1 LINES
+(@timestamp, temp, humidity, battery_mv, battery_level)
+SET mac = {{ sqlquote .Mac }},
+    timestamp = STR_TO_DATE(@timestamp, '%Y-%m-%dT%H:%i:%sZ');
+
+-- real-time ingestion of the SensorReading messages of the sensors topic,
+-- see the Kafka Schema Registry export
+CREATE PIPELINE IF NOT EXISTS {{ .Name }}_pipeline AS
+LOAD DATA KAFKA 'localhost:9092/sensors'
+INTO TABLE sensor_data
+FORMAT JSON
+(@timestamp <- timestamp,
+ temp <- temp,
+ humidity <- humidity,
+ battery_mv <- battery_mv,
+ battery_level <- battery_level)
+SET mac = {{ sqlquote .Mac }},
+    timestamp = STR_TO_DATE(@timestamp, '%Y-%m-%dT%H:%i:%sZ');
+
+START PIPELINE {{ .Name }}_pipeline;
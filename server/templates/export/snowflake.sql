@@ -0,0 +1,27 @@
+-- Snowflake import of Mijia sensor {{ .Loc }} ({{ .Mac }})
+--
+-- Snowflake stages only support cloud storage, so the CSV export is
+-- downloaded first and uploaded into an internal stage with PUT:
+--   curl -o /tmp/{{ .Name }}.csv {{ .CSVURL }}
+--   snowsql -c mijia -f snowflake.sql
+
+CREATE TABLE IF NOT EXISTS sensor_data (
+    mac VARCHAR(17) NOT NULL,
+    timestamp TIMESTAMP_TZ NOT NULL,
+    temp NUMBER(5,2) NOT NULL,
+    humidity NUMBER(5,2) NOT NULL,
+    battery_mv SMALLINT NOT NULL,
+    battery_level TINYINT NOT NULL
+);
+
+CREATE STAGE IF NOT EXISTS sensor_stage
+    FILE_FORMAT = (TYPE = CSV SKIP_HEADER = 1 TIMESTAMP_FORMAT = 'YYYY-MM-DD"T"HH24:MI:SSTZH:TZM');
+
+PUT file:///tmp/{{ .Name }}.csv @sensor_stage AUTO_COMPRESS = TRUE OVERWRITE = TRUE;
+
+COPY INTO sensor_data (mac, timestamp, temp, humidity, battery_mv, battery_level)
+FROM (
+    SELECT {{ sqlquote .Mac }}, $1, $2, $3, $4, $5
+    FROM @sensor_stage/{{ .Name }}.csv.gz
+)
+ON_ERROR = ABORT_STATEMENT;
@@ -0,0 +1,14 @@
+CREATE TABLE Sensors (
+  Mac STRING(17) NOT NULL,
+  Loc STRING(MAX),
+) PRIMARY KEY (Mac);
+
+CREATE TABLE SensorData (
+  Mac STRING(17) NOT NULL,
+  Timestamp TIMESTAMP NOT NULL,
+  Temp FLOAT64,
+  Humidity FLOAT64,
+  BatteryMV INT64,
+  BatteryLevel INT64,
+) PRIMARY KEY (Mac, Timestamp),
+  INTERLEAVE IN PARENT Sensors ON DELETE CASCADE;
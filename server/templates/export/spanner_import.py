@@ -0,0 +1,60 @@
+#!/usr/bin/env python3
+# Imports the history of Mijia sensor {{ .Loc }} ({{ .Mac }}) into Cloud
+# Spanner, readings imported before are overwritten.
+# Requires: pip install google-cloud-spanner
+import datetime
+import json
+import os
+import urllib.parse
+import urllib.request
+
+from google.cloud import spanner
+
+HISTORY_URL = {{ quote .HistoryURL }}
+MAC = {{ quote .Mac }}
+LOC = {{ quote .Loc }}
+PAGE_SIZE = 1000
+
+COLUMNS = ("Mac", "Timestamp", "Temp", "Humidity", "BatteryMV", "BatteryLevel")
+
+
+def readings():
+    page = 1
+    while True:
+        params = urllib.parse.urlencode({"page_size": PAGE_SIZE, "page": page})
+        with urllib.request.urlopen(HISTORY_URL + "?" + params) as response:
+            batch = json.load(response)
+        yield from batch
+        if len(batch) < PAGE_SIZE:
+            return
+        page += 1
+
+
+def main():
+    database = spanner.Client().instance(os.environ.get("INSTANCE", "mijia")).database(os.environ.get("DATABASE", "mijia"))
+
+    with database.batch() as batch:
+        batch.insert_or_update("Sensors", columns=("Mac", "Loc"), values=[(MAC, LOC)])
+
+    rows = []
+    count = 0
+    for reading in readings():
+        timestamp = datetime.datetime.fromisoformat(reading["timestamp"].replace("Z", "+00:00"))
+        rows.append((MAC, timestamp, reading["temp"], reading["humidity"], reading["battery_mv"], reading["battery_level"]))
+        # a commit is limited to 80000 mutations, 6 columns each
+        if len(rows) == 5000:
+            count += write(database, rows)
+            rows = []
+    if rows:
+        count += write(database, rows)
+    print(f"imported {count} readings")
+
+
+def write(database, rows):
+    with database.batch() as batch:
+        batch.insert_or_update("SensorData", columns=COLUMNS, values=rows)
+    return len(rows)
+
+
+if __name__ == "__main__":
+    main()
@@ -0,0 +1,17 @@
+#!/bin/sh
+# Creates the Spanner tables of Mijia sensor {{ .Loc }} ({{ .Mac }}) and
+# imports its history with spanner_import.py.
+#
+# The readings are interleaved in their sensor in spanner.sql, so the rows
+# of a sensor are stored together. The key starts with Mac instead of the
+# Timestamp, which would put all writes on one split. Without a Sensors
+# table drop the INTERLEAVE clause, the key stays the same.
+# Requires: gcloud, pip install google-cloud-spanner
+set -e
+INSTANCE="${INSTANCE:-mijia}"
+DATABASE="${DATABASE:-mijia}"
+
+gcloud spanner databases create "$DATABASE" --instance="$INSTANCE" || true
+gcloud spanner databases ddl update "$DATABASE" --instance="$INSTANCE" --ddl-file=spanner.sql
+
+INSTANCE="$INSTANCE" DATABASE="$DATABASE" python3 spanner_import.py
@@ -0,0 +1,30 @@
+-- Merge the history of Mijia sensor {{ .Loc }} ({{ .Mac }}) into the
+-- database of another Mijia server:
+--   sqlite3 :memory: < {{ .Name }}.sqlite.sql
+-- Readings whose timestamp already exists in the target are skipped.
+
+ATTACH DATABASE {{ sqlquote .Target }} AS target;
+
+CREATE TABLE IF NOT EXISTS target.sensor_data (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    temp INTEGER NOT NULL,
+    humidity INTEGER NOT NULL,
+    battery_mv INTEGER NOT NULL,
+    battery_level INTEGER NOT NULL,
+    timestamp DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+BEGIN;
+{{ range batch .Readings 500 }}
+INSERT INTO target.sensor_data (temp, humidity, battery_mv, battery_level, timestamp)
+SELECT column1, column2, column3, column4, column5
+FROM (VALUES
+{{- range $i, $r := . }}{{ if $i }},{{ end }}
+    ({{ centi $r.Temp }}, {{ centi $r.Humidity }}, {{ $r.BatteryMV }}, {{ $r.BatteryLevel }}, '{{ $r.Timestamp.Format "2006-01-02 15:04:05" }}')
+{{- end }}
+) AS v
+WHERE NOT EXISTS (SELECT 1 FROM target.sensor_data WHERE timestamp = v.column5);
+{{ end }}
+COMMIT;
+
+DETACH DATABASE target;
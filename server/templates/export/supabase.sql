@@ -0,0 +1,31 @@
+{{ define "supabase_rls" -}}
+-- Tables in the public schema are served by the Supabase REST API, only
+-- signed in users may read the readings. The Edge Function writes with
+-- the service role, which bypasses row level security.
+ALTER TABLE sensor_data ENABLE ROW LEVEL SECURITY;
+
+DROP POLICY IF EXISTS "sensor_data is readable by authenticated users" ON sensor_data;
+CREATE POLICY "sensor_data is readable by authenticated users"
+    ON sensor_data FOR SELECT TO authenticated USING (true);
+{{- end -}}
+
+-- Supabase import of Mijia sensor {{ .Loc }} ({{ .Mac }})
+--
+-- With psql and the connection string of the project (Project Settings >
+-- Database):
+--   psql "postgresql://postgres.<project-ref>:<password>@aws-0-<region>.pooler.supabase.com:5432/postgres" -f {{ .Name }}.supabase.sql
+--
+-- With the Supabase CLI the table is created by the migration in
+-- supabase/migrations instead:
+--   supabase link --project-ref <project-ref>
+--   supabase db push
+-- and the readings are loaded afterwards with the psql command above.
+--
+-- The SQL editor of the dashboard runs the DDL, but not the COPY ... FROM
+-- STDIN below, which needs a client sending the data section.
+
+{{ template "postgresql_ddl" . }}
+
+{{ template "supabase_rls" . }}
+
+{{ template "postgresql_copy" . }}
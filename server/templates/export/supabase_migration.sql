@@ -0,0 +1,6 @@
+-- sensor_data table of Mijia sensor {{ .Loc }} ({{ .Mac }}), applied with
+-- supabase db push
+
+{{ template "postgresql_ddl" . }}
+
+{{ template "supabase_rls" . }}
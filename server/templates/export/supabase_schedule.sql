@@ -0,0 +1,22 @@
+-- Runs the mijia-sync Edge Function every 15 minutes with pg_cron and
+-- pg_net, both available as extensions of every Supabase project.
+-- Replace <project-ref> and <anon-key> (Project Settings > API) and run
+-- it in the SQL editor after:
+--   supabase functions deploy mijia-sync
+--   supabase secrets set MIJIA_HISTORY_URL={{ .HistoryURL }}
+--
+-- The function fetches the readings from the Mijia server, which must be
+-- reachable from the internet at {{ .ServerURL }}.
+CREATE EXTENSION IF NOT EXISTS pg_cron;
+CREATE EXTENSION IF NOT EXISTS pg_net;
+
+SELECT cron.schedule(
+    '{{ .Name }}-sync',
+    '*/15 * * * *',
+    $$
+    SELECT net.http_post(
+        url := 'https://<project-ref>.supabase.co/functions/v1/mijia-sync',
+        headers := jsonb_build_object('Authorization', 'Bearer <anon-key>')
+    );
+    $$
+);
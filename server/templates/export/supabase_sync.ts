@@ -0,0 +1,66 @@
+// Supabase Edge Function copying new readings of Mijia sensor
+// {{ .Loc }} ({{ .Mac }}) from the JSON API of the Mijia server into the
+// sensor_data table. Scheduled by supabase_schedule.sql.
+import { createClient } from "jsr:@supabase/supabase-js@2";
+
+const MAC = {{ quote .Mac }};
+const HISTORY_URL = Deno.env.get("MIJIA_HISTORY_URL") ?? {{ quote .HistoryURL }};
+const BATCH_SIZE = 1000;
+
+interface Reading {
+  timestamp: string;
+  temp: number;
+  humidity: number;
+  battery_mv: number;
+  battery_level: number;
+}
+
+Deno.serve(async () => {
+  const supabase = createClient(
+    Deno.env.get("SUPABASE_URL")!,
+    Deno.env.get("SUPABASE_SERVICE_ROLE_KEY")!,
+  );
+
+  // continue after the latest imported reading
+  const { data: latest, error } = await supabase
+    .from("sensor_data")
+    .select("timestamp")
+    .eq("mac", MAC)
+    .order("timestamp", { ascending: false })
+    .limit(1);
+  if (error) {
+    return Response.json({ error: error.message }, { status: 500 });
+  }
+  const url = new URL(HISTORY_URL);
+  if (latest.length > 0) {
+    const from = new Date(new Date(latest[0].timestamp).getTime() + 1000);
+    url.searchParams.set("from", from.toISOString().replace(/\.\d+Z$/, "Z"));
+  }
+
+  const response = await fetch(url);
+  if (!response.ok) {
+    return Response.json(
+      { error: `${url}: ${response.status} ${response.statusText}` },
+      { status: 502 },
+    );
+  }
+  const readings: Reading[] = await response.json();
+  const rows = readings.map((reading) => ({
+    mac: MAC,
+    timestamp: reading.timestamp,
+    temp: reading.temp,
+    humidity: reading.humidity,
+    battery_mv: reading.battery_mv,
+    battery_level: reading.battery_level,
+  }));
+
+  for (let i = 0; i < rows.length; i += BATCH_SIZE) {
+    const { error } = await supabase
+      .from("sensor_data")
+      .upsert(rows.slice(i, i + BATCH_SIZE), { onConflict: "mac,timestamp" });
+    if (error) {
+      return Response.json({ error: error.message }, { status: 500 });
+    }
+  }
+  return Response.json({ upserted: rows.length });
+});
@@ -0,0 +1,18 @@
+-- TDengine import of Mijia sensor {{ .Loc }} ({{ .Mac }})
+--   taos -f {{ .Name }}.tdengine.sql
+-- Timestamps are epoch milliseconds, independent of the client time zone.
+
+CREATE DATABASE IF NOT EXISTS mijia PRECISION 'ms';
+USE mijia;
+
+CREATE STABLE IF NOT EXISTS sensors (
+    ts TIMESTAMP,
+    temp FLOAT,
+    humidity FLOAT,
+    battery_mv SMALLINT,
+    battery_level TINYINT
+) TAGS (mac NCHAR(17), loc NCHAR(64));
+{{ range batch .Readings 1000 }}
+INSERT INTO {{ $.Name }} USING sensors TAGS ({{ sqlquote $.Mac }}, {{ sqlquote $.Loc }}) VALUES
+{{- range . }} ({{ .Timestamp.UnixMilli }}, {{ .Temp }}, {{ .Humidity }}, {{ .BatteryMV }}, {{ .BatteryLevel }}){{ end }};
+{{ end -}}
@@ -0,0 +1,7 @@
+#!/bin/sh
+# Loads the history of Mijia sensor {{ .Loc }} ({{ .Mac }}) into Teradata
+# with BTEQ and FastLoad of the Teradata Tools and Utilities.
+set -e
+bteq < teradata_setup.bteq
+fastload < teradata.fastload
+bteq < teradata_merge.bteq
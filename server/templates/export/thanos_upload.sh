@@ -0,0 +1,20 @@
+#!/bin/sh
+# Creates a TSDB block of Mijia sensor {{ .Loc }} ({{ .Mac }}) from
+# sensor_data.csv and uploads it to the object storage of Thanos.
+# Requires Go and thanos, OBJSTORE_CONFIG is the Thanos bucket config.
+set -e
+OBJSTORE_CONFIG="${OBJSTORE_CONFIG:-bucket.yml}"
+
+if [ ! -f go.mod ]; then
+    go mod init mijia_thanos_block
+    go get github.com/prometheus/prometheus@v0.54.1
+    go mod tidy
+fi
+go run thanos_block.go
+
+# the external labels identify the sensor as source of the block
+thanos tools bucket upload-blocks \
+    --objstore.config-file="$OBJSTORE_CONFIG" \
+    --path=blocks \
+    --label={{ shellquote (printf "mac=%s" (quote .Mac)) }} \
+    --label={{ shellquote (printf "loc=%s" (quote .Loc)) }}
@@ -0,0 +1,32 @@
+-- TiDB import of Mijia sensor {{ .Loc }} ({{ .Mac }})
+--   mysql --local-infile=1 -h 127.0.0.1 -P 4000 -u root mijia < tidb.sql
+-- For large histories use TiDB Lightning instead of LOAD DATA:
+--   tiup tidb-lightning -config tidb-lightning.toml
+-- Timestamps are in UTC.
+
+-- monthly partitions from {{ .FirstPartition }}, extend them with
+-- ALTER TABLE sensor_data LAST PARTITION LESS THAN ('<month>')
+CREATE TABLE IF NOT EXISTS sensor_data (
+    mac CHAR(17) NOT NULL,
+    timestamp DATETIME NOT NULL,
+    temp DECIMAL(5,2) NOT NULL,
+    humidity DECIMAL(5,2) NOT NULL,
+    battery_mv SMALLINT NOT NULL,
+    battery_level TINYINT NOT NULL,
+    PRIMARY KEY (mac, timestamp)
+)
+PARTITION BY RANGE COLUMNS (timestamp)
+INTERVAL (1 MONTH)
+FIRST PARTITION LESS THAN ('{{ .FirstPartition }}')
+LAST PARTITION LESS THAN ('{{ .LastPartition }}');
+
+-- columnar replica for analytical queries
+ALTER TABLE sensor_data SET TIFLASH REPLICA 1;
+
+-- readings imported before are skipped
+LOAD DATA LOCAL INFILE 'mijia.sensor_data.0.csv'
+IGNORE INTO TABLE sensor_data
+FIELDS TERMINATED BY ','
+LINES TERMINATED BY '\n'
+IGNORE 1 LINES
+(mac, timestamp, temp, humidity, battery_mv, battery_level);
@@ -0,0 +1,29 @@
+-- TimescaleDB import of Mijia sensor {{ .Loc }} ({{ .Mac }})
+--   psql -d mijia -f {{ .Name }}.timescaledb.sql
+
+CREATE EXTENSION IF NOT EXISTS timescaledb;
+
+{{ template "postgresql_ddl" . }}
+
+-- one chunk per week keeps the chunks of a few sensors small
+SELECT create_hypertable('sensor_data', 'timestamp',
+    chunk_time_interval => INTERVAL '7 days',
+    if_not_exists => TRUE,
+    migrate_data => TRUE);
+
+-- readings older than the retention are dropped, also the imported ones
+SELECT add_retention_policy('sensor_data', {{ sqlquote .Retention }}::INTERVAL, if_not_exists => TRUE);
+
+{{ template "postgresql_copy" . }}
+
+-- hourly aggregation
+SELECT
+    time_bucket('1 hour', timestamp) AS bucket,
+    round(avg(temp), 2) AS avg_temp,
+    min(temp) AS min_temp,
+    max(temp) AS max_temp,
+    round(avg(humidity), 2) AS avg_humidity
+FROM sensor_data
+WHERE mac = {{ sqlquote .Mac }}
+GROUP BY bucket
+ORDER BY bucket;
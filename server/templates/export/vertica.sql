@@ -0,0 +1,32 @@
+-- Vertica import of Mijia sensor {{ .Loc }} ({{ .Mac }})
+-- vsql -h localhost -U dbadmin -f {{ .Name }}.vertica.sql
+
+CREATE TABLE IF NOT EXISTS sensor_data (
+    mac VARCHAR(17) NOT NULL ENCODING RLE,
+    timestamp TIMESTAMPTZ NOT NULL ENCODING DELTAVAL,
+    temp NUMERIC(5,2) NOT NULL,
+    humidity NUMERIC(5,2) NOT NULL,
+    battery_mv SMALLINT NOT NULL ENCODING RLE,
+    battery_level SMALLINT NOT NULL ENCODING RLE
+)
+ORDER BY timestamp
+SEGMENTED BY hash(mac) ALL NODES KSAFE 1;
+
+-- HttpSource is the cURL source of the Vertica SDK examples
+-- (/opt/vertica/sdk/examples/SourceFunctions), built as curllib
+CREATE LIBRARY IF NOT EXISTS curllib AS '/opt/vertica/sdk/examples/build/cURLLib.so';
+CREATE SOURCE HttpSource AS LANGUAGE 'C++' NAME 'CurlSourceFactory' LIBRARY curllib;
+
+COPY sensor_data (
+    mac AS {{ sqlquote .Mac }},
+    ts FILLER VARCHAR(25),
+    timestamp AS ts::TIMESTAMPTZ,
+    temp,
+    humidity,
+    battery_mv,
+    battery_level
+)
+SOURCE HttpSource(url = {{ sqlquote .CSVURL }})
+DELIMITER ','
+SKIP 1
+ABORT ON ERROR;
@@ -0,0 +1,20 @@
+-- YugabyteDB YSQL import of Mijia sensor {{ .Loc }} ({{ .Mac }})
+--   ysqlsh -h localhost -d yugabyte -f ysql_import.sql
+
+-- range sharded so the readings of a sensor are stored in time order,
+-- pre-split into one tablet per month of the readings
+CREATE TABLE IF NOT EXISTS sensor_data (
+    mac VARCHAR(17) NOT NULL,
+    timestamp TIMESTAMP WITH TIME ZONE NOT NULL,
+    temp NUMERIC(5,2) NOT NULL,
+    humidity NUMERIC(5,2) NOT NULL,
+    battery_mv SMALLINT NOT NULL,
+    battery_level SMALLINT NOT NULL,
+    PRIMARY KEY (mac ASC, timestamp ASC)
+){{ if .SplitPoints }} SPLIT AT VALUES (
+{{- range $i, $split := .SplitPoints }}{{ if $i }},{{ end }}
+    ({{ sqlquote $.Mac }}, '{{ $split }}')
+{{- end }}
+){{ end }};
+
+{{ template "postgresql_copy" . }}
@@ -0,0 +1,17 @@
+# Receives the readings of Mijia sensor {{ .Loc }} ({{ .Mac }}) pushed by
+# export.zeromq on a ZeroMQ PULL socket and prints them.
+#   pip install pyzmq
+#   python zeromq_pull.py [endpoint]
+import sys
+
+import zmq
+
+ENDPOINT = sys.argv[1] if len(sys.argv) > 1 else {{ quote .BindEndpoint }}
+
+context = zmq.Context()
+socket = context.socket(zmq.PULL)
+socket.bind(ENDPOINT)
+print(f"waiting for readings on {ENDPOINT}")
+while True:
+    reading = socket.recv_json()
+    print(reading["timestamp"], reading["temp"], reading["humidity"])
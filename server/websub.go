@@ -0,0 +1,322 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WebSub topics are the export.websub URLs of the sensors. The logger
+// writes readings into the databases directly, so new data is detected by
+// polling the latest timestamp of each subscribed topic.
+const (
+	websubTopicSuffix   = "/history/export.websub"
+	websubPollInterval  = time.Minute
+	websubDefaultLease  = 24 * time.Hour
+	websubMaxLease      = 10 * 24 * time.Hour
+	websubTopicReadings = 100
+	// publish requests are anonymous, they force a distribution at most
+	// once per interval and sensor
+	websubPublishInterval = time.Minute
+)
+
+// websubClient verifies and delivers to the callbacks, which subscribers
+// choose freely, so only on public addresses.
+var websubClient = publicClient(60 * time.Second)
+
+type websubSubscription struct {
+	Topic   string
+	Secret  string
+	Expires time.Time
+}
+
+// websubHub keeps the verified subscriptions in memory, subscribers renew
+// them after a restart like after the lease expired.
+type websubHub struct {
+	mu sync.Mutex
+	// mac -> callback -> subscription
+	subscriptions map[string]map[string]websubSubscription
+	// timestamp of the latest reading distributed per mac
+	distributed map[string]time.Time
+	// time of the last accepted publish request per mac
+	published map[string]time.Time
+}
+
+var hub = &websubHub{
+	subscriptions: map[string]map[string]websubSubscription{},
+	distributed:   map[string]time.Time{},
+	published:     map[string]time.Time{},
+}
+
+// websubTopic returns the topic URL of the sensor.
+func websubTopic(r *http.Request, mac string) string {
+	return historyURL(r, mac, "websub")
+}
+
+// websubTopicSensor returns the sensor of a topic URL.
+func websubTopicSensor(topic string) (string, bool) {
+	u, err := url.Parse(topic)
+	if err != nil || !strings.HasPrefix(u.Path, "/api/sensors/") || !strings.HasSuffix(u.Path, websubTopicSuffix) {
+		return "", false
+	}
+	mac := strings.ToLower(strings.TrimSuffix(strings.TrimPrefix(u.Path, "/api/sensors/"), websubTopicSuffix))
+	_, ok := configMap[mac]
+	return mac, ok
+}
+
+// websubLinks sets the Link headers pointing subscribers to the hub.
+func websubLinks(w http.ResponseWriter, r *http.Request, mac string) {
+	w.Header().Add("Link", fmt.Sprintf("<%s/hub>; rel=\"hub\"", serverURL(r)))
+	w.Header().Add("Link", fmt.Sprintf("<%s>; rel=\"self\"", websubTopic(r, mac)))
+}
+
+// latestReadings reads the last n readings of a sensor in chronological
+// order.
+func latestReadings(config Config, n int) ([]SensorReading, error) {
+	rows, err := config.Db.Query(`
+		SELECT temp, humidity, battery_mv, battery_level, timestamp
+		FROM sensor_data
+		ORDER BY timestamp DESC
+		LIMIT ?`, n)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	readings := []SensorReading{}
+	for rows.Next() {
+		var reading SensorReading
+		if err := rows.Scan(&reading.Temp, &reading.Humidity, &reading.BatteryMV, &reading.BatteryLevel, &reading.Timestamp); err != nil {
+			return nil, err
+		}
+		reading.Temp /= 100
+		reading.Humidity /= 100
+		readings = append(readings, reading)
+	}
+	slices.Reverse(readings)
+	return readings, rows.Err()
+}
+
+// websubHandler is the hub endpoint: subscribe and unsubscribe requests
+// of subscribers are verified asynchronously, publish requests notify the
+// subscribers of a topic at once, at most once per websubPublishInterval.
+func websubHandler(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "invalid form body", http.StatusBadRequest)
+		return
+	}
+	mode := r.PostForm.Get("hub.mode")
+	topic := r.PostForm.Get("hub.topic")
+	if topic == "" {
+		// publish requests by convention name the topic hub.url
+		topic = r.PostForm.Get("hub.url")
+	}
+	mac, ok := websubTopicSensor(topic)
+	if !ok {
+		http.Error(w, "hub.topic is not a topic of this hub", http.StatusBadRequest)
+		return
+	}
+
+	switch mode {
+	case "publish":
+		hub.mu.Lock()
+		wait := websubPublishInterval - time.Since(hub.published[mac])
+		if wait <= 0 {
+			hub.published[mac] = time.Now()
+		}
+		hub.mu.Unlock()
+		if wait > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+			http.Error(w, "topic was published recently", http.StatusTooManyRequests)
+			return
+		}
+		go hub.distribute(mac, true)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	case "subscribe", "unsubscribe":
+	default:
+		http.Error(w, "hub.mode must be subscribe, unsubscribe or publish", http.StatusBadRequest)
+		return
+	}
+
+	callback, err := url.Parse(r.PostForm.Get("hub.callback"))
+	if err != nil || (callback.Scheme != "http" && callback.Scheme != "https") || callback.Host == "" {
+		http.Error(w, "hub.callback must be an http or https URL", http.StatusBadRequest)
+		return
+	}
+	lease := websubDefaultLease
+	if value := r.PostForm.Get("hub.lease_seconds"); value != "" {
+		seconds, err := strconv.Atoi(value)
+		if err != nil || seconds < 1 {
+			http.Error(w, "invalid hub.lease_seconds", http.StatusBadRequest)
+			return
+		}
+		lease = min(time.Duration(seconds)*time.Second, websubMaxLease)
+	}
+	secret := r.PostForm.Get("hub.secret")
+	if len(secret) > 200 {
+		http.Error(w, "hub.secret must be less than 200 bytes", http.StatusBadRequest)
+		return
+	}
+
+	go hub.verify(mode, mac, topic, callback.String(), secret, lease)
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// verify confirms the intent of the subscriber by echoing a challenge and
+// applies the (un)subscription.
+func (h *websubHub) verify(mode, mac, topic, callback, secret string, lease time.Duration) {
+	challenge := make([]byte, 16)
+	rand.Read(challenge)
+	u, _ := url.Parse(callback)
+	query := u.Query()
+	query.Set("hub.mode", mode)
+	query.Set("hub.topic", topic)
+	query.Set("hub.challenge", hex.EncodeToString(challenge))
+	if mode == "subscribe" {
+		query.Set("hub.lease_seconds", strconv.Itoa(int(lease.Seconds())))
+	}
+	u.RawQuery = query.Encode()
+
+	resp, err := websubClient.Get(u.String())
+	if err != nil {
+		log.Printf("WebSub verification of %s failed: %v", callback, err)
+		return
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 || string(body) != hex.EncodeToString(challenge) {
+		log.Printf("WebSub %s of %s to %s not confirmed", mode, callback, topic)
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if mode == "unsubscribe" {
+		delete(h.subscriptions[mac], callback)
+		return
+	}
+	if h.subscriptions[mac] == nil {
+		h.subscriptions[mac] = map[string]websubSubscription{}
+	}
+	h.subscriptions[mac][callback] = websubSubscription{Topic: topic, Secret: secret, Expires: time.Now().Add(lease)}
+}
+
+// distribute sends the latest readings of the sensor to the subscribers
+// of its topic if there are new readings since the last distribution, or
+// always when forced.
+func (h *websubHub) distribute(mac string, force bool) {
+	readings, err := latestReadings(configMap[mac], websubTopicReadings)
+	if err != nil {
+		log.Printf("%v", err)
+		return
+	}
+	var latest time.Time
+	if len(readings) > 0 {
+		latest = readings[len(readings)-1].Timestamp
+	}
+
+	h.mu.Lock()
+	if !force && !latest.After(h.distributed[mac]) {
+		h.mu.Unlock()
+		return
+	}
+	h.distributed[mac] = latest
+	subscriptions := map[string]websubSubscription{}
+	for callback, subscription := range h.subscriptions[mac] {
+		if time.Now().After(subscription.Expires) {
+			delete(h.subscriptions[mac], callback)
+			continue
+		}
+		subscriptions[callback] = subscription
+	}
+	h.mu.Unlock()
+	if len(subscriptions) == 0 {
+		return
+	}
+
+	content, err := json.Marshal(readings)
+	if err != nil {
+		log.Printf("%v", err)
+		return
+	}
+	for callback, subscription := range subscriptions {
+		hubURL := strings.SplitN(subscription.Topic, "/api/sensors/", 2)[0] + "/hub"
+		req, err := http.NewRequest(http.MethodPost, callback, bytes.NewReader(content))
+		if err != nil {
+			log.Printf("%v", err)
+			continue
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Add("Link", fmt.Sprintf("<%s>; rel=\"hub\"", hubURL))
+		req.Header.Add("Link", fmt.Sprintf("<%s>; rel=\"self\"", subscription.Topic))
+		if subscription.Secret != "" {
+			signature := hmac.New(sha256.New, []byte(subscription.Secret))
+			signature.Write(content)
+			req.Header.Set("X-Hub-Signature", "sha256="+hex.EncodeToString(signature.Sum(nil)))
+		}
+		resp, err := websubClient.Do(req)
+		if err != nil {
+			log.Printf("WebSub delivery to %s failed: %v", callback, err)
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusGone {
+			// the subscriber asks to be removed
+			h.mu.Lock()
+			delete(h.subscriptions[mac], callback)
+			h.mu.Unlock()
+		} else if resp.StatusCode/100 != 2 {
+			log.Printf("WebSub delivery to %s failed: %s", callback, resp.Status)
+		}
+	}
+}
+
+// watch distributes new readings of the subscribed sensors.
+func (h *websubHub) watch() {
+	for range time.Tick(websubPollInterval) {
+		h.mu.Lock()
+		var macs []string
+		for mac, subscriptions := range h.subscriptions {
+			if len(subscriptions) > 0 {
+				macs = append(macs, mac)
+			}
+		}
+		h.mu.Unlock()
+		for _, mac := range macs {
+			h.distribute(mac, false)
+		}
+	}
+}
+
+// exportWebsub returns the last 100 readings of the sensor, the content of
+// its WebSub topic, and notifies the subscribers of new readings.
+func exportWebsub(w http.ResponseWriter, r *http.Request) {
+	history, ok := loadSensor(w, r)
+	if !ok {
+		return
+	}
+	readings, err := latestReadings(configMap[history.Mac], websubTopicReadings)
+	if err != nil {
+		log.Printf("%v", err)
+		http.Error(w, "Data could not be loaded", http.StatusInternalServerError)
+		return
+	}
+
+	go hub.distribute(history.Mac, false)
+	websubLinks(w, r, history.Mac)
+	writeJSON(w, "application/json", readings)
+}